@@ -8,8 +8,14 @@ import (
 	"strings"
 
 	_ "github.com/diegob0/rspv_backend/docs"
+	"github.com/diegob0/rspv_backend/internal/services/checkins"
+	"github.com/diegob0/rspv_backend/internal/services/constraints"
+	"github.com/diegob0/rspv_backend/internal/services/events"
+	"github.com/diegob0/rspv_backend/internal/services/exports"
 	"github.com/diegob0/rspv_backend/internal/services/generals"
 	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/services/rsvp"
+	"github.com/diegob0/rspv_backend/internal/services/seating"
 	"github.com/diegob0/rspv_backend/internal/services/tables"
 	"github.com/diegob0/rspv_backend/internal/services/tickets"
 	"github.com/diegob0/rspv_backend/internal/services/user"
@@ -50,25 +56,59 @@ func (s *APIServer) Run() error {
 	userHandler := user.NewHandler(userStore)
 	userHandler.RegisterRoutes(subrouter)
 
+	// Events routes
+	eventStore := events.NewStore(s.db)
+	eventHandler := events.NewHandler(eventStore)
+	eventHandler.RegisterRoutes(subrouter)
+
+	// Everything below is scoped to a single event
+	eventRouter := subrouter.PathPrefix("/events/{eventId:[0-9]+}").Subrouter()
+	eventRouter.Use(eventHandler.RequireEvent)
+
 	// Tables routes
 	tableStore := tables.NewStore(s.db)
 	tableHandler := tables.NewHandler(tableStore)
-	tableHandler.RegisterRoutes(subrouter)
+	tableHandler.RegisterRoutes(eventRouter)
 
 	// Guests routes
 	guestStore := guests.NewStore(s.db)
 	guestHandler := guests.NewHandler(guestStore)
-	guestHandler.RegisterRoutes(subrouter)
+	guestHandler.RegisterRoutes(eventRouter)
+
+	// Public RSVP routes, keyed by the guest invitation token
+	rsvpStore := rsvp.NewStore(s.db)
+	rsvpHandler := rsvp.NewHandler(rsvpStore, guestStore)
+	rsvpHandler.RegisterRoutes(subrouter)
 
 	// General tickets routes
 	generalStore := generals.NewStore(s.db)
 	generalHandler := generals.NewHandler(generalStore)
-	generalHandler.RegisterRoutes(subrouter)
+	generalHandler.RegisterRoutes(eventRouter)
+
+	// Seating constraints, checked on every assignment
+	constraintStore := constraints.NewStore(s.db)
+	constraintHandler := constraints.NewHandler(constraintStore)
+	constraintHandler.RegisterRoutes(eventRouter)
+
+	// Seating planner
+	seatingStore := seating.NewStore(s.db)
+	seatingHandler := seating.NewHandler(seatingStore)
+	seatingHandler.RegisterRoutes(eventRouter)
 
 	// Tickets
 	ticketStore := tickets.NewStore(s.db)
 	ticketHandler := tickets.NewHandler(ticketStore)
-	ticketHandler.RegisterRoutes(subrouter)
+	ticketHandler.RegisterRoutes(eventRouter)
+
+	// Live check-in dashboard
+	checkinStore := checkins.NewStore(s.db)
+	checkinHandler := checkins.NewHandler(checkinStore)
+	checkinHandler.RegisterRoutes(eventRouter)
+
+	// Guest list and seating exports
+	exportStore := exports.NewStore(s.db)
+	exportHandler := exports.NewHandler(exportStore)
+	exportHandler.RegisterRoutes(eventRouter)
 
 	log.Println("Listening on port", s.addr)
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/diegob0/rspv_backend/internal/db"
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func main() {
+	eventID := flag.Int("event", 0, "ID of the event to import the guests into")
+	dryRun := flag.Bool("dry-run", false, "only validate the file")
+	createTables := flag.Bool("create-tables", false, "create tables that do not exist yet")
+	tableCapacity := flag.Int("table-capacity", 10, "capacity of the created tables")
+	flag.Parse()
+
+	if *eventID <= 0 || flag.NArg() != 1 {
+		log.Fatal("Usage: go run cmd/import/main.go -event <id> [-dry-run] [-create-tables] [-table-capacity 10] <guests.csv|guests.xlsx>")
+	}
+
+	path := flag.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("❌ Failed to open file:", err)
+	}
+	defer file.Close()
+
+	rows, err := guests.ParseGuestImport(path, file)
+	if err != nil {
+		log.Fatal("❌ Failed to read file:", err)
+	}
+
+	database, err := db.ConnectToDB()
+	if err != nil {
+		log.Fatal("❌ Failed to connect to DB:", err)
+	}
+	defer database.Close()
+
+	store := guests.NewStore(database)
+	report, err := store.ImportGuests(*eventID, rows, types.ImportOptions{
+		DryRun:        *dryRun,
+		CreateTables:  *createTables,
+		TableCapacity: *tableCapacity,
+	})
+	if err != nil {
+		log.Fatal("❌ Import failed:", err)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	os.Stdout.Write(append(out, '\n'))
+
+	switch {
+	case len(report.Errors) > 0 || len(report.Duplicates) > 0:
+		log.Printf("❌ %d errors and %d duplicates, nothing was imported", len(report.Errors), len(report.Duplicates))
+		os.Exit(1)
+	case report.DryRun:
+		log.Printf("✅ %d rows are valid, run without -dry-run to import them", report.ValidRows)
+	default:
+		log.Printf("✅ Imported %d guests", report.Created)
+	}
+}
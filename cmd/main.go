@@ -17,6 +17,9 @@
 // @tag.name users
 // @tag.description User management
 
+// @tag.name events
+// @tag.description Event management
+
 // @tag.name mesas
 // @tag.description Table management
 
@@ -28,6 +31,14 @@
 
 // @tag.name tickets
 // @tag.description Tickets management
+// @tag.name rsvp
+// @tag.description Public RSVP by invitation token
+// @tag.name seating
+// @tag.description Automatic seating planner
+// @tag.name constraints
+// @tag.description Seating constraints
+// @tag.name exports
+// @tag.description Guest list and seating exports
 package main
 
 import (
@@ -36,6 +47,7 @@ import (
 	"os"
 
 	"github.com/diegob0/rspv_backend/cmd/api"
+	"github.com/diegob0/rspv_backend/internal/config"
 	"github.com/diegob0/rspv_backend/internal/db"
 	"github.com/joho/godotenv"
 )
@@ -48,6 +60,13 @@ func main() {
 		port = "8080"
 	}
 
+	if err := config.CheckTicketSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+	if config.Envs.LegacyTicketCodes {
+		log.Println("⚠️ Unsigned ticket codes are accepted at the door, set TICKETS_LEGACY_CODES=false once every guest has a signed code")
+	}
+
 	fmt.Println("Hello World")
 	database, err := db.ConnectToDB()
 	if err != nil {
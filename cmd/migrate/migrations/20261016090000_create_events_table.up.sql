@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS events (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(250) NOT NULL,
+  event_date TIMESTAMPTZ NOT NULL,
+  venue VARCHAR(250) NOT NULL,
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  background_image VARCHAR(250) NOT NULL DEFAULT 'assets/Pase3.png',
+  text_color VARCHAR(7) NOT NULL DEFAULT '#FFFFFF',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS tickets_event_id_idx;
+DROP INDEX IF EXISTS guests_event_id_idx;
+DROP INDEX IF EXISTS tables_event_id_idx;
+DROP INDEX IF EXISTS generals_event_folio_key;
+
+ALTER TABLE tickets DROP COLUMN event_id;
+ALTER TABLE generals DROP COLUMN event_id;
+ALTER TABLE guests DROP COLUMN event_id;
+ALTER TABLE tables DROP COLUMN event_id;
@@ -0,0 +1,29 @@
+-- 1. Existing data is moved into a default event
+INSERT INTO events (name, event_date, venue)
+SELECT 'Default event', CURRENT_TIMESTAMP, ''
+WHERE EXISTS (SELECT 1 FROM tables)
+   OR EXISTS (SELECT 1 FROM guests)
+   OR EXISTS (SELECT 1 FROM generals);
+
+-- 2. Add event_id to every event scoped table
+ALTER TABLE tables ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE CASCADE;
+ALTER TABLE guests ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE CASCADE;
+ALTER TABLE generals ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE CASCADE;
+ALTER TABLE tickets ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE CASCADE;
+
+UPDATE tables SET event_id = (SELECT MIN(id) FROM events);
+UPDATE guests SET event_id = (SELECT MIN(id) FROM events);
+UPDATE generals SET event_id = (SELECT MIN(id) FROM events);
+UPDATE tickets SET event_id = (SELECT MIN(id) FROM events);
+
+ALTER TABLE tables ALTER COLUMN event_id SET NOT NULL;
+ALTER TABLE guests ALTER COLUMN event_id SET NOT NULL;
+ALTER TABLE generals ALTER COLUMN event_id SET NOT NULL;
+ALTER TABLE tickets ALTER COLUMN event_id SET NOT NULL;
+
+-- 3. Folios are numbered per event
+CREATE UNIQUE INDEX IF NOT EXISTS generals_event_folio_key ON generals (event_id, folio);
+
+CREATE INDEX IF NOT EXISTS tables_event_id_idx ON tables (event_id);
+CREATE INDEX IF NOT EXISTS guests_event_id_idx ON guests (event_id);
+CREATE INDEX IF NOT EXISTS tickets_event_id_idx ON tickets (event_id);
@@ -0,0 +1,8 @@
+-- Existing users keep full access
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'owner'
+CHECK (role IN ('owner', 'planner', 'door-staff', 'read-only'));
+
+-- New users start with the least privileged role
+ALTER TABLE users
+ALTER COLUMN role SET DEFAULT 'read-only';
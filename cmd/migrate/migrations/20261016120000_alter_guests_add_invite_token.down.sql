@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS guests_invite_token_key;
+
+ALTER TABLE guests
+DROP COLUMN IF EXISTS invite_token;
@@ -0,0 +1,12 @@
+ALTER TABLE guests
+ADD COLUMN invite_token VARCHAR(64);
+
+-- Existing guests get a random token, new ones get it from the API
+UPDATE guests
+SET invite_token = replace(gen_random_uuid()::text, '-', '')
+WHERE invite_token IS NULL;
+
+ALTER TABLE guests
+ALTER COLUMN invite_token SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS guests_invite_token_key ON guests (invite_token);
@@ -0,0 +1,14 @@
+ALTER TABLE events
+DROP COLUMN IF EXISTS rsvp_deadline;
+
+ALTER TABLE guests
+ADD COLUMN confirm_attendance BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE guests
+SET confirm_attendance = TRUE
+WHERE rsvp_status = 'accepted';
+
+ALTER TABLE guests
+DROP COLUMN rsvp_status,
+DROP COLUMN responded_at,
+DROP COLUMN rsvp_message;
@@ -0,0 +1,17 @@
+ALTER TABLE guests
+ADD COLUMN rsvp_status VARCHAR(10) NOT NULL DEFAULT 'pending'
+CHECK (rsvp_status IN ('pending', 'accepted', 'declined')),
+ADD COLUMN responded_at TIMESTAMPTZ,
+ADD COLUMN rsvp_message TEXT;
+
+-- A false confirm_attendance can mean either "no answer" or "no", so only
+-- confirmed guests can be carried over
+UPDATE guests
+SET rsvp_status = 'accepted'
+WHERE confirm_attendance = TRUE;
+
+ALTER TABLE guests
+DROP COLUMN confirm_attendance;
+
+ALTER TABLE events
+ADD COLUMN rsvp_deadline TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+ALTER TABLE tickets
+DROP COLUMN IF EXISTS companion_id;
+
+DROP TABLE IF EXISTS companions;
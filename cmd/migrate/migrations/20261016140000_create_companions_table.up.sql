@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS companions (
+  id SERIAL PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  guest_id INTEGER NOT NULL REFERENCES guests(id) ON DELETE CASCADE,
+  full_name VARCHAR(250) NOT NULL,
+  email VARCHAR(250),
+  notes TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS companions_guest_id_idx ON companions (guest_id);
+
+-- Tickets printed for a named companion point to them
+ALTER TABLE tickets
+ADD COLUMN companion_id INTEGER REFERENCES companions(id) ON DELETE SET NULL;
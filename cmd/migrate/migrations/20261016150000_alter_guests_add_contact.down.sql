@@ -0,0 +1,4 @@
+ALTER TABLE guests
+DROP COLUMN IF EXISTS email,
+DROP COLUMN IF EXISTS phone,
+DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,4 @@
+ALTER TABLE guests
+ADD COLUMN email VARCHAR(250),
+ADD COLUMN phone VARCHAR(50),
+ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
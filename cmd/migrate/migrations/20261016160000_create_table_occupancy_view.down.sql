@@ -0,0 +1,6 @@
+UPDATE tables t
+SET capacity = t.capacity - o.used_seats
+FROM table_occupancy o
+WHERE o.table_id = t.id;
+
+DROP VIEW IF EXISTS table_occupancy;
@@ -0,0 +1,12 @@
+-- Seats taken at each table, computed from its guests (plus additionals) and generals
+CREATE VIEW table_occupancy AS
+SELECT t.id AS table_id,
+       (COALESCE((SELECT SUM(1 + g.additionals) FROM guests g WHERE g.table_id = t.id), 0) +
+        COALESCE((SELECT COUNT(*) FROM generals ge WHERE ge.table_id = t.id), 0))::INT AS used_seats
+FROM tables t;
+
+-- tables.capacity held the seats left, turn it back into the total
+UPDATE tables t
+SET capacity = t.capacity + o.used_seats
+FROM table_occupancy o
+WHERE o.table_id = t.id;
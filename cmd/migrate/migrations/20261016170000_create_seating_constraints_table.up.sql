@@ -0,0 +1,15 @@
+-- together/apart apply to guest_ids, reserved keeps table_id for guests tagged with tag
+CREATE TABLE IF NOT EXISTS seating_constraints (
+  id SERIAL PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  kind VARCHAR(20) NOT NULL CHECK (kind IN ('together', 'apart', 'reserved')),
+  guest_ids INTEGER[] NOT NULL DEFAULT '{}',
+  table_id INTEGER REFERENCES tables(id) ON DELETE CASCADE,
+  tag TEXT,
+  strict BOOLEAN NOT NULL DEFAULT TRUE,
+  notes TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CHECK (kind <> 'reserved' OR (table_id IS NOT NULL AND tag IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS seating_constraints_event_id_idx ON seating_constraints (event_id);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS floor_fixtures;
+
+ALTER TABLE tables
+DROP COLUMN IF EXISTS pos_x,
+DROP COLUMN IF EXISTS pos_y,
+DROP COLUMN IF EXISTS shape,
+DROP COLUMN IF EXISTS width,
+DROP COLUMN IF EXISTS height,
+DROP COLUMN IF EXISTS rotation,
+DROP COLUMN IF EXISTS zone;
@@ -0,0 +1,25 @@
+-- Floor plan geometry in meters, x/y is the center of the table
+ALTER TABLE tables
+ADD COLUMN pos_x DOUBLE PRECISION,
+ADD COLUMN pos_y DOUBLE PRECISION,
+ADD COLUMN shape VARCHAR(20) NOT NULL DEFAULT 'round' CHECK (shape IN ('round', 'rectangle', 'square')),
+ADD COLUMN width DOUBLE PRECISION NOT NULL DEFAULT 1.8 CHECK (width > 0),
+ADD COLUMN height DOUBLE PRECISION NOT NULL DEFAULT 1.8 CHECK (height > 0),
+ADD COLUMN rotation DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN zone VARCHAR(100);
+
+-- Everything in the room that is not a table
+CREATE TABLE IF NOT EXISTS floor_fixtures (
+  id SERIAL PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  kind VARCHAR(30) NOT NULL CHECK (kind IN ('dance_floor', 'stage', 'bar', 'dj', 'entrance', 'buffet', 'other')),
+  label VARCHAR(100),
+  pos_x DOUBLE PRECISION NOT NULL,
+  pos_y DOUBLE PRECISION NOT NULL,
+  width DOUBLE PRECISION NOT NULL CHECK (width > 0),
+  height DOUBLE PRECISION NOT NULL CHECK (height > 0),
+  rotation DOUBLE PRECISION NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS floor_fixtures_event_id_idx ON floor_fixtures (event_id);
@@ -0,0 +1,14 @@
+-- One ticket layout per event, events without a row use the built-in layout.
+-- Sizes and positions are in millimeters, fields is a JSON array of text fields
+CREATE TABLE IF NOT EXISTS ticket_templates (
+  id SERIAL PRIMARY KEY,
+  event_id INTEGER NOT NULL UNIQUE REFERENCES events(id) ON DELETE CASCADE,
+  width DOUBLE PRECISION NOT NULL,
+  height DOUBLE PRECISION NOT NULL,
+  background TEXT,
+  qr_x DOUBLE PRECISION NOT NULL,
+  qr_y DOUBLE PRECISION NOT NULL,
+  qr_size DOUBLE PRECISION NOT NULL,
+  fields JSONB NOT NULL DEFAULT '[]',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
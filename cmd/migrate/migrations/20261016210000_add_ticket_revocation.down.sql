@@ -0,0 +1,18 @@
+DELETE FROM tickets WHERE type = 'named' AND guest_id IS NULL;
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_guest_id_fkey;
+ALTER TABLE tickets
+ADD CONSTRAINT tickets_guest_id_fkey FOREIGN KEY (guest_id) REFERENCES guests(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS tickets_guest_id_idx;
+
+DELETE FROM tickets WHERE status = 'revoked';
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_status_check;
+ALTER TABLE tickets ADD CONSTRAINT tickets_status_check CHECK (status IN ('active', 'used'));
+
+ALTER TABLE tickets
+DROP COLUMN IF EXISTS host,
+DROP COLUMN IF EXISTS withheld,
+DROP COLUMN IF EXISTS revoked_at,
+DROP COLUMN IF EXISTS revoke_reason;
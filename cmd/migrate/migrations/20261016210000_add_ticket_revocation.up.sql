@@ -0,0 +1,30 @@
+-- Tickets can be revoked with a reason, e.g. the ones left over when a guest's
+-- tickets are rebuilt with fewer people. They are kept instead of deleted, so
+-- a scan can tell them apart from a wrong code
+ALTER TABLE tickets
+ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS revoke_reason TEXT;
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_status_check;
+ALTER TABLE tickets ADD CONSTRAINT tickets_status_check CHECK (status IN ('active', 'used', 'revoked'));
+
+CREATE INDEX IF NOT EXISTS tickets_guest_id_idx ON tickets (guest_id);
+
+-- host marks the guest's own ticket, so a rebuild never hands it to a
+-- companion. withheld marks a ticket revoked without a replacement: rebuilds
+-- leave its holder without a ticket until one is asked for
+ALTER TABLE tickets
+ADD COLUMN IF NOT EXISTS host BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS withheld BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE tickets SET host = TRUE
+WHERE id IN (
+  SELECT MIN(id) FROM tickets
+  WHERE type = 'named' AND guest_id IS NOT NULL AND companion_id IS NULL
+  GROUP BY guest_id
+);
+
+-- Deleting a guest revokes their tickets instead of erasing them
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_guest_id_fkey;
+ALTER TABLE tickets
+ADD CONSTRAINT tickets_guest_id_fkey FOREIGN KEY (guest_id) REFERENCES guests(id) ON DELETE SET NULL;
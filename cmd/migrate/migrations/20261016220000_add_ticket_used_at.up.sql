@@ -0,0 +1,2 @@
+-- When a ticket was scanned, so a second scan can say since when it is used
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS used_at TIMESTAMPTZ;
@@ -0,0 +1,16 @@
+-- Every scan attempt, admitted or refused. Codes that match no ticket are kept
+-- too, ticket_id is NULL for them
+CREATE TABLE IF NOT EXISTS ticket_scans (
+  id BIGSERIAL PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  ticket_id INTEGER REFERENCES tickets(id) ON DELETE SET NULL,
+  code VARCHAR(100) NOT NULL,
+  result VARCHAR(20) NOT NULL CHECK (result IN ('admitted', 'duplicate', 'invalid', 'forged', 'revoked')),
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  device_id VARCHAR(100),
+  gate VARCHAR(100),
+  scanned_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ticket_scans_event_id_idx ON ticket_scans (event_id, scanned_at DESC);
+CREATE INDEX IF NOT EXISTS ticket_scans_ticket_id_idx ON ticket_scans (ticket_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS ticket_scans_offline_idx;
+
+ALTER TABLE ticket_scans
+DROP COLUMN IF EXISTS offline,
+DROP COLUMN IF EXISTS synced_at;
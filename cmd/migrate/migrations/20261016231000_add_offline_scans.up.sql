@@ -0,0 +1,9 @@
+-- Scans recorded by a disconnected scanner keep the device time in scanned_at
+-- and the upload time in synced_at
+ALTER TABLE ticket_scans
+ADD COLUMN IF NOT EXISTS offline BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ;
+
+-- A device uploading the same batch twice adds nothing
+CREATE UNIQUE INDEX IF NOT EXISTS ticket_scans_offline_idx
+ON ticket_scans (event_id, device_id, code, scanned_at) WHERE offline;
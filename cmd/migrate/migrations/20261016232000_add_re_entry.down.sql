@@ -0,0 +1,9 @@
+DELETE FROM ticket_scans WHERE result IN ('exited', 'reentered', 'undone');
+
+ALTER TABLE ticket_scans DROP CONSTRAINT IF EXISTS ticket_scans_result_check;
+ALTER TABLE ticket_scans ADD CONSTRAINT ticket_scans_result_check
+CHECK (result IN ('admitted', 'duplicate', 'invalid', 'forged', 'revoked'));
+ALTER TABLE ticket_scans DROP COLUMN IF EXISTS note;
+
+ALTER TABLE tickets DROP COLUMN IF EXISTS present;
+ALTER TABLE events DROP COLUMN IF EXISTS re_entry;
@@ -0,0 +1,13 @@
+-- With re_entry on, scanning a used ticket lets its holder out or back in.
+-- present is whether they are inside right now
+ALTER TABLE events ADD COLUMN IF NOT EXISTS re_entry BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS present BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE tickets SET present = TRUE WHERE status = 'used';
+
+-- Exits, re-entries and undone check-ins are logged with the rest of the scans.
+-- note keeps why a check-in was undone
+ALTER TABLE ticket_scans ADD COLUMN IF NOT EXISTS note VARCHAR(250);
+ALTER TABLE ticket_scans DROP CONSTRAINT IF EXISTS ticket_scans_result_check;
+ALTER TABLE ticket_scans ADD CONSTRAINT ticket_scans_result_check
+CHECK (result IN ('admitted', 'duplicate', 'invalid', 'forged', 'revoked', 'exited', 'reentered', 'undone'));
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/diegob0/rspv_backend/internal/db"
+	"github.com/diegob0/rspv_backend/internal/services/tables"
+)
+
+func main() {
+	eventID := flag.Int("event", 0, "ID of the event to check (default every event)")
+	fix := flag.Bool("fix", false, "raise the capacity of overbooked tables to fit everyone seated")
+	flag.Parse()
+
+	database, err := db.ConnectToDB()
+	if err != nil {
+		log.Fatal("❌ Failed to connect to DB:", err)
+	}
+	defer database.Close()
+
+	store := tables.NewStore(database)
+	mismatches, err := store.ReconcileTables(*eventID, *fix)
+	if err != nil {
+		log.Fatal("❌ Reconciliation failed:", err)
+	}
+
+	if len(mismatches) == 0 {
+		log.Println("✅ Every table fits the guests and generals seated at it")
+		return
+	}
+
+	out, _ := json.MarshalIndent(mismatches, "", "  ")
+	os.Stdout.Write(append(out, '\n'))
+
+	if *fix {
+		log.Printf("✅ Fixed the capacity of %d tables", len(mismatches))
+		return
+	}
+
+	log.Printf("❌ %d tables have more people than seats, run with -fix to raise their capacity", len(mismatches))
+	os.Exit(1)
+}
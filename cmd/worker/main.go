@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/diegob0/rspv_backend/internal/config"
 	"github.com/diegob0/rspv_backend/internal/db"
 	"github.com/diegob0/rspv_backend/internal/services/jobs"
 	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
@@ -22,6 +24,10 @@ import (
 func main() {
 	log.Println("Starting worker...")
 
+	if err := config.CheckTicketSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+
 	database, err := db.ConnectToDB()
 	if err != nil {
 		log.Fatalf("Failed to connect to DB: %v", err)
@@ -41,7 +47,7 @@ func main() {
 		cancel()
 	}()
 
-	jobQueues := []string{queue.QrJobQueue, queue.PdfJobQueue, queue.EmailJobQueue, queue.FullUploadQueue}
+	jobQueues := []string{queue.QrJobQueue, queue.PdfJobQueue, queue.EmailJobQueue, queue.FullUploadQueue, queue.TicketRebuildQueue}
 
 	var wg sync.WaitGroup
 	for _, queueName := range jobQueues {
@@ -181,6 +187,24 @@ func processJob(ctx context.Context, queueName, payload string, store *tickets.S
 			return jobs.UploadPDF(job.TicketID, pdfBytes, job.TicketType, store)
 		}, "FullUpload")
 
+		// Tickets of guests whose data changed after they were generated
+	case queue.TicketRebuildQueue:
+		var job queue.TicketRebuildJob
+		if err := json.Unmarshal([]byte(payload), &job); err != nil {
+			log.Printf("Failed to unmarshal TicketRebuild job: %v", err)
+			return
+		}
+		log.Printf("Processing TicketRebuild job for guest ID: %d", job.GuestID)
+
+		retry(ctx, int64(job.GuestID), func() error {
+			_, err := store.RebuildTickets(job.EventID, job.GuestID, job.RotateCodes, false)
+			if errors.Is(err, tickets.ErrTicketsNotGenerated) {
+				return nil
+			}
+
+			return err
+		}, "TicketRebuild")
+
 	}
 }
 
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
 
@@ -15,6 +16,14 @@ type Config struct {
 	DBName                 string
 	JWTExpirationInSeconds int64
 	JWTSecret              string
+	RefreshExpInSeconds    int64
+	RSVPBaseURL            string
+	RSVPNameLookup         bool
+	PDFFontRegular         string
+	PDFFontBold            string
+	AutoRebuildTickets     bool
+	TicketSigningKey       string
+	LegacyTicketCodes      bool
 }
 
 var Envs = initialConfig()
@@ -29,10 +38,29 @@ func initialConfig() Config {
 		DBPassword:             getEnv("DB_PASSWORD", "usuario"),
 		DBName:                 getEnv("DB_NAME", "usuario"),
 		JWTSecret:              getEnv("JWT_SECRET", "not_a_secret"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 3600*24*7),
+		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 60*15),
+		RefreshExpInSeconds:    getEnvAsInt("REFRESH_TOKEN_EXP", 3600*24*7),
+		RSVPBaseURL:            getEnv("RSVP_BASE_URL", "http://localhost:8080/rsvp/"),
+		RSVPNameLookup:         getEnvAsBool("RSVP_NAME_LOOKUP", true),
+		PDFFontRegular:         getEnv("PDF_FONT_REGULAR", ""),
+		PDFFontBold:            getEnv("PDF_FONT_BOLD", ""),
+		AutoRebuildTickets:     getEnvAsBool("TICKETS_AUTO_REBUILD", true),
+		TicketSigningKey:       getEnv("TICKET_SIGNING_KEY", ""),
+		LegacyTicketCodes:      getEnvAsBool("TICKETS_LEGACY_CODES", true),
 	}
 }
 
+// Anyone who knows the signing key can mint valid tickets, so the servers
+// refuse to start without one or with the placeholder
+func CheckTicketSigningKey() error {
+	switch Envs.TicketSigningKey {
+	case "", "not_a_secret":
+		return errors.New("TICKET_SIGNING_KEY must be set to a secret value")
+	}
+
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -53,3 +81,16 @@ func getEnvAsInt(key string, fallback int64) int64 {
 
 	return fallback
 }
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fallback
+		}
+
+		return b
+	}
+
+	return fallback
+}
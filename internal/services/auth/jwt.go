@@ -1,18 +1,45 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"strconv"
 	"time"
 
 	"github.com/diegob0/rspv_backend/internal/config"
+	"github.com/diegob0/rspv_backend/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func CreateJWT(secret []byte, userID int) (string, error) {
+// iat carries microseconds so a token issued right after a revocation, in
+// the same second, is still told apart from the ones it revoked
+func init() {
+	jwt.TimePrecision = time.Microsecond
+}
+
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Short lived access token with the standard sub/exp/iat/jti claims
+func CreateJWT(secret []byte, userID int, role string) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":    strconv.Itoa(userID),
-		"expiredAt": time.Now().Add(expiration).Unix(),
+	now := time.Now()
+
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
 	})
 
 	tokenString, err := token.SignedString(secret)
@@ -22,3 +49,90 @@ func CreateJWT(secret []byte, userID int) (string, error) {
 
 	return tokenString, nil
 }
+
+// Stream tokens only open the live check-ins of one event. EventSource sends
+// them in the URL, where they can end up in logs, so they expire quickly
+const StreamTokenTTL = time.Minute
+
+func streamAudience(eventID int) string {
+	return "checkins:stream:" + strconv.Itoa(eventID)
+}
+
+// Token for the check-in stream of the event, for browsers that can't send
+// the Authorization header
+func CreateStreamToken(secret []byte, userID int, role string, eventID int) (string, error) {
+	now := time.Now()
+
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{streamAudience(eventID)},
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(StreamTokenTTL)),
+		},
+	})
+
+	return token.SignedString(secret)
+}
+
+// Access tokens have no audience, so a stream token is never taken for one
+func ParseJWT(secret []byte, tokenString string) (*Claims, error) {
+	claims, err := parseClaims(secret, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Audience) > 0 {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
+	return claims, nil
+}
+
+func ParseStreamToken(secret []byte, tokenString string, eventID int) (*Claims, error) {
+	return parseClaims(secret, tokenString, jwt.WithAudience(streamAudience(eventID)))
+}
+
+func parseClaims(secret []byte, tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
+	opts = append(opts,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, opts...)
+	if err != nil || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	if claims.Subject == "" || claims.ID == "" || claims.Role == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// Opaque refresh token handed to the client. Only its hash is stored.
+func CreateRefreshToken() (token string, hash string, err error) {
+	token, err = utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte("secret")
+
+	t.Run("should parse a token created by CreateJWT", func(t *testing.T) {
+		token, err := CreateJWT(secret, 42, RolePlanner)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := ParseJWT(secret, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != "42" || claims.Role != RolePlanner || claims.ID == "" {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			Role: RoleOwner,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "1",
+				ID:        "jti",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+		}).SignedString(secret)
+
+		if _, err := ParseJWT(secret, token); err == nil {
+			t.Error("expected an error for an expired token")
+		}
+	})
+
+	t.Run("should reject a token signed with another secret", func(t *testing.T) {
+		token, _ := CreateJWT([]byte("other"), 1, RoleOwner)
+
+		if _, err := ParseJWT(secret, token); err == nil {
+			t.Error("expected an error for a bad signature")
+		}
+	})
+	t.Run("should not take a stream token as an access token", func(t *testing.T) {
+		token, err := CreateStreamToken(secret, 1, RoleOwner, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseJWT(secret, token); err == nil {
+			t.Error("expected an error for a stream token")
+		}
+	})
+}
+
+func TestParseStreamToken(t *testing.T) {
+	secret := []byte("secret")
+
+	t.Run("should only open the stream of its event", func(t *testing.T) {
+		token, err := CreateStreamToken(secret, 42, RoleReadOnly, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := ParseStreamToken(secret, token, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "42" || claims.Role != RoleReadOnly {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+
+		if _, err := ParseStreamToken(secret, token, 8); err == nil {
+			t.Error("expected an error for another event")
+		}
+	})
+
+	t.Run("should reject an access token", func(t *testing.T) {
+		token, _ := CreateJWT(secret, 1, RoleOwner)
+
+		if _, err := ParseStreamToken(secret, token, 7); err == nil {
+			t.Error("expected an error for an access token")
+		}
+	})
+}
+
+func TestIssuedBefore(t *testing.T) {
+	secret := []byte("secret")
+	parse := func() *Claims {
+		token, err := CreateJWT(secret, 42, RolePlanner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ParseJWT(secret, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+
+	before := parse()
+	time.Sleep(time.Millisecond)
+	revokedAt := time.Now().UnixMicro()
+	time.Sleep(time.Millisecond)
+	after := parse()
+
+	if !issuedBefore(before, revokedAt) {
+		t.Error("expected the token issued before the revocation to be revoked")
+	}
+	// Both tokens are usually issued in the same second as the revocation
+	if issuedBefore(after, revokedAt) {
+		t.Error("expected the token issued after the revocation to pass")
+	}
+}
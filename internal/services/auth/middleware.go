@@ -3,17 +3,21 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/diegob0/rspv_backend/internal/config"
-
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/diegob0/rspv_backend/internal/utils"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
 
+const RoleKey contextKey = "role"
+
+const ClaimsKey contextKey = "claims"
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -32,27 +36,73 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			tokenString = strings.TrimSpace(tokenString)
 		}
 
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Verify that the signing method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(config.Envs.JWTSecret), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := ParseJWT([]byte(config.Envs.JWTSecret), tokenString)
+		if err != nil {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		userID, ok := claims["userID"].(string)
+		serveAuthenticated(w, r, claims, next)
+	})
+}
 
-		if !ok || userID == "" {
-			http.Error(w, "Invalid token payload", http.StatusUnauthorized)
+// For the check-in stream, which a browser opens with EventSource and can't
+// send headers. Without the Authorization header the stream token for the
+// event is taken from the token query parameter
+func StreamAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			AuthMiddleware(next).ServeHTTP(w, r)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		tokenString := r.URL.Query().Get("token")
+		if tokenString == "" {
+			http.Error(w, "Missing Authorization header or stream token", http.StatusUnauthorized)
+			return
+		}
+
+		eventID, err := utils.ParseEventID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		claims, err := ParseStreamToken([]byte(config.Envs.JWTSecret), tokenString, eventID)
+		if err != nil {
+			http.Error(w, "Invalid or expired stream token", http.StatusUnauthorized)
+			return
+		}
+
+		serveAuthenticated(w, r, claims, next)
 	})
 }
+
+func serveAuthenticated(w http.ResponseWriter, r *http.Request, claims *Claims, next http.Handler) {
+	// Fail closed, a lost device must not get through while Redis is down
+	revoked, err := isRevoked(r.Context(), claims)
+	if err != nil {
+		http.Error(w, "Unable to verify token", http.StatusServiceUnavailable)
+		return
+	}
+	if revoked {
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, claims.Subject)
+	ctx = context.WithValue(ctx, RoleKey, claims.Role)
+	ctx = context.WithValue(ctx, ClaimsKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Id of the authenticated user, false outside AuthMiddleware
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	subject, _ := ctx.Value(UserIDKey).(string)
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/config"
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys for the revocation list
+const (
+	revokedTokenPrefix = "revoked_jti:"
+	revokedUserPrefix  = "revoked_user_at:"
+)
+
+// Revokes a single access token until it would have expired anyway
+func RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return queue.RedisClient().Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+// Revokes every access token issued to the user up to now, in microseconds
+// like iat. The key only has to outlive the longest possible access token.
+func RevokeUserTokens(ctx context.Context, userID int) error {
+	ttl := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
+	key := revokedUserPrefix + strconv.Itoa(userID)
+
+	return queue.RedisClient().Set(ctx, key, time.Now().UnixMicro(), ttl).Err()
+}
+
+func isRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	client := queue.RedisClient()
+
+	n, err := client.Exists(ctx, revokedTokenPrefix+claims.ID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+
+	revokedAt, err := client.Get(ctx, revokedUserPrefix+claims.Subject).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	return issuedBefore(claims, revokedAt), nil
+}
+
+// iat goes through a float and can come back a microsecond early, so only a
+// token issued in the microsecond right after the revocation is wrongly caught
+func issuedBefore(claims *Claims, revokedAt int64) bool {
+	return claims.IssuedAt.UnixMicro() <= revokedAt
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/diegob0/rspv_backend/internal/utils"
+)
+
+// Roles stored in users.role
+const (
+	RoleOwner     = "owner"
+	RolePlanner   = "planner"
+	RoleDoorStaff = "door-staff"
+	RoleReadOnly  = "read-only"
+)
+
+type Permission string
+
+const (
+	// Read guests, tables, generals, tickets and events
+	PermRead Permission = "read"
+	// Create, update, delete and assign guests, tables, generals and tickets
+	PermWrite Permission = "write"
+	// Scan tickets at the door
+	PermScan Permission = "scan"
+	// Create, update and delete events
+	PermManageEvents Permission = "manage-events"
+	// Create, update and delete users
+	PermManageUsers Permission = "manage-users"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:     {PermRead, PermWrite, PermScan, PermManageEvents, PermManageUsers},
+	RolePlanner:   {PermRead, PermWrite, PermScan},
+	RoleDoorStaff: {PermScan},
+	RoleReadOnly:  {PermRead},
+}
+
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Wraps a handler so only roles holding the permission can reach it.
+// Must run behind AuthMiddleware, which puts the role in the context.
+func RequirePermission(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(RoleKey).(string)
+
+		if !HasPermission(role, perm) {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("role %q is not allowed to perform this action", role))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	okHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	cases := []struct {
+		name     string
+		role     string
+		perm     Permission
+		expected int
+	}{
+		{"owner can manage users", RoleOwner, PermManageUsers, http.StatusOK},
+		{"planner can write", RolePlanner, PermWrite, http.StatusOK},
+		{"planner cannot manage users", RolePlanner, PermManageUsers, http.StatusForbidden},
+		{"door staff can scan", RoleDoorStaff, PermScan, http.StatusOK},
+		{"door staff cannot read", RoleDoorStaff, PermRead, http.StatusForbidden},
+		{"read only can read", RoleReadOnly, PermRead, http.StatusOK},
+		{"read only cannot write", RoleReadOnly, PermWrite, http.StatusForbidden},
+		{"missing role is rejected", "", PermRead, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), RoleKey, c.role))
+
+			rr := httptest.NewRecorder()
+			RequirePermission(c.perm, okHandler)(rr, req)
+
+			if rr.Code != c.expected {
+				t.Errorf("expected status code %d, got %d", c.expected, rr.Code)
+			}
+		})
+	}
+}
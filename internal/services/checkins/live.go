@@ -0,0 +1,74 @@
+package checkins
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// Admissions go through Redis pub/sub so a scan on any API instance reaches the
+// dashboards connected to every other one
+func channel(eventID int) string {
+	return "checkins:" + strconv.Itoa(eventID)
+}
+
+// Events waiting for Redis. Scans only queue them, so a slow or unreachable
+// Redis never holds up the door; past this many the newest are dropped
+const publishBuffer = 1024
+
+var (
+	outbox       = make(chan types.CheckInEvent, publishBuffer)
+	startPublish sync.Once
+)
+
+// Tells the dashboards about an admission. The guest is already in, so it
+// never waits for Redis and a failure is only logged
+func Publish(event types.CheckInEvent) {
+	startPublish.Do(func() { go publishLoop() })
+
+	select {
+	case outbox <- event:
+	default:
+		log.Printf("dropped check-in of ticket %d, the publish queue is full", event.TicketID)
+	}
+}
+
+func publishLoop() {
+	for event := range outbox {
+		publish(event)
+	}
+}
+
+func publish(event types.CheckInEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to encode check-in of ticket %d: %v", event.TicketID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := queue.RedisClient().Publish(ctx, channel(event.EventID), payload).Err(); err != nil {
+		log.Printf("failed to publish check-in of ticket %d: %v", event.TicketID, err)
+	}
+}
+
+// Subscribes to the admissions of the event. It returns once Redis confirmed
+// the subscription, so nothing published afterwards is missed
+func subscribe(ctx context.Context, eventID int) (*redis.PubSub, error) {
+	sub := queue.RedisClient().Subscribe(ctx, channel(eventID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,208 @@
+package checkins
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/config"
+	"github.com/diegob0/rspv_backend/internal/services/auth"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+// Keeps proxies from closing an idle stream
+const heartbeatInterval = 25 * time.Second
+
+// Totals are sent again at most this often while scans keep coming
+const totalsInterval = time.Second
+
+type Handler struct {
+	store types.CheckInStore
+}
+
+func NewHandler(store types.CheckInStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// EventSource can't send the Authorization header, the stream also takes
+	// a stream token in the query
+	router.Handle("/checkins/stream", auth.StreamAuthMiddleware(auth.RequirePermission(auth.PermRead, h.handleStream))).Methods(http.MethodGet)
+
+	protected := router.PathPrefix("/checkins").Subrouter()
+	protected.Use(auth.AuthMiddleware)
+
+	protected.HandleFunc("", auth.RequirePermission(auth.PermRead, h.handleGetTotals)).Methods(http.MethodGet)
+	protected.HandleFunc("/stream-token", auth.RequirePermission(auth.PermRead, h.handleStreamToken)).Methods(http.MethodPost)
+}
+
+// @Summary Check-in totals
+// @Description Arrived against expected tickets, overall, named vs general and per table
+// @Tags checkins
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.CheckInTotals
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/checkins [get]
+func (h *Handler) handleGetTotals(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	totals, err := h.store.GetCheckInTotals(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, totals)
+}
+
+// @Summary Stream token
+// @Description Short lived token that opens the live check-ins of the event, for EventSource: pass it as ?token= to the stream. It is only checked on connect, ask for a new one to reconnect
+// @Tags checkins
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.StreamTokenResponse
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 401 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/checkins/stream-token [post]
+func (h *Handler) handleStreamToken(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.ClaimsKey).(*auth.Claims)
+	userID, idOK := auth.UserIDFromContext(r.Context())
+	if !ok || !idOK {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("missing token claims"))
+		return
+	}
+
+	token, err := auth.CreateStreamToken([]byte(config.Envs.JWTSecret), userID, claims.Role, eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.StreamTokenResponse{
+		Token:     token,
+		ExpiresIn: int64(auth.StreamTokenTTL.Seconds()),
+	})
+}
+
+// @Summary Live check-ins
+// @Description Server-Sent Events stream. Takes the Authorization header, or a stream token in ?token= for EventSource. Sends a "totals" event on connect and after scans (at most once a second), and a "checkin" event with the guest, table and gate for every admission on any API instance.
+// @Tags checkins
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param eventId path int true "Event ID"
+// @Param token query string false "Stream token, instead of the Authorization header"
+// @Success 200 {object} types.CheckInEvent
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/checkins/stream [get]
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Subscribed before reading the totals, so no scan falls in between
+	sub, err := subscribe(ctx, eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to subscribe to check-ins: %w", err))
+		return
+	}
+	defer sub.Close()
+
+	totals, err := h.store.GetCheckInTotals(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeEvent(w, "totals", totals); err != nil {
+		return
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	messages := sub.Channel()
+	var refresh <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: checkin\ndata: %s\n\n", msg.Payload); err != nil {
+				return
+			}
+			if refresh == nil {
+				refresh = time.After(totalsInterval)
+			}
+
+		case <-refresh:
+			refresh = nil
+			totals, err := h.store.GetCheckInTotals(eventID)
+			if err != nil {
+				log.Printf("failed to refresh check-in totals for event %d: %v", eventID, err)
+				continue
+			}
+			if err := writeEvent(w, "totals", totals); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// One Server-Sent Event with a JSON payload
+func writeEvent(w io.Writer, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
@@ -0,0 +1,102 @@
+package checkins
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Tickets of one type at one table
+type ticketGroup struct {
+	ticketType string
+	tableID    *int
+	tableName  *string
+	arrived    int
+	expected   int
+	present    int
+}
+
+func (s *Store) GetCheckInTotals(eventID int) (*types.CheckInTotals, error) {
+	rows, err := s.db.Query(`
+		SELECT t.type, tb.id, tb.name,
+		       COUNT(*) FILTER (WHERE t.status = 'used'), COUNT(*), COUNT(*) FILTER (WHERE t.present)
+		FROM tickets t
+		LEFT JOIN guests g ON g.id = t.guest_id
+		LEFT JOIN generals ge ON ge.id = t.general_id
+		LEFT JOIN tables tb ON tb.id = COALESCE(g.table_id, ge.table_id)
+		WHERE t.event_id = $1 AND t.status <> 'revoked'
+		GROUP BY t.type, tb.id, tb.name
+		ORDER BY tb.name NULLS LAST, tb.id
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count check-ins: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]ticketGroup, 0)
+	for rows.Next() {
+		var g ticketGroup
+		if err := rows.Scan(&g.ticketType, &g.tableID, &g.tableName, &g.arrived, &g.expected, &g.present); err != nil {
+			return nil, fmt.Errorf("failed to scan check-ins: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sumCheckIns(groups), nil
+}
+
+// Adds the groups up per type and per table, keeping the table order
+func sumCheckIns(groups []ticketGroup) *types.CheckInTotals {
+	totals := &types.CheckInTotals{Tables: make([]types.TableCheckIns, 0)}
+	tables := make(map[int]int)
+	unassigned := -1
+
+	for _, g := range groups {
+		totals.Arrived += g.arrived
+		totals.Expected += g.expected
+		totals.Present += g.present
+
+		count := &totals.General
+		if g.ticketType == "named" {
+			count = &totals.Named
+		}
+		count.Arrived += g.arrived
+		count.Expected += g.expected
+		count.Present += g.present
+
+		var idx int
+		var ok bool
+		if g.tableID == nil {
+			idx, ok = unassigned, unassigned >= 0
+		} else {
+			idx, ok = tables[*g.tableID]
+		}
+		if !ok {
+			idx = len(totals.Tables)
+			totals.Tables = append(totals.Tables, types.TableCheckIns{TableID: g.tableID, TableName: g.tableName})
+			if g.tableID == nil {
+				unassigned = idx
+			} else {
+				tables[*g.tableID] = idx
+			}
+		}
+
+		totals.Tables[idx].Arrived += g.arrived
+		totals.Tables[idx].Expected += g.expected
+		totals.Tables[idx].Present += g.present
+	}
+
+	return totals
+}
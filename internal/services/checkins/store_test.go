@@ -0,0 +1,86 @@
+package checkins
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestSumCheckIns(t *testing.T) {
+	one, two := 1, 2
+	mesa1, mesa2 := "Mesa 1", "Mesa 2"
+
+	t.Run("should add up types and tables", func(t *testing.T) {
+		totals := sumCheckIns([]ticketGroup{
+			{ticketType: "named", tableID: &one, tableName: &mesa1, arrived: 3, expected: 8},
+			{ticketType: "general", tableID: &one, tableName: &mesa1, arrived: 1, expected: 2},
+			{ticketType: "named", tableID: &two, tableName: &mesa2, arrived: 0, expected: 6},
+			{ticketType: "named", arrived: 2, expected: 4},
+			{ticketType: "general", arrived: 1, expected: 5},
+		})
+
+		if totals.Arrived != 7 || totals.Expected != 25 {
+			t.Errorf("expected 7 of 25, got %d of %d", totals.Arrived, totals.Expected)
+		}
+		if totals.Named.Arrived != 5 || totals.Named.Expected != 18 {
+			t.Errorf("expected 5 of 18 named, got %+v", totals.Named)
+		}
+		if totals.General.Arrived != 2 || totals.General.Expected != 7 {
+			t.Errorf("expected 2 of 7 general, got %+v", totals.General)
+		}
+
+		if len(totals.Tables) != 3 {
+			t.Fatalf("expected 3 tables, got %d", len(totals.Tables))
+		}
+		if totals.Tables[0].TableID == nil || *totals.Tables[0].TableID != 1 || totals.Tables[0].Arrived != 4 || totals.Tables[0].Expected != 10 {
+			t.Errorf("unexpected first table %+v", totals.Tables[0])
+		}
+		if totals.Tables[2].TableID != nil || totals.Tables[2].Arrived != 3 || totals.Tables[2].Expected != 9 {
+			t.Errorf("expected the unassigned tickets last, got %+v", totals.Tables[2])
+		}
+	})
+
+	t.Run("should return empty tables for an event without tickets", func(t *testing.T) {
+		totals := sumCheckIns(nil)
+		if totals.Tables == nil || totals.Expected != 0 {
+			t.Errorf("unexpected totals %+v", totals)
+		}
+	})
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEvent(&buf, "totals", map[string]int{"arrived": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: totals\ndata: {\"arrived\":1}\n\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestPublish(t *testing.T) {
+	// No publisher draining the queue, as if Redis hung
+	startPublish.Do(func() {})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= publishBuffer; i++ {
+			Publish(types.CheckInEvent{EventID: 1, TicketID: i})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Publish not to wait for Redis")
+	}
+
+	if len(outbox) != publishBuffer {
+		t.Errorf("expected %d queued check-ins, got %d", publishBuffer, len(outbox))
+	}
+}
@@ -0,0 +1,298 @@
+package constraints
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+// Who sits where, the input of Evaluate
+type Seating struct {
+	// Table of each seated guest
+	Guests map[int]int
+	Tags   map[int][]string
+	// Table of each seated general
+	Generals map[int]int
+}
+
+func NewSeating() *Seating {
+	return &Seating{
+		Guests:   map[int]int{},
+		Tags:     map[int][]string{},
+		Generals: map[int]int{},
+	}
+}
+
+// Lists every rule the seating breaks
+func Evaluate(constraints []types.SeatingConstraint, seating *Seating) []types.ConstraintViolation {
+	violations := make([]types.ConstraintViolation, 0)
+
+	for _, c := range constraints {
+		switch c.Kind {
+		case types.ConstraintTogether:
+			byTable := groupByTable(c.GuestIDs, seating)
+			if len(byTable) < 2 {
+				continue
+			}
+
+			guestIDs := make([]int, 0)
+			for _, ids := range byTable {
+				guestIDs = append(guestIDs, ids...)
+			}
+			sort.Ints(guestIDs)
+			tableIDs := sortedKeys(byTable)
+
+			violations = append(violations, violation(c, tableIDs, guestIDs, nil,
+				fmt.Sprintf("guests %v must sit together but are at tables %v", guestIDs, tableIDs)))
+
+		case types.ConstraintApart:
+			byTable := groupByTable(c.GuestIDs, seating)
+			for _, tableID := range sortedKeys(byTable) {
+				guestIDs := byTable[tableID]
+				if len(guestIDs) < 2 {
+					continue
+				}
+
+				violations = append(violations, violation(c, []int{tableID}, guestIDs, nil,
+					fmt.Sprintf("guests %v must not sit together but share table %d", guestIDs, tableID)))
+			}
+
+		case types.ConstraintReserved:
+			if c.TableID == nil || c.Tag == nil {
+				continue
+			}
+
+			guestIDs := make([]int, 0)
+			for guestID, tableID := range seating.Guests {
+				if tableID == *c.TableID && !slices.Contains(seating.Tags[guestID], *c.Tag) {
+					guestIDs = append(guestIDs, guestID)
+				}
+			}
+			generalIDs := make([]int, 0)
+			for generalID, tableID := range seating.Generals {
+				if tableID == *c.TableID {
+					generalIDs = append(generalIDs, generalID)
+				}
+			}
+			if len(guestIDs) == 0 && len(generalIDs) == 0 {
+				continue
+			}
+			sort.Ints(guestIDs)
+			sort.Ints(generalIDs)
+
+			violations = append(violations, violation(c, []int{*c.TableID}, guestIDs, generalIDs,
+				fmt.Sprintf("table %d is reserved for %q", *c.TableID, *c.Tag)))
+		}
+	}
+
+	return violations
+}
+
+// Checks the rules a guest would break by sitting at tableID. Breaking a
+// strict rule returns a *types.ConstraintConflict, the rest are warnings.
+func CheckGuestTx(tx *sql.Tx, eventID int, guestID int, tableID int) ([]types.ConstraintViolation, error) {
+	constraints, err := queryConstraints(tx, `
+		SELECT id, kind, guest_ids, table_id, tag, strict, notes, created_at
+		FROM seating_constraints
+		WHERE event_id = $1 AND ($2 = ANY(guest_ids) OR (kind = 'reserved' AND table_id = $3))
+		ORDER BY id
+	`, eventID, guestID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	if len(constraints) == 0 {
+		return []types.ConstraintViolation{}, nil
+	}
+
+	// Only the guests named in those rules matter
+	guestIDs := []int64{int64(guestID)}
+	for _, c := range constraints {
+		for _, id := range c.GuestIDs {
+			guestIDs = append(guestIDs, int64(id))
+		}
+	}
+
+	seating := NewSeating()
+	rows, err := tx.Query(`
+		SELECT id, table_id, tags FROM guests WHERE event_id = $1 AND id = ANY($2)
+	`, eventID, pq.Array(guestIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var table sql.NullInt64
+		var tags []string
+		if err := rows.Scan(&id, &table, pq.Array(&tags)); err != nil {
+			return nil, err
+		}
+		if table.Valid {
+			seating.Guests[id] = int(table.Int64)
+		}
+		seating.Tags[id] = tags
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seating.Guests[guestID] = tableID
+
+	return split(Evaluate(constraints, seating), func(v types.ConstraintViolation) bool {
+		return slices.Contains(v.GuestIDs, guestID)
+	})
+}
+
+// Checks the rules a general would break by sitting at tableID, generals
+// have no tags so only reserved tables apply
+func CheckGeneralTx(tx *sql.Tx, eventID int, generalID int, tableID int) ([]types.ConstraintViolation, error) {
+	constraints, err := queryConstraints(tx, `
+		SELECT id, kind, guest_ids, table_id, tag, strict, notes, created_at
+		FROM seating_constraints
+		WHERE event_id = $1 AND kind = 'reserved' AND table_id = $2
+		ORDER BY id
+	`, eventID, tableID)
+	if err != nil {
+		return nil, err
+	}
+	if len(constraints) == 0 {
+		return []types.ConstraintViolation{}, nil
+	}
+
+	seating := NewSeating()
+	seating.Generals[generalID] = tableID
+
+	return split(Evaluate(constraints, seating), func(v types.ConstraintViolation) bool {
+		return slices.Contains(v.GeneralIDs, generalID)
+	})
+}
+
+// The reserved tables of the event, the only rules a guest that does not
+// exist yet can break
+func ReservedTablesTx(tx *sql.Tx, eventID int) ([]types.SeatingConstraint, error) {
+	return queryConstraints(tx, `
+		SELECT id, kind, guest_ids, table_id, tag, strict, notes, created_at
+		FROM seating_constraints
+		WHERE event_id = $1 AND kind = 'reserved'
+		ORDER BY id
+	`, eventID)
+}
+
+// Checks the reserved tables a new guest with these tags would break by
+// sitting at tableID, e.g. a row of an import. Strict ones are returned as a
+// *types.ConstraintConflict like CheckGuestTx
+func CheckNewGuest(reserved []types.SeatingConstraint, tags []string, tableID int) ([]types.ConstraintViolation, error) {
+	seating := NewSeating()
+	seating.Guests[0] = tableID
+	seating.Tags[0] = tags
+
+	return split(Evaluate(reserved, seating), func(v types.ConstraintViolation) bool {
+		return slices.Contains(v.GuestIDs, 0)
+	})
+}
+
+// Keeps the violations that concern the assignment, strict ones turn into an error
+func split(violations []types.ConstraintViolation, concerns func(types.ConstraintViolation) bool) ([]types.ConstraintViolation, error) {
+	warnings := make([]types.ConstraintViolation, 0)
+	conflict := &types.ConstraintConflict{}
+
+	for _, v := range violations {
+		if !concerns(v) {
+			continue
+		}
+		if v.Strict {
+			conflict.Violations = append(conflict.Violations, v)
+		} else {
+			warnings = append(warnings, v)
+		}
+	}
+
+	if len(conflict.Violations) > 0 {
+		return nil, conflict
+	}
+
+	return warnings, nil
+}
+
+// Drops repeated violations. An apart rule can be broken at several tables,
+// so a violation is the rule together with the tables it is broken at.
+func Dedupe(violations []types.ConstraintViolation) []types.ConstraintViolation {
+	unique := make([]types.ConstraintViolation, 0, len(violations))
+	seen := make(map[string]bool)
+	for _, v := range violations {
+		key := fmt.Sprint(v.ConstraintID, v.TableIDs)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryConstraints(q querier, query string, args ...any) ([]types.SeatingConstraint, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch constraints: %w", err)
+	}
+	defer rows.Close()
+
+	constraints := make([]types.SeatingConstraint, 0)
+	for rows.Next() {
+		var c types.SeatingConstraint
+		var guestIDs pq.Int64Array
+		if err := rows.Scan(&c.ID, &c.Kind, &guestIDs, &c.TableID, &c.Tag, &c.Strict, &c.Notes, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		c.GuestIDs = make([]int, 0, len(guestIDs))
+		for _, id := range guestIDs {
+			c.GuestIDs = append(c.GuestIDs, int(id))
+		}
+		constraints = append(constraints, c)
+	}
+
+	return constraints, rows.Err()
+}
+
+func violation(c types.SeatingConstraint, tableIDs, guestIDs, generalIDs []int, message string) types.ConstraintViolation {
+	return types.ConstraintViolation{
+		ConstraintID: c.ID,
+		Kind:         c.Kind,
+		Strict:       c.Strict,
+		TableIDs:     tableIDs,
+		GuestIDs:     guestIDs,
+		GeneralIDs:   generalIDs,
+		Message:      message,
+	}
+}
+
+func groupByTable(guestIDs []int, seating *Seating) map[int][]int {
+	byTable := make(map[int][]int)
+	for _, id := range guestIDs {
+		if tableID, ok := seating.Guests[id]; ok {
+			byTable[tableID] = append(byTable[tableID], id)
+		}
+	}
+
+	return byTable
+}
+
+func sortedKeys(m map[int][]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
@@ -0,0 +1,114 @@
+package constraints
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestEvaluate(t *testing.T) {
+	tableID := 3
+	tag := "familia"
+	constraints := []types.SeatingConstraint{
+		{ID: 1, Kind: types.ConstraintTogether, GuestIDs: []int{1, 2, 5}, Strict: true},
+		{ID: 2, Kind: types.ConstraintApart, GuestIDs: []int{3, 4}},
+		{ID: 3, Kind: types.ConstraintReserved, TableID: &tableID, Tag: &tag, Strict: true},
+	}
+
+	t.Run("should accept a seating that follows every rule", func(t *testing.T) {
+		seating := NewSeating()
+		seating.Guests = map[int]int{1: 1, 2: 1, 3: 3, 4: 2}
+		seating.Tags = map[int][]string{3: {"familia"}}
+
+		if violations := Evaluate(constraints, seating); len(violations) != 0 {
+			t.Errorf("unexpected violations %+v", violations)
+		}
+	})
+
+	t.Run("should report every broken rule", func(t *testing.T) {
+		seating := NewSeating()
+		seating.Guests = map[int]int{1: 1, 2: 2, 3: 3, 4: 3}
+		seating.Tags = map[int][]string{3: {"familia"}}
+		seating.Generals = map[int]int{7: 3}
+
+		violations := Evaluate(constraints, seating)
+		if len(violations) != 3 {
+			t.Fatalf("expected 3 violations, got %+v", violations)
+		}
+
+		if v := violations[0]; v.ConstraintID != 1 || len(v.TableIDs) != 2 || !v.Strict {
+			t.Errorf("unexpected together violation %+v", v)
+		}
+		if v := violations[1]; v.ConstraintID != 2 || len(v.GuestIDs) != 2 || v.Strict {
+			t.Errorf("unexpected apart violation %+v", v)
+		}
+		if v := violations[2]; v.ConstraintID != 3 || len(v.GuestIDs) != 1 || v.GuestIDs[0] != 4 || len(v.GeneralIDs) != 1 {
+			t.Errorf("unexpected reserved violation %+v", v)
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	violations := []types.ConstraintViolation{
+		{ConstraintID: 1, GuestIDs: []int{1, 2}},
+		{ConstraintID: 2, GuestIDs: []int{3, 4}, Strict: true},
+	}
+	concerns := func(id int) func(types.ConstraintViolation) bool {
+		return func(v types.ConstraintViolation) bool {
+			return slices.Contains(v.GuestIDs, id)
+		}
+	}
+
+	warnings, err := split(violations, concerns(1))
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("expected a warning, got %+v %v", warnings, err)
+	}
+
+	if _, err := split(violations, concerns(3)); err == nil {
+		t.Error("expected a conflict")
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	violations := []types.ConstraintViolation{
+		{ConstraintID: 1, TableIDs: []int{1, 2}},
+		{ConstraintID: 2, TableIDs: []int{3}},
+		{ConstraintID: 2, TableIDs: []int{4}},
+		{ConstraintID: 1, TableIDs: []int{1, 2}},
+		{ConstraintID: 2, TableIDs: []int{3}},
+	}
+
+	unique := Dedupe(violations)
+	if len(unique) != 3 {
+		t.Fatalf("expected 3 violations, got %+v", unique)
+	}
+	if unique[1].TableIDs[0] != 3 || unique[2].TableIDs[0] != 4 {
+		t.Errorf("expected the apart rule at both tables, got %+v", unique)
+	}
+}
+
+func TestCheckNewGuest(t *testing.T) {
+	tableID := 3
+	tag := "familia"
+	reserved := []types.SeatingConstraint{{ID: 1, Kind: types.ConstraintReserved, TableID: &tableID, Tag: &tag, Strict: true}}
+
+	t.Run("should let a tagged guest sit at a reserved table", func(t *testing.T) {
+		if _, err := CheckNewGuest(reserved, []string{"familia"}, 3); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := CheckNewGuest(reserved, nil, 2); err != nil {
+			t.Errorf("unexpected error at another table %v", err)
+		}
+	})
+
+	t.Run("should refuse a guest without the tag", func(t *testing.T) {
+		_, err := CheckNewGuest(reserved, []string{"amigos"}, 3)
+
+		var conflict *types.ConstraintConflict
+		if !errors.As(err, &conflict) || len(conflict.Violations) != 1 {
+			t.Errorf("expected a conflict, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package constraints
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/diegob0/rspv_backend/internal/services/auth"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.ConstraintStore
+}
+
+func NewHandler(store types.ConstraintStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Protected routes
+	protected := router.PathPrefix("/constraints").Subrouter()
+	protected.Use(auth.AuthMiddleware)
+
+	protected.HandleFunc("", auth.RequirePermission(auth.PermRead, h.handleGetConstraints)).Methods(http.MethodGet)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermWrite, h.handleCreateConstraint)).Methods(http.MethodPost)
+	protected.HandleFunc("/violations", auth.RequirePermission(auth.PermRead, h.handleGetViolations)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id:[0-9]+}", auth.RequirePermission(auth.PermWrite, h.handleDeleteConstraint)).Methods(http.MethodDelete)
+}
+
+// @Summary Get the seating constraints
+// @Description Returns every together, apart and reserved table rule of the event
+// @Tags constraints
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {array} types.SeatingConstraint
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/constraints [get]
+func (h *Handler) handleGetConstraints(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	constraints, err := h.store.GetConstraints(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, constraints)
+}
+
+// @Summary Create a seating constraint
+// @Description "together" and "apart" take two or more guestIds, "reserved" takes a tableId and the tag of the guests allowed at it. Strict rules (the default) block assignments, the others only warn.
+// @Tags constraints
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.CreateConstraintPayload true "Constraint"
+// @Success 201 {object} types.SeatingConstraint
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/constraints [post]
+func (h *Handler) handleCreateConstraint(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.CreateConstraintPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	constraint := types.SeatingConstraint{
+		Kind:   payload.Kind,
+		Strict: true,
+		Notes:  payload.Notes,
+	}
+	if payload.Strict != nil {
+		constraint.Strict = *payload.Strict
+	}
+
+	// Each kind takes different fields
+	if payload.Kind == types.ConstraintReserved {
+		if payload.TableID == nil || payload.Tag == nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a reserved table needs tableId and tag"))
+			return
+		}
+		constraint.TableID = payload.TableID
+		constraint.Tag = payload.Tag
+	} else {
+		constraint.GuestIDs = payload.GuestIDs
+		distinct := make(map[int]bool)
+		for _, id := range payload.GuestIDs {
+			distinct[id] = true
+		}
+		if len(distinct) < 2 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s needs at least two different guestIds", payload.Kind))
+			return
+		}
+	}
+
+	created, err := h.store.CreateConstraint(eventID, constraint)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+// @Summary Delete a seating constraint
+// @Tags constraints
+// @Security BearerAuth
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Constraint ID"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Router /events/{eventId}/constraints/{id} [delete]
+func (h *Handler) handleDeleteConstraint(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid constraint id"))
+		return
+	}
+
+	if err := h.store.DeleteConstraint(eventID, id); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// @Summary Get the seating violations
+// @Description Lists every current seating that breaks a constraint, strict or not
+// @Tags constraints
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {array} types.ConstraintViolation
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/constraints/violations [get]
+func (h *Handler) handleGetViolations(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	violations, err := h.store.GetViolations(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, violations)
+}
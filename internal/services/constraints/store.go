@@ -0,0 +1,146 @@
+package constraints
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetConstraints(eventID int) ([]types.SeatingConstraint, error) {
+	return queryConstraints(s.db, `
+		SELECT id, kind, guest_ids, table_id, tag, strict, notes, created_at
+		FROM seating_constraints
+		WHERE event_id = $1
+		ORDER BY id
+	`, eventID)
+}
+
+func (s *Store) CreateConstraint(eventID int, c types.SeatingConstraint) (*types.SeatingConstraint, error) {
+	// A guest named twice is only counted once
+	seen := make(map[int]bool)
+	ids := make([]int, 0, len(c.GuestIDs))
+	guestIDs := make([]int64, 0, len(c.GuestIDs))
+	for _, id := range c.GuestIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+			guestIDs = append(guestIDs, int64(id))
+		}
+	}
+	c.GuestIDs = ids
+
+	// Every guest and the table must belong to the event
+	if len(guestIDs) > 0 {
+		var found int
+		err := s.db.QueryRow(`
+			SELECT COUNT(*) FROM guests WHERE event_id = $1 AND id = ANY($2)
+		`, eventID, pq.Array(guestIDs)).Scan(&found)
+		if err != nil {
+			return nil, err
+		}
+		if found != len(guestIDs) {
+			return nil, fmt.Errorf("some guests do not exist in this event")
+		}
+	}
+
+	if c.TableID != nil {
+		var exists bool
+		err := s.db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM tables WHERE id = $1 AND event_id = $2)
+		`, *c.TableID, eventID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("table with id %d not found", *c.TableID)
+		}
+	}
+
+	err := s.db.QueryRow(`
+		INSERT INTO seating_constraints (event_id, kind, guest_ids, table_id, tag, strict, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, eventID, c.Kind, pq.Array(guestIDs), c.TableID, c.Tag, c.Strict, c.Notes).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *Store) DeleteConstraint(eventID int, id int) error {
+	res, err := s.db.Exec("DELETE FROM seating_constraints WHERE id = $1 AND event_id = $2", id, eventID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("constraint with id %d not found", id)
+	}
+	return nil
+}
+
+// Every rule the current seating breaks
+func (s *Store) GetViolations(eventID int) ([]types.ConstraintViolation, error) {
+	constraints, err := s.GetConstraints(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	seating := NewSeating()
+
+	guestRows, err := s.db.Query(`
+		SELECT id, table_id, tags FROM guests WHERE event_id = $1 AND table_id IS NOT NULL
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer guestRows.Close()
+
+	for guestRows.Next() {
+		var id, tableID int
+		var tags []string
+		if err := guestRows.Scan(&id, &tableID, pq.Array(&tags)); err != nil {
+			return nil, err
+		}
+		seating.Guests[id] = tableID
+		seating.Tags[id] = tags
+	}
+	if err := guestRows.Err(); err != nil {
+		return nil, err
+	}
+
+	genRows, err := s.db.Query(`
+		SELECT id, table_id FROM generals WHERE event_id = $1 AND table_id IS NOT NULL
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer genRows.Close()
+
+	for genRows.Next() {
+		var id, tableID int
+		if err := genRows.Scan(&id, &tableID); err != nil {
+			return nil, err
+		}
+		seating.Generals[id] = tableID
+	}
+	if err := genRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return Evaluate(constraints, seating), nil
+}
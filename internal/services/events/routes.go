@@ -0,0 +1,263 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/diegob0/rspv_backend/internal/services/auth"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.EventStore
+}
+
+func NewHandler(store types.EventStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Protected routes
+	protected := router.PathPrefix("/events").Subrouter()
+	protected.Use(auth.AuthMiddleware)
+
+	protected.HandleFunc("", auth.RequirePermission(auth.PermManageEvents, h.handleCreateEvent)).Methods(http.MethodPost)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermRead, h.handleGetEvents)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id:[0-9]+}", auth.RequirePermission(auth.PermRead, h.handleGetEventByID)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id:[0-9]+}", auth.RequirePermission(auth.PermManageEvents, h.handleDeleteEvent)).Methods(http.MethodDelete)
+	protected.HandleFunc("/{id:[0-9]+}", auth.RequirePermission(auth.PermManageEvents, h.handleUpdateEvent)).Methods(http.MethodPatch)
+}
+
+// Rejects requests to /events/{eventId}/... when the event does not exist
+func (h *Handler) RequireEvent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := utils.ParseEventID(r)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if _, err := h.store.GetEventByID(eventID); err != nil {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("event with id %d not found", eventID))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// @Summary Register a new event
+// @Description Registers a new event and returns a 201 status on success
+// @Tags events
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body types.CreateEventPayload true "Event Creation Payload"
+// @Success 201 {object} nil
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events [post]
+func (h *Handler) handleCreateEvent(w http.ResponseWriter, r *http.Request) {
+	// Get JSON paylaod
+	var payload types.CreateEventPayload
+
+	// Show an error if it exists
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	event := types.Event{
+		Name:            payload.Name,
+		EventDate:       payload.EventDate,
+		Venue:           payload.Venue,
+		Timezone:        payload.Timezone,
+		BackgroundImage: payload.BackgroundImage,
+		TextColor:       payload.TextColor,
+		RSVPDeadline:    payload.RSVPDeadline,
+		ReEntry:         payload.ReEntry,
+	}
+
+	// Fall back to the same defaults as the database
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	if event.BackgroundImage == "" {
+		event.BackgroundImage = "assets/Pase3.png"
+	}
+	if event.TextColor == "" {
+		event.TextColor = "#FFFFFF"
+	}
+
+	if err := h.store.CreateEvent(event); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, nil)
+}
+
+// @Summary Get all events
+// @Description Returns a list of events ordered by date
+// @Tags events
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} types.Event
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events [get]
+func (h *Handler) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	e, err := h.store.GetEvents()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, e)
+}
+
+// @Summary Get event by ID
+// @Description Returns a single event by its ID
+// @Tags events
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Event ID"
+// @Success 200 {object} types.Event
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Router /events/{id} [get]
+func (h *Handler) handleGetEventByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid event ID"))
+		return
+	}
+
+	e, err := h.store.GetEventByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, e)
+}
+
+// @Summary Delete an event by ID
+// @Description Deletes an event and everything scoped to it (tables, guests, generals and tickets)
+// @Tags events
+// @Security BearerAuth
+// @Param id path int true "Event ID"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{id} [delete]
+func (h *Handler) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid event ID"))
+		return
+	}
+
+	if err := h.store.DeleteEvent(id); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// @Summary Update an event
+// @Description Updates event data by ID (partial update)
+// @Tags events
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Event ID"
+// @Param payload body types.UpdateEventPayload true "Event fields to update"
+// @Success 200 {object} types.Event
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{id} [patch]
+func (h *Handler) handleUpdateEvent(w http.ResponseWriter, r *http.Request) {
+	// Get id
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid event id"))
+		return
+	}
+
+	// Get the payload
+	var payload types.UpdateEventPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	event, err := h.store.GetEventByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// Apply updates only if present
+	if payload.Name != nil {
+		event.Name = *payload.Name
+	}
+	if payload.EventDate != nil {
+		event.EventDate = *payload.EventDate
+	}
+	if payload.Venue != nil {
+		event.Venue = *payload.Venue
+	}
+	if payload.Timezone != nil {
+		event.Timezone = *payload.Timezone
+	}
+	if payload.BackgroundImage != nil {
+		event.BackgroundImage = *payload.BackgroundImage
+	}
+	if payload.TextColor != nil {
+		event.TextColor = *payload.TextColor
+	}
+	if payload.RSVPDeadline != nil {
+		event.RSVPDeadline = payload.RSVPDeadline
+	}
+	if payload.ReEntry != nil {
+		event.ReEntry = *payload.ReEntry
+	}
+
+	if err := h.store.UpdateEvent(event); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, event)
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Helper function to scan each row of the table events
+func scanRowIntoEvent(rows *sql.Rows) (*types.Event, error) {
+	event := new(types.Event)
+
+	err := rows.Scan(
+		&event.ID,
+		&event.Name,
+		&event.EventDate,
+		&event.Venue,
+		&event.Timezone,
+		&event.BackgroundImage,
+		&event.TextColor,
+		&event.RSVPDeadline,
+		&event.ReEntry,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func (s *Store) GetEventByID(id int) (*types.Event, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, event_date, venue, timezone, background_image, text_color, rsvp_deadline, re_entry, created_at
+		FROM events
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	e := new(types.Event)
+	for rows.Next() {
+		e, err = scanRowIntoEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.ID == 0 {
+		return nil, fmt.Errorf("event not found")
+	}
+
+	return e, nil
+}
+
+func (s *Store) GetEvents() ([]types.Event, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, event_date, venue, timezone, background_image, text_color, rsvp_deadline, re_entry, created_at
+		FROM events
+		ORDER BY event_date
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]types.Event, 0)
+
+	for rows.Next() {
+		event, err := scanRowIntoEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, nil
+}
+
+func (s *Store) CreateEvent(event types.Event) error {
+	_, err := s.db.Exec(`
+		INSERT INTO events (name, event_date, venue, timezone, background_image, text_color, rsvp_deadline, re_entry)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, event.Name, event.EventDate, event.Venue, event.Timezone, event.BackgroundImage, event.TextColor, event.RSVPDeadline, event.ReEntry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteEvent(id int) error {
+	res, err := s.db.Exec("DELETE FROM events WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("event with id %d not found", id)
+	}
+	return nil
+}
+
+func (s *Store) UpdateEvent(event *types.Event) error {
+	res, err := s.db.Exec(`
+		UPDATE events
+		SET name = $1, event_date = $2, venue = $3, timezone = $4, background_image = $5, text_color = $6, rsvp_deadline = $7, re_entry = $8
+		WHERE id = $9
+	`, event.Name, event.EventDate, event.Venue, event.Timezone, event.BackgroundImage, event.TextColor, event.RSVPDeadline, event.ReEntry, event.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("event with id %d not found", event.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package exports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// Supported export formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatPDF:  "application/pdf",
+}
+
+// Headers match the ones the guest import understands, so an export can be
+// edited and imported again
+var guestHeaders = []string{"Nombre", "Acompañantes", "Confirmación", "Respondió", "Mesa", "Correo", "Teléfono", "Etiquetas", "Boleto generado", "Boleto enviado", "Nombres de acompañantes"}
+
+var seatingHeaders = []string{"Mesa", "Asiento", "Nombre", "Tipo", "Acompaña a"}
+
+var rsvpLabels = map[string]string{
+	types.RSVPPending:  "pendiente",
+	types.RSVPAccepted: "confirmado",
+	types.RSVPDeclined: "rechazado",
+}
+
+var seatLabels = map[string]string{
+	types.SeatGuest:     "Invitado",
+	types.SeatCompanion: "Acompañante",
+	types.SeatGeneral:   "General",
+}
+
+func guestRecords(guests []types.GuestExportRow) [][]string {
+	records := make([][]string, 0, len(guests))
+	for _, g := range guests {
+		respondedAt := ""
+		if g.RespondedAt != nil {
+			respondedAt = g.RespondedAt.Format(time.DateTime)
+		}
+
+		records = append(records, []string{
+			g.FullName,
+			strconv.Itoa(g.Additionals),
+			rsvpLabels[g.RSVPStatus],
+			respondedAt,
+			deref(g.TableName),
+			deref(g.Email),
+			deref(g.Phone),
+			strings.Join(g.Tags, "; "),
+			yesNo(g.TicketGenerated),
+			yesNo(g.TicketSent),
+			strings.Join(g.Companions, "; "),
+		})
+	}
+
+	return records
+}
+
+func seatingRecords(tables []types.SeatingTable) [][]string {
+	records := make([][]string, 0)
+	for _, t := range tables {
+		for i, seat := range t.Seats {
+			records = append(records, []string{
+				t.Name,
+				strconv.Itoa(i + 1),
+				seat.Name,
+				seatLabels[seat.Kind],
+				deref(seat.Host),
+			})
+		}
+	}
+
+	return records
+}
+
+func writeCSV(w io.Writer, headers []string, records [][]string) error {
+	// BOM so Excel opens the file as UTF-8
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+	for _, record := range records {
+		escaped := make([]string, len(record))
+		for i, value := range record {
+			escaped[i] = escapeFormula(value)
+		}
+		if err := writer.Write(escaped); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Names and contact fields come from guests through the RSVP flow. Excel runs
+// a cell starting with one of these as a formula, so it is quoted with ' (the
+// guest import strips it again). The XLSX writer already stores them as text
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func writeXLSX(w io.Writer, sheet string, headers []string, records [][]string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	if err := sw.SetRow("A1", toCells(headers)); err != nil {
+		return err
+	}
+	for i, record := range records {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, toCells(record)); err != nil {
+			return err
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	return f.Write(w)
+}
+
+// Landscape list with one line per guest
+func writeGuestsPDF(w io.Writer, eventName string, guests []types.GuestExportRow) error {
+	pdf := gofpdf.New("L", "mm", "Letter", "")
+	utils.AddPDFFonts(pdf)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont(utils.PDFFont, "", 8)
+		pdf.CellFormat(0, 6, fmt.Sprintf("%d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	headers := []string{"Nombre", "Acomp.", "Confirmación", "Mesa", "Teléfono", "Boleto", "Acompañantes"}
+	widths := []float64{65, 16, 26, 35, 30, 18, 69}
+
+	printHeader := func() {
+		pdf.SetFont(utils.PDFFont, "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for i, header := range headers {
+			pdf.CellFormat(widths[i], 7, header, "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont(utils.PDFFont, "", 9)
+	}
+
+	pdf.AddPage()
+	pdf.SetFont(utils.PDFFont, "B", 14)
+	pdf.CellFormat(0, 8, fmt.Sprintf("%s - Lista de invitados", eventName), "", 1, "L", false, 0, "")
+	pdf.SetFont(utils.PDFFont, "", 9)
+	pdf.CellFormat(0, 6, guestSummary(guests), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	printHeader()
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, g := range guests {
+		if pdf.GetY()+7 > pageHeight-bottom-10 {
+			pdf.AddPage()
+			printHeader()
+		}
+
+		ticket := "-"
+		if g.TicketGenerated {
+			ticket = "Sí"
+		}
+
+		values := []string{
+			g.FullName,
+			strconv.Itoa(g.Additionals),
+			rsvpLabels[g.RSVPStatus],
+			deref(g.TableName),
+			deref(g.Phone),
+			ticket,
+			strings.Join(g.Companions, ", "),
+		}
+		for i, value := range values {
+			pdf.CellFormat(widths[i], 7, utils.FitPDFText(pdf, value, widths[i]), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	return pdf.Output(w)
+}
+
+// One block per table so the sheet can be cut and handed to each waiter
+func writeSeatingPDF(w io.Writer, eventName string, tables []types.SeatingTable) error {
+	pdf := gofpdf.New("P", "mm", "Letter", "")
+	utils.AddPDFFonts(pdf)
+
+	pdf.AddPage()
+	pdf.SetFont(utils.PDFFont, "B", 14)
+	pdf.CellFormat(0, 8, fmt.Sprintf("%s - Acomodo de mesas", eventName), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, t := range tables {
+		// Keep each table on a single page when it fits
+		needed := float64(len(t.Seats)+1)*6 + 10
+		if pdf.GetY()+needed > pageHeight-bottom {
+			pdf.AddPage()
+		}
+
+		pdf.SetFont(utils.PDFFont, "B", 11)
+		pdf.SetFillColor(230, 230, 230)
+		title := fmt.Sprintf("%s (%d de %d lugares)", t.Name, len(t.Seats), t.Capacity)
+		pdf.CellFormat(0, 8, title, "1", 1, "L", true, 0, "")
+
+		pdf.SetFont(utils.PDFFont, "", 10)
+		if len(t.Seats) == 0 {
+			pdf.CellFormat(0, 6, "Sin invitados", "LRB", 1, "L", false, 0, "")
+		}
+		for i, seat := range t.Seats {
+			if pdf.GetY()+6 > pageHeight-bottom {
+				pdf.AddPage()
+			}
+
+			name := seat.Name
+			if seat.Kind == types.SeatCompanion && seat.Host != nil && !strings.Contains(name, *seat.Host) {
+				name = fmt.Sprintf("%s (con %s)", name, *seat.Host)
+			}
+			pdf.CellFormat(12, 6, strconv.Itoa(i+1), "LB", 0, "C", false, 0, "")
+			pdf.CellFormat(0, 6, name, "RB", 1, "L", false, 0, "")
+		}
+		pdf.Ln(4)
+	}
+
+	return pdf.Output(w)
+}
+
+func guestSummary(guests []types.GuestExportRow) string {
+	var accepted, declined, pending, people int
+	for _, g := range guests {
+		switch g.RSVPStatus {
+		case types.RSVPAccepted:
+			accepted++
+			people += 1 + g.Additionals
+		case types.RSVPDeclined:
+			declined++
+		default:
+			pending++
+		}
+	}
+
+	return fmt.Sprintf("%d invitados: %d confirmados (%d personas), %d rechazados, %d pendientes", len(guests), accepted, people, declined, pending)
+}
+
+func toCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = value
+	}
+
+	return cells
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "sí"
+	}
+
+	return "no"
+}
@@ -0,0 +1,116 @@
+package exports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestGuestExport(t *testing.T) {
+	table := "Mesa 1"
+	email := "juan@mail.com"
+	rows := []types.GuestExportRow{
+		{FullName: "Juan Perez", Additionals: 2, RSVPStatus: types.RSVPAccepted, TableName: &table, Email: &email, Tags: []string{"familia", "novia"}, Companions: []string{"Ana Lopez"}},
+		{FullName: "Luis Díaz", RSVPStatus: types.RSVPDeclined},
+	}
+
+	t.Run("csv export should import back", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeCSV(&buf, guestHeaders, guestRecords(rows)); err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := guests.ParseGuestImport("guests.csv", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(imported) != 2 {
+			t.Fatalf("expected 2 rows, got %d", len(imported))
+		}
+
+		juan := imported[0]
+		if juan.FullName != "Juan Perez" || juan.Additionals != 2 || juan.RSVPStatus != types.RSVPAccepted || juan.TableName != table || len(juan.Tags) != 2 {
+			t.Errorf("unexpected row %+v", juan)
+		}
+		if imported[1].RSVPStatus != types.RSVPDeclined || len(imported[1].Issues) != 0 {
+			t.Errorf("unexpected row %+v", imported[1])
+		}
+	})
+
+	t.Run("csv export should not let cells run as formulas", func(t *testing.T) {
+		phone := "+52 55 1234 5678"
+		formula := []types.GuestExportRow{{FullName: `=HYPERLINK("http://evil.example","x")`, Phone: &phone, RSVPStatus: types.RSVPPending}}
+
+		var buf bytes.Buffer
+		if err := writeCSV(&buf, guestHeaders, guestRecords(formula)); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), `,=HYPERLINK`) || strings.Contains(buf.String(), "\n\"=HYPERLINK") || !strings.Contains(buf.String(), "'+52") {
+			t.Errorf("expected formula cells to be quoted, got %q", buf.String())
+		}
+
+		imported, err := guests.ParseGuestImport("guests.csv", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported[0].FullName != formula[0].FullName {
+			t.Errorf("expected the name back as written, got %q", imported[0].FullName)
+		}
+	})
+
+	t.Run("xlsx export should import back", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeXLSX(&buf, "Invitados", guestHeaders, guestRecords(rows)); err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := guests.ParseGuestImport("guests.xlsx", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(imported) != 2 || imported[1].FullName != "Luis Díaz" {
+			t.Errorf("unexpected rows %+v", imported)
+		}
+	})
+
+	t.Run("should render a pdf", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeGuestsPDF(&buf, "Boda", rows); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(buf.String(), "%PDF") {
+			t.Error("expected a pdf document")
+		}
+	})
+}
+
+func TestSeatingExport(t *testing.T) {
+	host := "Juan Perez"
+	tables := []types.SeatingTable{
+		{ID: 1, Name: "Mesa 1", Capacity: 7, Seats: []types.SeatingSeat{
+			{Name: host, Kind: types.SeatGuest},
+			{Name: "Ana Lopez", Host: &host, Kind: types.SeatCompanion},
+			{Name: "General #1", Kind: types.SeatGeneral},
+		}},
+		{ID: 2, Name: "Mesa 2", Capacity: 10, Seats: []types.SeatingSeat{}},
+	}
+
+	records := seatingRecords(tables)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if records[1][1] != "2" || records[1][4] != host {
+		t.Errorf("unexpected record %v", records[1])
+	}
+
+	var buf bytes.Buffer
+	if err := writeSeatingPDF(&buf, "Boda", tables); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package exports
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/diegob0/rspv_backend/internal/services/auth"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.ExportStore
+}
+
+func NewHandler(store types.ExportStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Protected routes
+	protected := router.PathPrefix("/exports").Subrouter()
+	protected.Use(auth.AuthMiddleware)
+
+	protected.HandleFunc("/guests", auth.RequirePermission(auth.PermRead, h.handleExportGuests)).Methods(http.MethodGet)
+	protected.HandleFunc("/seating", auth.RequirePermission(auth.PermRead, h.handleExportSeating)).Methods(http.MethodGet)
+}
+
+// @Summary Export the guest list
+// @Description Downloads every guest of the event with confirmation, ticket state, table and companions
+// @Tags exports
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param eventId path int true "Event ID"
+// @Param format query string false "csv, xlsx or pdf (default csv)"
+// @Success 200 {file} file
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/exports/guests [get]
+func (h *Handler) handleExportGuests(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format, err := parseFormat(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	eventName, err := h.store.GetEventName(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	guests, err := h.store.GetGuestExport(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setDownloadHeaders(w, format, fmt.Sprintf("invitados-%d", eventID))
+
+	switch format {
+	case FormatCSV:
+		err = writeCSV(w, guestHeaders, guestRecords(guests))
+	case FormatXLSX:
+		err = writeXLSX(w, "Invitados", guestHeaders, guestRecords(guests))
+	case FormatPDF:
+		err = writeGuestsPDF(w, eventName, guests)
+	}
+
+	// Headers are already sent, all we can do is log it
+	if err != nil {
+		log.Printf("failed to export guests of event %d: %v", eventID, err)
+	}
+}
+
+// @Summary Export the seating sheet
+// @Description Downloads every table with the people seated at it, including companions and general tickets
+// @Tags exports
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param eventId path int true "Event ID"
+// @Param format query string false "csv, xlsx or pdf (default csv)"
+// @Success 200 {file} file
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/exports/seating [get]
+func (h *Handler) handleExportSeating(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format, err := parseFormat(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	eventName, err := h.store.GetEventName(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tables, err := h.store.GetSeatingExport(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setDownloadHeaders(w, format, fmt.Sprintf("mesas-%d", eventID))
+
+	switch format {
+	case FormatCSV:
+		err = writeCSV(w, seatingHeaders, seatingRecords(tables))
+	case FormatXLSX:
+		err = writeXLSX(w, "Mesas", seatingHeaders, seatingRecords(tables))
+	case FormatPDF:
+		err = writeSeatingPDF(w, eventName, tables)
+	}
+
+	// Headers are already sent, all we can do is log it
+	if err != nil {
+		log.Printf("failed to export seating of event %d: %v", eventID, err)
+	}
+}
+
+func parseFormat(r *http.Request) (string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		return FormatCSV, nil
+	}
+
+	if _, ok := contentTypes[format]; !ok {
+		return "", fmt.Errorf("unsupported format %q, use csv, xlsx or pdf", format)
+	}
+
+	return format, nil
+}
+
+func setDownloadHeaders(w http.ResponseWriter, format, name string) {
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", name, format))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,160 @@
+package exports
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetEventName(eventID int) (string, error) {
+	var name string
+	err := s.db.QueryRow("SELECT name FROM events WHERE id = $1", eventID).Scan(&name)
+	if err != nil {
+		return "", fmt.Errorf("event not found: %w", err)
+	}
+
+	return name, nil
+}
+
+// Every guest of the event with their table and named companions
+func (s *Store) GetGuestExport(eventID int) ([]types.GuestExportRow, error) {
+	rows, err := s.db.Query(`
+		SELECT g.id, g.full_name, g.additionals, g.rsvp_status, g.responded_at, g.email, g.phone, g.tags,
+		       t.name, g.ticket_generated, g.ticket_sent,
+		       COALESCE(ARRAY(SELECT c.full_name FROM companions c WHERE c.guest_id = g.id ORDER BY c.id), '{}')
+		FROM guests g
+		LEFT JOIN tables t ON t.id = g.table_id
+		WHERE g.event_id = $1
+		ORDER BY g.full_name
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guests: %w", err)
+	}
+	defer rows.Close()
+
+	guests := make([]types.GuestExportRow, 0)
+	for rows.Next() {
+		var g types.GuestExportRow
+		err := rows.Scan(
+			&g.ID,
+			&g.FullName,
+			&g.Additionals,
+			&g.RSVPStatus,
+			&g.RespondedAt,
+			&g.Email,
+			&g.Phone,
+			pq.Array(&g.Tags),
+			&g.TableName,
+			&g.TicketGenerated,
+			&g.TicketSent,
+			pq.Array(&g.Companions),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guest: %w", err)
+		}
+		guests = append(guests, g)
+	}
+
+	return guests, rows.Err()
+}
+
+// Every table with the people seated at it: guests, their companions (named
+// or not) and general tickets
+func (s *Store) GetSeatingExport(eventID int) ([]types.SeatingTable, error) {
+	tableRows, err := s.db.Query(`
+		SELECT id, name, capacity FROM tables WHERE event_id = $1 ORDER BY id
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tables: %w", err)
+	}
+	defer tableRows.Close()
+
+	tables := make([]types.SeatingTable, 0)
+	byID := make(map[int]int)
+	for tableRows.Next() {
+		var t types.SeatingTable
+		if err := tableRows.Scan(&t.ID, &t.Name, &t.Capacity); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		t.Seats = []types.SeatingSeat{}
+		byID[t.ID] = len(tables)
+		tables = append(tables, t)
+	}
+	if err := tableRows.Err(); err != nil {
+		return nil, err
+	}
+
+	guestRows, err := s.db.Query(`
+		SELECT g.table_id, g.full_name, g.additionals,
+		       COALESCE(ARRAY(SELECT c.full_name FROM companions c WHERE c.guest_id = g.id ORDER BY c.id), '{}')
+		FROM guests g
+		WHERE g.event_id = $1 AND g.table_id IS NOT NULL
+		ORDER BY g.table_id, g.id
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guests: %w", err)
+	}
+	defer guestRows.Close()
+
+	for guestRows.Next() {
+		var (
+			tableID     int
+			name        string
+			additionals int
+			companions  []string
+		)
+		if err := guestRows.Scan(&tableID, &name, &additionals, pq.Array(&companions)); err != nil {
+			return nil, fmt.Errorf("failed to scan guest: %w", err)
+		}
+
+		idx, ok := byID[tableID]
+		if !ok {
+			continue
+		}
+
+		host := name
+		seats := []types.SeatingSeat{{Name: name, Kind: types.SeatGuest}}
+		for _, companion := range companions {
+			seats = append(seats, types.SeatingSeat{Name: companion, Host: &host, Kind: types.SeatCompanion})
+		}
+		for len(seats) <= additionals {
+			seats = append(seats, types.SeatingSeat{Name: fmt.Sprintf("Acompañante de %s", name), Host: &host, Kind: types.SeatCompanion, Placeholder: true})
+		}
+
+		tables[idx].Seats = append(tables[idx].Seats, seats...)
+	}
+	if err := guestRows.Err(); err != nil {
+		return nil, err
+	}
+
+	genRows, err := s.db.Query(`
+		SELECT table_id, folio FROM generals WHERE event_id = $1 AND table_id IS NOT NULL ORDER BY table_id, folio
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch generals: %w", err)
+	}
+	defer genRows.Close()
+
+	for genRows.Next() {
+		var tableID, folio int
+		if err := genRows.Scan(&tableID, &folio); err != nil {
+			return nil, fmt.Errorf("failed to scan general: %w", err)
+		}
+
+		if idx, ok := byID[tableID]; ok {
+			tables[idx].Seats = append(tables[idx].Seats, types.SeatingSeat{Name: fmt.Sprintf("General #%d", folio), Kind: types.SeatGeneral})
+		}
+	}
+
+	return tables, genRows.Err()
+}
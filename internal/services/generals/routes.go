@@ -26,11 +26,11 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	protected.Use(auth.AuthMiddleware)
 
 	// Methods to assing and unassign guests
-	protected.HandleFunc("/assign/{generalId}/{tableId}", h.handleAssignGeneral).Methods(http.MethodPatch)
-	protected.HandleFunc("/unassign/{id}", h.handleUnassignGeneral).Methods(http.MethodPatch)
+	protected.HandleFunc("/assign/{generalId}/{tableId}", auth.RequirePermission(auth.PermWrite, h.handleAssignGeneral)).Methods(http.MethodPatch)
+	protected.HandleFunc("/unassign/{id}", auth.RequirePermission(auth.PermWrite, h.handleUnassignGeneral)).Methods(http.MethodPatch)
 
 	// Other routes
-	protected.HandleFunc("", h.handleDeleteLastGenerals).Methods(http.MethodDelete)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermWrite, h.handleDeleteLastGenerals)).Methods(http.MethodDelete)
 }
 
 // @Summary Assign a general to a table
@@ -39,13 +39,21 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param generalId path int true "General ID"
 // @Param tableId path int true "Table ID"
-// @Success 204 "No content"
+// @Success 200 {object} types.AssignResponse
 // @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ConflictResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /generals/assign/{generalId}/{tableId} [patch]
+// @Router /events/{eventId}/generals/assign/{generalId}/{tableId} [patch]
 func (h *Handler) handleAssignGeneral(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	generalIdStr := vars["generalId"]
 	generalId, err := strconv.Atoi(generalIdStr)
@@ -61,12 +69,13 @@ func (h *Handler) handleAssignGeneral(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.AssignGeneral(generalId, tableId); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+	warnings, err := h.store.AssignGeneral(eventID, generalId, tableId)
+	if err != nil {
+		utils.WriteSeatingError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, nil)
+	utils.WriteJSON(w, http.StatusOK, types.AssignResponse{Warnings: warnings})
 }
 
 // @Summary Unassign a general to a table
@@ -75,12 +84,19 @@ func (h *Handler) handleAssignGeneral(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "General ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /generals/unassign/{id} [patch]
+// @Router /events/{eventId}/generals/unassign/{id} [patch]
 func (h *Handler) handleUnassignGeneral(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
@@ -89,7 +105,7 @@ func (h *Handler) handleUnassignGeneral(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.store.UnassignGeneral(id); err != nil {
+	if err := h.store.UnassignGeneral(eventID, id); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -101,12 +117,19 @@ func (h *Handler) handleUnassignGeneral(w http.ResponseWriter, r *http.Request)
 // @Description Deletes the last N general tickets in queue order (only unassigned allowed)
 // @Tags generals
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param count query int false "Number of generals to delete (default is 1)"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /generals [delete]
+// @Router /events/{eventId}/generals [delete]
 func (h *Handler) handleDeleteLastGenerals(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Parse optional ?count query param
 	countStr := r.URL.Query().Get("count")
 	count := 1 // default
@@ -124,7 +147,7 @@ func (h *Handler) handleDeleteLastGenerals(w http.ResponseWriter, r *http.Reques
 
 	// Call store method
 
-	err := h.store.DeleteLastGenerals(count)
+	err = h.store.DeleteLastGenerals(eventID, count)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err) // use 400 for known issues like assigned generals
 		return
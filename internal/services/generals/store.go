@@ -3,6 +3,10 @@ package generals
 import (
 	"database/sql"
 	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/services/constraints"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
 )
 
 type Store struct {
@@ -13,78 +17,92 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) AssignGeneral(generalID int, tableID int) error {
+func (s *Store) AssignGeneral(eventID int, generalID int, tableID int) ([]types.ConstraintViolation, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
+	warnings, err := AssignGeneralTx(tx, eventID, generalID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	return warnings, tx.Commit()
+}
+
+// Seats a general ticket as part of a bigger transaction, the table stays
+// locked until the transaction ends. Returns the non strict constraints it
+// breaks.
+func AssignGeneralTx(tx *sql.Tx, eventID int, generalID int, tableID int) ([]types.ConstraintViolation, error) {
 	var oldTableID sql.NullInt32
 
-	err = tx.QueryRow(`
+	err := tx.QueryRow(`
 		SELECT table_id 
 		FROM generals 
-		WHERE id = $1
-	`, generalID).Scan(&oldTableID)
+		WHERE id = $1 AND event_id = $2
+	`, generalID, eventID).Scan(&oldTableID)
 	if err != nil {
-		return fmt.Errorf("general ticket not found: %w", err)
+		return nil, fmt.Errorf("general ticket not found: %w", err)
 	}
 
 	const totalSeats = 1
 
 	if oldTableID.Valid && int(oldTableID.Int32) == tableID {
-		return fmt.Errorf("general %d is already assigned to table %d", generalID, tableID)
+		return nil, fmt.Errorf("general %d is already assigned to table %d", generalID, tableID)
 	}
 
-	var capacity int
-	err = tx.QueryRow(`
-		SELECT capacity 
-		FROM tables 
-		WHERE id = $1
-	`, tableID).Scan(&capacity)
+	capacity, used, err := utils.TableSeats(tx, eventID, tableID)
 	if err != nil {
-		return fmt.Errorf("table not found: %w", err)
+		return nil, err
 	}
 
-	if capacity < totalSeats {
-		return fmt.Errorf("not enough space at table %d: needed %d, available %d", tableID, totalSeats, capacity)
+	if free := capacity - used; free < totalSeats {
+		return nil, fmt.Errorf("not enough space at table %d: needed %d, available %d", tableID, totalSeats, free)
 	}
 
-	if oldTableID.Valid && int(oldTableID.Int32) != tableID {
-
-		_, err := tx.Exec(`
-			UPDATE tables 
-			SET capacity = capacity + $1 
-			WHERE id = $2
-		`, totalSeats, oldTableID.Int32)
-		if err != nil {
-			return fmt.Errorf("failed to restore old table capacity: %w", err)
-		}
+	warnings, err := constraints.CheckGeneralTx(tx, eventID, generalID, tableID)
+	if err != nil {
+		return nil, err
 	}
 
 	_, err = tx.Exec(`
-		UPDATE tables 
-		SET capacity = capacity - $1
+		UPDATE generals 
+		SET table_id = $1 
 		WHERE id = $2
-	`, totalSeats, tableID)
+	`, tableID, generalID)
 	if err != nil {
-		return fmt.Errorf("failed to update new table capacity: %w", err)
+		return nil, fmt.Errorf("failed to assign general to table: %w", err)
 	}
 
-	_, err = tx.Exec(`
+	return warnings, nil
+}
+
+// Moves a general without checking the table, for batches that validate the
+// final layout themselves. A nil tableID unassigns it.
+func SetGeneralTableTx(tx *sql.Tx, eventID int, generalID int, tableID *int) error {
+	res, err := tx.Exec(`
 		UPDATE generals 
 		SET table_id = $1 
-		WHERE id = $2
-	`, tableID, generalID)
+		WHERE id = $2 AND event_id = $3
+	`, tableID, generalID, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to assign general to table: %w", err)
+		return fmt.Errorf("failed to move general: %w", err)
 	}
 
-	return tx.Commit()
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("general with id %d not found", generalID)
+	}
+
+	return nil
 }
 
-func (s *Store) UnassignGeneral(generalID int) error {
+func (s *Store) UnassignGeneral(eventID int, generalID int) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -96,8 +114,8 @@ func (s *Store) UnassignGeneral(generalID int) error {
 	err = tx.QueryRow(`
 		SELECT table_id
 		FROM generals
-		WHERE id = $1
-	`, generalID).Scan(&tableID)
+		WHERE id = $1 AND event_id = $2
+	`, generalID, eventID).Scan(&tableID)
 	if err != nil {
 		return fmt.Errorf("general not found: %w", err)
 	}
@@ -106,17 +124,6 @@ func (s *Store) UnassignGeneral(generalID int) error {
 		return fmt.Errorf("general is not assigned to any table")
 	}
 
-	const totalSeats = 1
-
-	_, err = tx.Exec(`
-		UPDATE tables 
-		SET capacity = capacity + $1 
-		WHERE id = $2
-	`, totalSeats, tableID.Int32)
-	if err != nil {
-		return fmt.Errorf("failed to update table capacity: %w", err)
-	}
-
 	// Unassign general
 	_, err = tx.Exec(`
 		UPDATE generals 
@@ -130,7 +137,7 @@ func (s *Store) UnassignGeneral(generalID int) error {
 	return tx.Commit()
 }
 
-func (s *Store) DeleteLastGenerals(count int) error {
+func (s *Store) DeleteLastGenerals(eventID int, count int) error {
 	if count <= 0 {
 		return fmt.Errorf("count must be greater than 0")
 	}
@@ -145,9 +152,10 @@ func (s *Store) DeleteLastGenerals(count int) error {
 	rows, err := tx.Query(`
 		SELECT id, table_id 
 		FROM generals 
+		WHERE event_id = $1
 		ORDER BY id DESC 
-		LIMIT $1
-	`, count)
+		LIMIT $2
+	`, eventID, count)
 	if err != nil {
 		return err
 	}
@@ -174,9 +182,19 @@ func (s *Store) DeleteLastGenerals(count int) error {
 		return fmt.Errorf("only %d generals exist, cannot delete %d", len(ids), count)
 	}
 
-	// 3. Delete the generals
+	// 3. Revoke their tickets and delete the generals
 	for _, id := range ids {
-		_, err := tx.Exec(`DELETE FROM generals WHERE id = $1`, id)
+		_, err := tx.Exec(`
+			UPDATE tickets t
+			SET status = 'revoked', revoked_at = NOW(), revoke_reason = 'general deleted: #' || g.folio
+			FROM generals g
+			WHERE t.general_id = g.id AND g.id = $1 AND t.status = 'active'
+		`, id)
+		if err != nil {
+			return fmt.Errorf("failed to revoke the ticket of general %d: %w", id, err)
+		}
+
+		_, err = tx.Exec(`DELETE FROM generals WHERE id = $1`, id)
 		if err != nil {
 			return fmt.Errorf("failed to delete general %d: %w", id, err)
 		}
@@ -0,0 +1,236 @@
+package guests
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+// Columns the import understands, keyed by every header we accept for them
+var importColumns = map[string]string{
+	"name":               "name",
+	"full name":          "name",
+	"fullname":           "name",
+	"nombre":             "name",
+	"nombre completo":    "name",
+	"invitado":           "name",
+	"additionals":        "additionals",
+	"companions":         "additionals",
+	"plus ones":          "additionals",
+	"acompanantes":       "additionals",
+	"adicionales":        "additionals",
+	"confirmation":       "confirmation",
+	"confirmed":          "confirmation",
+	"rsvp":               "confirmation",
+	"status":             "confirmation",
+	"confirmacion":       "confirmation",
+	"confirmado":         "confirmation",
+	"asistencia":         "confirmation",
+	"table":              "table",
+	"table name":         "table",
+	"mesa":               "table",
+	"email":              "email",
+	"e-mail":             "email",
+	"correo":             "email",
+	"correo electronico": "email",
+	"phone":              "phone",
+	"telefono":           "phone",
+	"tel":                "phone",
+	"celular":            "phone",
+	"tags":               "tags",
+	"etiquetas":          "tags",
+	"grupo":              "tags",
+}
+
+// Reads a CSV or XLSX guest list. Problems with single rows are attached to
+// the row, only an unreadable file returns an error.
+func ParseGuestImport(filename string, r io.Reader) ([]types.GuestImportRow, error) {
+	var records [][]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		records, err = readCSV(r)
+	case ".xlsx":
+		records, err = readXLSX(r)
+	default:
+		return nil, fmt.Errorf("unsupported file type %q, use .csv or .xlsx", filepath.Ext(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	// Map each column index to the field it holds
+	columns := make(map[int]string)
+	hasName := false
+	for i, header := range records[0] {
+		if field, ok := importColumns[normalizeHeader(header)]; ok {
+			columns[i] = field
+			hasName = hasName || field == "name"
+		}
+	}
+
+	if !hasName {
+		return nil, fmt.Errorf("missing the name column")
+	}
+
+	rows := make([]types.GuestImportRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		if isEmptyRecord(record) {
+			continue
+		}
+
+		// Spreadsheet row number, the header is row 1
+		row := types.GuestImportRow{Row: i + 2, RSVPStatus: types.RSVPPending}
+
+		for idx, value := range record {
+			field, ok := columns[idx]
+			if !ok {
+				continue
+			}
+			value = unescapeFormula(strings.TrimSpace(value))
+
+			switch field {
+			case "name":
+				row.FullName = value
+			case "additionals":
+				if value == "" {
+					continue
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					row.Issues = append(row.Issues, types.ImportIssue{Row: row.Row, Field: field, Message: fmt.Sprintf("%q is not a valid number of additionals", value)})
+					continue
+				}
+				row.Additionals = n
+			case "confirmation":
+				status, ok := parseRSVPStatus(value)
+				if !ok {
+					row.Issues = append(row.Issues, types.ImportIssue{Row: row.Row, Field: field, Message: fmt.Sprintf("%q is not a valid confirmation", value)})
+					continue
+				}
+				row.RSVPStatus = status
+			case "table":
+				row.TableName = value
+			case "email":
+				if value != "" && utils.Validate.Var(value, "email") != nil {
+					row.Issues = append(row.Issues, types.ImportIssue{Row: row.Row, Field: field, Message: fmt.Sprintf("%q is not a valid email", value)})
+					continue
+				}
+				row.Email = value
+			case "phone":
+				row.Phone = value
+			case "tags":
+				row.Tags = splitTags(value)
+			}
+		}
+
+		if row.FullName == "" {
+			row.Issues = append(row.Issues, types.ImportIssue{Row: row.Row, Field: "name", Message: "name is required"})
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+
+	// Excel adds a BOM to UTF-8 CSVs
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+
+	return records, nil
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xlsx: %w", err)
+	}
+	defer f.Close()
+
+	// Only the first sheet is imported
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("the file has no sheets")
+	}
+
+	records, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xlsx: %w", err)
+	}
+
+	return records, nil
+}
+
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+
+	replacer := strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "_", " ")
+	return replacer.Replace(header)
+}
+
+func parseRSVPStatus(value string) (string, bool) {
+	switch normalizeHeader(value) {
+	case "", "pending", "pendiente":
+		return types.RSVPPending, true
+	case "yes", "y", "true", "1", "si", "accepted", "confirmed", "confirmado":
+		return types.RSVPAccepted, true
+	case "no", "n", "false", "0", "declined", "rechazado":
+		return types.RSVPDeclined, true
+	}
+
+	return "", false
+}
+
+func splitTags(value string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func isEmptyRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Undoes the ' the CSV export puts in front of values Excel would take as a
+// formula
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
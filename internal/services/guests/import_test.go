@@ -0,0 +1,84 @@
+package guests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseGuestImport(t *testing.T) {
+	t.Run("should map spanish headers and values", func(t *testing.T) {
+		csv := "\ufeffNombre,Acompañantes,Confirmación,Mesa,Correo,Teléfono,Etiquetas\n" +
+			"Juan Perez,2,si,Mesa 1,juan@mail.com,5512345678,familia; novia\n" +
+			",,,,,,\n" +
+			"Ana Lopez,,no,,,,\n"
+
+		rows, err := ParseGuestImport("guests.csv", strings.NewReader(csv))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) != 2 {
+			t.Fatalf("expected 2 rows, got %d", len(rows))
+		}
+
+		juan := rows[0]
+		if juan.Row != 2 || juan.FullName != "Juan Perez" || juan.Additionals != 2 || juan.RSVPStatus != types.RSVPAccepted {
+			t.Errorf("unexpected row %+v", juan)
+		}
+		if juan.TableName != "Mesa 1" || juan.Email != "juan@mail.com" || len(juan.Tags) != 2 {
+			t.Errorf("unexpected row %+v", juan)
+		}
+
+		if rows[1].Row != 4 || rows[1].RSVPStatus != types.RSVPDeclined {
+			t.Errorf("unexpected row %+v", rows[1])
+		}
+	})
+
+	t.Run("should report invalid rows", func(t *testing.T) {
+		csv := "name,additionals,confirmation,email\n" +
+			"Juan,-1,maybe,not-an-email\n" +
+			",0,,\n"
+
+		rows, err := ParseGuestImport("guests.csv", strings.NewReader(csv))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows[0].Issues) != 3 {
+			t.Errorf("expected 3 issues, got %+v", rows[0].Issues)
+		}
+		if len(rows[1].Issues) != 1 || rows[1].Issues[0].Field != "name" {
+			t.Errorf("expected a missing name issue, got %+v", rows[1].Issues)
+		}
+	})
+
+	t.Run("should read xlsx files", func(t *testing.T) {
+		f := excelize.NewFile()
+		f.SetSheetRow("Sheet1", "A1", &[]string{"Full Name", "Table"})
+		f.SetSheetRow("Sheet1", "A2", &[]string{"Juan Perez", "Mesa 2"})
+
+		var buf bytes.Buffer
+		if err := f.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := ParseGuestImport("guests.xlsx", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) != 1 || rows[0].FullName != "Juan Perez" || rows[0].TableName != "Mesa 2" {
+			t.Errorf("unexpected rows %+v", rows)
+		}
+	})
+
+	t.Run("should fail without a name column", func(t *testing.T) {
+		if _, err := ParseGuestImport("guests.csv", strings.NewReader("mesa\nMesa 1\n")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -1,15 +1,19 @@
 package guests
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/diegob0/rspv_backend/internal/config"
 	"github.com/diegob0/rspv_backend/internal/services/auth"
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/diegob0/rspv_backend/internal/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
 )
 
 type Handler struct {
@@ -27,20 +31,34 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	protected.Use(auth.AuthMiddleware)
 
 	// Methods to assing and unassign guests
-	protected.HandleFunc("/assign/{guestId}/{tableId}", h.handleAssignGuest).Methods(http.MethodPatch)
-	protected.HandleFunc("/unassign/{id}", h.handleUnassignGuest).Methods(http.MethodPatch)
+	protected.HandleFunc("/assign/{guestId}/{tableId}", auth.RequirePermission(auth.PermWrite, h.handleAssignGuest)).Methods(http.MethodPatch)
+	protected.HandleFunc("/unassign/{id}", auth.RequirePermission(auth.PermWrite, h.handleUnassignGuest)).Methods(http.MethodPatch)
+	protected.HandleFunc("/seating", auth.RequirePermission(auth.PermWrite, h.handleBatchSeating)).Methods(http.MethodPost)
 
 	// Get tickets per guest
-	protected.HandleFunc("/tickets/{id}", h.handleGetTicketsPerGuest).Methods(http.MethodGet)
+	protected.HandleFunc("/tickets/{id}", auth.RequirePermission(auth.PermRead, h.handleGetTicketsPerGuest)).Methods(http.MethodGet)
 
-	protected.HandleFunc("/unassigned", h.handleGetUnassignedGuests).Methods(http.MethodGet)
+	protected.HandleFunc("/unassigned", auth.RequirePermission(auth.PermRead, h.handleGetUnassignedGuests)).Methods(http.MethodGet)
+
+	// Bulk import from a spreadsheet
+	protected.HandleFunc("/import", auth.RequirePermission(auth.PermWrite, h.handleImportGuests)).Methods(http.MethodPost)
+
+	// Named companions of a guest
+	protected.HandleFunc("/{id}/companions", auth.RequirePermission(auth.PermRead, h.handleGetCompanions)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}/companions", auth.RequirePermission(auth.PermWrite, h.handleCreateCompanion)).Methods(http.MethodPost)
+	protected.HandleFunc("/{id}/companions/{companionId}", auth.RequirePermission(auth.PermWrite, h.handleUpdateCompanion)).Methods(http.MethodPatch)
+	protected.HandleFunc("/{id}/companions/{companionId}", auth.RequirePermission(auth.PermWrite, h.handleDeleteCompanion)).Methods(http.MethodDelete)
+
+	// Invitation link for the public RSVP
+	protected.HandleFunc("/{id}/invitation-qr", auth.RequirePermission(auth.PermRead, h.handleGetInvitationQR)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}/invite-token", auth.RequirePermission(auth.PermWrite, h.handleRotateInviteToken)).Methods(http.MethodPost)
 
 	// Other routes
-	protected.HandleFunc("/{id}", h.handleGetGuestByID).Methods(http.MethodGet)
-	protected.HandleFunc("/{id}", h.handleDeleteGuest).Methods(http.MethodDelete)
-	protected.HandleFunc("/{id}", h.handleUpdateGuest).Methods(http.MethodPatch)
-	protected.HandleFunc("", h.handleCreateGuest).Methods(http.MethodPost)
-	protected.HandleFunc("", h.handleGetGuests).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermRead, h.handleGetGuestByID)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermWrite, h.handleDeleteGuest)).Methods(http.MethodDelete)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermWrite, h.handleUpdateGuest)).Methods(http.MethodPatch)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermWrite, h.handleCreateGuest)).Methods(http.MethodPost)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermRead, h.handleGetGuests)).Methods(http.MethodGet)
 }
 
 // @Summary Register a new guest
@@ -49,12 +67,19 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param payload body types.CreateGuestPayload true "Guest Creation Payload"
 // @Success 201 {object} nil
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests [post]
+// @Router /events/{eventId}/guests [post]
 func (h *Handler) handleCreateGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get JSON paylaod
 	var payload types.CreateGuestPayload
 
@@ -72,18 +97,30 @@ func (h *Handler) handleCreateGuest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the guest exists
-	_, err := h.store.GetGuestByName(payload.FullName)
+	_, err = h.store.GetGuestByName(eventID, payload.FullName)
 	if err == nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("guest with name %s already exists", payload.FullName))
 		return
 	}
 
+	guest := types.Guest{
+		FullName:    payload.FullName,
+		Additionals: *payload.Additionals,
+		RSVPStatus:  types.RSVPPending,
+		Email:       payload.Email,
+		Phone:       payload.Phone,
+		Tags:        payload.Tags,
+	}
+
+	// Answers recorded by the planner count as responses too
+	if payload.RSVPStatus != "" && payload.RSVPStatus != types.RSVPPending {
+		now := time.Now()
+		guest.RSVPStatus = payload.RSVPStatus
+		guest.RespondedAt = &now
+	}
+
 	// If not create the guest
-	err = h.store.CreateGuest(types.Guest{
-		FullName:          payload.FullName,
-		Additionals:       *payload.Additionals,
-		ConfirmAttendance: *payload.ConfirmAttendance,
-	})
+	err = h.store.CreateGuest(eventID, guest)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -97,16 +134,23 @@ func (h *Handler) handleCreateGuest(w http.ResponseWriter, r *http.Request) {
 // @Tags guests
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(20)
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.Guest]/
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests [get]
+// @Router /events/{eventId}/guests [get]
 func (h *Handler) handleGetGuests(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	guests, err := h.store.GetGuests(params)
+	guests, err := h.store.GetGuests(eventID, params)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -120,16 +164,23 @@ func (h *Handler) handleGetGuests(w http.ResponseWriter, r *http.Request) {
 // @Tags guests
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(20)
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.Guest]/
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/unassigned [get]
+// @Router /events/{eventId}/guests/unassigned [get]
 func (h *Handler) handleGetUnassignedGuests(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	guests, err := h.store.GetUnassignedGuests(params)
+	guests, err := h.store.GetUnassignedGuests(eventID, params)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -143,11 +194,18 @@ func (h *Handler) handleGetUnassignedGuests(w http.ResponseWriter, r *http.Reque
 // @Tags guests
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 200 {array} types.Guest
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/tickets/{id} [get]
+// @Router /events/{eventId}/guests/tickets/{id} [get]
 func (h *Handler) handleGetTicketsPerGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -158,7 +216,7 @@ func (h *Handler) handleGetTicketsPerGuest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	g, err := h.store.GetTicketsPerGuest(id)
+	g, err := h.store.GetTicketsPerGuest(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -172,12 +230,19 @@ func (h *Handler) handleGetTicketsPerGuest(w http.ResponseWriter, r *http.Reques
 // @Tags guests
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 200 {object} types.Guest
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/{id} [get]
+// @Router /events/{eventId}/guests/{id} [get]
 func (h *Handler) handleGetGuestByID(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get the params
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -189,7 +254,7 @@ func (h *Handler) handleGetGuestByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	g, err := h.store.GetGuestByID(id)
+	g, err := h.store.GetGuestByID(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -202,12 +267,19 @@ func (h *Handler) handleGetGuestByID(w http.ResponseWriter, r *http.Request) {
 // @Description Deletes a guest by ID
 // @Tags guests
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/{id} [delete]
+// @Router /events/{eventId}/guests/{id} [delete]
 func (h *Handler) handleDeleteGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -218,7 +290,7 @@ func (h *Handler) handleDeleteGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.DeleteGuest(id)
+	err = h.store.DeleteGuest(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -233,13 +305,20 @@ func (h *Handler) handleDeleteGuest(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Param payload body types.UpdateGuestPayload true "Guest fields to update"
 // @Success 200 {object} types.Guest
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/{id} [patch]
+// @Router /events/{eventId}/guests/{id} [patch]
 func (h *Handler) handleUpdateGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get id
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -266,7 +345,7 @@ func (h *Handler) handleUpdateGuest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current user from DB if partial update logic is needed
-	guest, err := h.store.GetGuestByID(id)
+	guest, err := h.store.GetGuestByID(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -279,11 +358,25 @@ func (h *Handler) handleUpdateGuest(w http.ResponseWriter, r *http.Request) {
 	if payload.Additionals != nil {
 		guest.Additionals = *payload.Additionals
 	}
-	if payload.ConfirmAttendance != nil {
-		guest.ConfirmAttendance = *payload.ConfirmAttendance
+	if payload.Email != nil {
+		guest.Email = payload.Email
+	}
+	if payload.Phone != nil {
+		guest.Phone = payload.Phone
+	}
+	if payload.Tags != nil {
+		guest.Tags = *payload.Tags
+	}
+	if payload.RSVPStatus != nil && *payload.RSVPStatus != guest.RSVPStatus {
+		guest.RSVPStatus = *payload.RSVPStatus
+		guest.RespondedAt = nil
+		if guest.RSVPStatus != types.RSVPPending {
+			now := time.Now()
+			guest.RespondedAt = &now
+		}
 	}
 
-	if err := h.store.UpdateGuest(guest); err != nil {
+	if err := h.store.UpdateGuest(eventID, guest); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -297,13 +390,21 @@ func (h *Handler) handleUpdateGuest(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param guestId path int true "Guest ID"
 // @Param tableId path int true "Table ID"
-// @Success 204 "No content"
+// @Success 200 {object} types.AssignResponse
 // @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ConflictResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/assign/{guestId}/{tableId} [patch]
+// @Router /events/{eventId}/guests/assign/{guestId}/{tableId} [patch]
 func (h *Handler) handleAssignGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get the guestId
 	vars := mux.Vars(r)
 	guestIdStr := vars["guestId"]
@@ -320,12 +421,64 @@ func (h *Handler) handleAssignGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.AssignGuest(guestId, tableId); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+	warnings, err := h.store.AssignGuest(eventID, guestId, tableId)
+	if err != nil {
+		utils.WriteSeatingError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, nil)
+	utils.WriteJSON(w, http.StatusOK, types.AssignResponse{Warnings: warnings})
+}
+
+// @Summary Move and swap guests and generals between tables
+// @Description Applies every move and swap in a single transaction. Capacity is checked against the final layout, so two parties at full tables can trade places. A null tableId in a move unassigns.
+// @Tags guests
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.BatchSeatingPayload true "Moves and swaps"
+// @Success 200 {object} types.AssignResponse
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ConflictResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/seating [post]
+func (h *Handler) handleBatchSeating(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.BatchSeatingPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	if len(payload.Moves) == 0 && len(payload.Swaps) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("nothing to apply"))
+		return
+	}
+
+	warnings, err := h.store.BatchSeating(eventID, payload)
+	if err != nil {
+		if errors.Is(err, ErrNotEnoughSpace) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteSeatingError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.AssignResponse{Warnings: warnings})
 }
 
 // @Summary Unassign a guest to a table
@@ -334,12 +487,19 @@ func (h *Handler) handleAssignGuest(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /guests/unassign/{id} [patch]
+// @Router /events/{eventId}/guests/unassign/{id} [patch]
 func (h *Handler) handleUnassignGuest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
@@ -348,10 +508,407 @@ func (h *Handler) handleUnassignGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.UnassignGuest(id); err != nil {
+	if err := h.store.UnassignGuest(eventID, id); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, nil)
 }
+
+// @Summary Get the invitation QR of a guest
+// @Description Returns a PNG QR code with the guest's secret RSVP link, to print on the invitation
+// @Tags guests
+// @Security BearerAuth
+// @Produce png
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Success 200 {file} file "QR code"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/invitation-qr [get]
+func (h *Handler) handleGetInvitationQR(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	g, err := h.store.GetGuestByID(eventID, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	png, err := qrcode.Encode(config.Envs.RSVPBaseURL+g.InviteToken, qrcode.Medium, 256)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// @Summary Rotate the invitation token of a guest
+// @Description Generates a new secret RSVP link for the guest, the previous one stops working
+// @Tags guests
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/invite-token [post]
+func (h *Handler) handleRotateInviteToken(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	token, err := h.store.RotateInviteToken(eventID, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"inviteToken": token,
+		"inviteUrl":   config.Envs.RSVPBaseURL + token,
+	})
+}
+
+// @Summary Get the companions of a guest
+// @Description Returns the named companions of a guest
+// @Tags guests
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Success 200 {array} types.Companion
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/companions [get]
+func (h *Handler) handleGetCompanions(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	c, err := h.store.GetCompanions(eventID, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, c)
+}
+
+// @Summary Add a companion to a guest
+// @Description Names one of the guest's additionals. Fails when every additional already has a name
+// @Tags guests
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Param payload body types.CreateCompanionPayload true "Companion Payload"
+// @Success 201 {object} types.Companion
+// @Failure 400 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/companions [post]
+func (h *Handler) handleCreateCompanion(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	var payload types.CreateCompanionPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	c, err := h.store.CreateCompanion(eventID, types.Companion{
+		GuestID:  id,
+		FullName: payload.FullName,
+		Email:    payload.Email,
+		Notes:    payload.Notes,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, c)
+}
+
+// @Summary Update a companion
+// @Description Updates a named companion of a guest (partial update)
+// @Tags guests
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Param companionId path int true "Companion ID"
+// @Param payload body types.UpdateCompanionPayload true "Companion fields to update"
+// @Success 200 {object} types.Companion
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/companions/{companionId} [patch]
+func (h *Handler) handleUpdateCompanion(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	guestID, companionID, err := parseCompanionIDs(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.UpdateCompanionPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	companion, err := FindCompanion(h.store, eventID, guestID, companionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	ApplyCompanionUpdate(companion, payload)
+
+	if err := h.store.UpdateCompanion(eventID, companion); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, companion)
+}
+
+// @Summary Delete a companion
+// @Description Removes a named companion, the additional goes back to an anonymous slot
+// @Tags guests
+// @Security BearerAuth
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Param companionId path int true "Companion ID"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/{id}/companions/{companionId} [delete]
+func (h *Handler) handleDeleteCompanion(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	guestID, companionID, err := parseCompanionIDs(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.DeleteCompanion(eventID, guestID, companionID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func parseCompanionIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+
+	guestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid guest ID")
+	}
+
+	companionID, err := strconv.Atoi(vars["companionId"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid companion ID")
+	}
+
+	return guestID, companionID, nil
+}
+
+// Shared with the public RSVP routes
+func FindCompanion(store types.GuestStore, eventID int, guestID int, companionID int) (*types.Companion, error) {
+	companions, err := store.GetCompanions(eventID, guestID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range companions {
+		if companions[i].ID == companionID {
+			return &companions[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("companion with id %d not found", companionID)
+}
+
+// Apply updates only if present
+func ApplyCompanionUpdate(companion *types.Companion, payload types.UpdateCompanionPayload) {
+	if payload.FullName != nil {
+		companion.FullName = *payload.FullName
+	}
+	if payload.Email != nil {
+		companion.Email = payload.Email
+	}
+	if payload.Notes != nil {
+		companion.Notes = payload.Notes
+	}
+}
+
+// @Summary Import guests from a spreadsheet
+// @Description Imports a CSV or XLSX guest list (name, additionals, confirmation, table, email, phone, tags). Every row is validated first; the file is applied in one transaction only when nothing is wrong and dryRun is false
+// @Tags guests
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param file formData file true "CSV or XLSX file"
+// @Param dryRun query bool false "Only validate the file (default false)"
+// @Param createTables query bool false "Create tables that do not exist yet (default false)"
+// @Param tableCapacity query int false "Capacity of the created tables (default 10)"
+// @Success 200 {object} types.ImportReport
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 422 {object} types.ImportReport
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/guests/import [post]
+func (h *Handler) handleImportGuests(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing file: %w", err))
+		return
+	}
+	defer file.Close()
+
+	rows, err := ParseGuestImport(header.Filename, file)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := h.store.ImportGuests(eventID, rows, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusOK
+	if len(report.Errors) > 0 || len(report.Duplicates) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	utils.WriteJSON(w, status, report)
+}
+
+const maxImportSize = 10 << 20
+
+func parseImportOptions(r *http.Request) (types.ImportOptions, error) {
+	query := r.URL.Query()
+	opts := types.ImportOptions{TableCapacity: 10}
+
+	var err error
+	if v := query.Get("dryRun"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid dryRun value")
+		}
+	}
+	if v := query.Get("createTables"); v != "" {
+		if opts.CreateTables, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid createTables value")
+		}
+	}
+	if v := query.Get("tableCapacity"); v != "" {
+		if opts.TableCapacity, err = strconv.Atoi(v); err != nil || opts.TableCapacity <= 0 {
+			return opts, fmt.Errorf("tableCapacity must be a positive integer")
+		}
+	}
+
+	return opts, nil
+}
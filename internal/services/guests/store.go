@@ -1,11 +1,19 @@
 package guests
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
+	"github.com/diegob0/rspv_backend/internal/config"
+	"github.com/diegob0/rspv_backend/internal/services/constraints"
+	"github.com/diegob0/rspv_backend/internal/services/generals"
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/diegob0/rspv_backend/internal/utils"
 	"github.com/lib/pq"
@@ -28,10 +36,16 @@ func scanRowIntoGuests(rows *sql.Rows) (*types.Guest, error) {
 		&guest.ID,
 		&guest.FullName,
 		&guest.Additionals,
-		&guest.ConfirmAttendance,
+		&guest.RSVPStatus,
+		&guest.RespondedAt,
+		&guest.RSVPMessage,
+		&guest.Email,
+		&guest.Phone,
+		pq.Array(&guest.Tags),
 		&tableId,
 		&guest.CreatedAt,
 		&guest.TicketGenerated,
+		&guest.InviteToken,
 	)
 	if err != nil {
 		return nil, err
@@ -49,8 +63,8 @@ func scanRowIntoGuests(rows *sql.Rows) (*types.Guest, error) {
 	return guest, nil
 }
 
-func (s *Store) GetGuestByName(name string) (*types.Guest, error) {
-	rows, err := s.db.Query("SELECT id, full_name, additionals, confirm_attendance, table_id, created_at, ticket_generated   FROM guests WHERE name=$1", name)
+func (s *Store) GetGuestByName(eventID int, name string) (*types.Guest, error) {
+	rows, err := s.db.Query("SELECT id, full_name, additionals, rsvp_status, responded_at, rsvp_message, email, phone, tags, table_id, created_at, ticket_generated, invite_token FROM guests WHERE LOWER(full_name)=LOWER($1) AND event_id=$2", name, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +86,8 @@ func (s *Store) GetGuestByName(name string) (*types.Guest, error) {
 	return g, nil
 }
 
-func (s *Store) GetGuestByID(id int) (*types.Guest, error) {
-	rows, err := s.db.Query("SELECT id, full_name, additionals, confirm_attendance, table_id, created_at, ticket_generated FROM guests WHERE id=$1", id)
+func (s *Store) GetGuestByID(eventID int, id int) (*types.Guest, error) {
+	rows, err := s.db.Query("SELECT id, full_name, additionals, rsvp_status, responded_at, rsvp_message, email, phone, tags, table_id, created_at, ticket_generated, invite_token FROM guests WHERE id=$1 AND event_id=$2", id, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,42 +106,93 @@ func (s *Store) GetGuestByID(id int) (*types.Guest, error) {
 		return nil, fmt.Errorf("mesa not found")
 	}
 
+	if err := s.loadCheckIns([]*types.Guest{g}); err != nil {
+		return nil, err
+	}
+
 	return g, nil
 }
 
-func (s *Store) GetGuests(params types.PaginationParams) (*types.PaginatedResult[*types.Guest], error) {
-	var whereClause string
-	var args []interface{}
+func (s *Store) GetGuests(eventID int, params types.PaginationParams) (*types.PaginatedResult[*types.Guest], error) {
+	whereClause := " WHERE event_id = $1"
+	args := []interface{}{eventID}
 	orderBy := "id"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		whereClause = " WHERE full_name ILIKE $1"
+		whereClause += " AND full_name ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
 	baseQuery := `
-		SELECT id, full_name, additionals, confirm_attendance, table_id, created_at, ticket_generated
+		SELECT id, full_name, additionals, rsvp_status, responded_at, rsvp_message, email, phone, tags, table_id, created_at, ticket_generated, invite_token
 		FROM guests
 	` + whereClause
 
 	countQuery := `SELECT COUNT(*) FROM guests` + whereClause
 
-	return utils.Paginate(s.db, baseQuery, countQuery, scanRowIntoGuests, params, orderBy, args...)
+	result, err := utils.Paginate(s.db, baseQuery, countQuery, scanRowIntoGuests, params, orderBy, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadCheckIns(result.Data); err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
-func (s *Store) GetUnassignedGuests(params types.PaginationParams) (*types.PaginatedResult[*types.Guest], error) {
+// How many of each guest's party arrived, for guests with tickets. Revoked
+// tickets are not expected anymore
+func (s *Store) loadCheckIns(guests []*types.Guest) error {
+	ids := make([]int64, 0, len(guests))
+	byID := make(map[int]*types.Guest, len(guests))
+	for _, g := range guests {
+		ids = append(ids, int64(g.ID))
+		byID[g.ID] = g
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT guest_id, COUNT(*) FILTER (WHERE status = 'used'), COUNT(*), COUNT(*) FILTER (WHERE present)
+		FROM tickets
+		WHERE guest_id = ANY($1) AND type = 'named' AND status <> 'revoked'
+		GROUP BY guest_id
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to count check-ins: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var count types.CheckInCount
+		if err := rows.Scan(&id, &count.Arrived, &count.Expected, &count.Present); err != nil {
+			return fmt.Errorf("failed to scan check-ins: %w", err)
+		}
+		if g, ok := byID[id]; ok {
+			g.CheckIn = &count
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Store) GetUnassignedGuests(eventID int, params types.PaginationParams) (*types.PaginatedResult[*types.Guest], error) {
 	var andWhere string
-	var args []interface{}
+	args := []interface{}{eventID}
 	orderBy := "id"
-	whereClause := " WHERE table_id IS NULL"
+	whereClause := " WHERE table_id IS NULL AND event_id = $1"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		andWhere = " AND full_name ILIKE $1"
+		andWhere = " AND full_name ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
 	baseQuery := `
-		SELECT id, full_name, additionals, confirm_attendance, table_id, created_at, ticket_generated
+		SELECT id, full_name, additionals, rsvp_status, responded_at, rsvp_message, email, phone, tags, table_id, created_at, ticket_generated, invite_token
 		FROM guests
 	` + whereClause + andWhere
 
@@ -136,11 +201,11 @@ func (s *Store) GetUnassignedGuests(params types.PaginationParams) (*types.Pagin
 	return utils.Paginate(s.db, baseQuery, countQuery, scanRowIntoGuests, params, orderBy, args...)
 }
 
-func (s *Store) CreateGuest(guest types.Guest) error {
+func (s *Store) CreateGuest(eventID int, guest types.Guest) error {
 	normalized := strings.ToLower(guest.FullName)
 
 	var exists bool
-	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM guests WHERE LOWER(full_name) = $1)", normalized).Scan(&exists)
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM guests WHERE LOWER(full_name) = $1 AND event_id = $2)", normalized, eventID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("failed to check for existing guest: %w", err)
 	}
@@ -148,7 +213,15 @@ func (s *Store) CreateGuest(guest types.Guest) error {
 		return fmt.Errorf("guest with name '%s' already exists", guest.FullName)
 	}
 
-	_, err = s.db.Exec("INSERT INTO guests (full_name, additionals, confirm_attendance) VALUES ($1, $2, $3)", guest.FullName, guest.Additionals, guest.ConfirmAttendance)
+	inviteToken, err := utils.RandomToken(24)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO guests (event_id, full_name, additionals, rsvp_status, responded_at, email, phone, tags, invite_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, eventID, guest.FullName, guest.Additionals, guest.RSVPStatus, guest.RespondedAt, guest.Email, guest.Phone, pq.Array(nonNilTags(guest.Tags)), inviteToken)
 	if err != nil {
 		return err
 	}
@@ -156,29 +229,34 @@ func (s *Store) CreateGuest(guest types.Guest) error {
 	return nil
 }
 
-func (s *Store) DeleteGuest(id int) error {
-	var tableID sql.NullInt64
+// tags is NOT NULL, a nil slice would be sent as NULL
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
 
-	err := s.db.QueryRow(`
-	SELECT table_id FROM guests WHERE id = $1
-		`, id).Scan(&tableID)
+func (s *Store) DeleteGuest(eventID int, id int) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("guest with id %d not found", id)
-		}
 		return err
-
 	}
+	defer tx.Rollback()
 
-	// Unassign if any
-	if tableID.Valid {
-		if err := s.UnassignGuest(id); err != nil {
-			return err
-		}
+	// The tickets outlive the guest as revoked, so a scan can still say why
+	_, err = tx.Exec(`
+		UPDATE tickets t
+		SET status = 'revoked', revoked_at = NOW(), revoke_reason = 'guest deleted: ' || g.full_name
+		FROM guests g
+		WHERE t.guest_id = g.id AND g.id = $1 AND g.event_id = $2 AND t.status = 'active'
+	`, id, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke guest tickets: %w", err)
 	}
 
-	// Delete guest
-	res, err := s.db.Exec("DELETE FROM guests WHERE id = $1", id)
+	// The seats are freed with the guest, occupancy is computed from guests
+	res, err := tx.Exec("DELETE FROM guests WHERE id = $1 AND event_id = $2", id, eventID)
 	if err != nil {
 		return err
 	}
@@ -189,108 +267,157 @@ func (s *Store) DeleteGuest(id int) error {
 	if rowsAffected == 0 {
 		return fmt.Errorf("guest with id %d not found", id)
 	}
-	return nil
+
+	// guest_ids has no foreign key, so the guest leaves its rules by hand and a
+	// rule left with a single guest no longer means anything
+	_, err = tx.Exec(`
+		UPDATE seating_constraints
+		SET guest_ids = array_remove(guest_ids, $1)
+		WHERE event_id = $2 AND $1 = ANY(guest_ids)
+	`, id, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to remove guest from constraints: %w", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM seating_constraints
+		WHERE event_id = $1 AND kind IN ('together', 'apart') AND cardinality(guest_ids) < 2
+	`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to drop emptied constraints: %w", err)
+	}
+
+	return tx.Commit()
 }
 
-func (s *Store) UpdateGuest(guest *types.Guest) error {
+func (s *Store) UpdateGuest(eventID int, guest *types.Guest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tables are locked before guests, in the same order as seating, so an edit
+	// racing a move cannot deadlock it or grow a guest past a stale count
+	if _, err := tx.Exec("SELECT id FROM tables WHERE event_id = $1 ORDER BY id FOR UPDATE", eventID); err != nil {
+		return err
+	}
+
 	var tableID *int
-	err := s.db.QueryRow(`
-		SELECT table_id FROM guests WHERE id = $1
-		`, guest.ID).Scan(&tableID)
+	var additionals int
+	var fullName string
+	err = tx.QueryRow(`
+		SELECT table_id, additionals, full_name FROM guests WHERE id = $1 AND event_id = $2 FOR UPDATE
+		`, guest.ID, eventID).Scan(&tableID, &additionals, &fullName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return fmt.Errorf("guest with id %d was not found", guest.ID)
 		}
+		return err
 	}
 
-	if tableID != nil {
-		return fmt.Errorf("cannot update guest: %v assigned to a table (id=%d). Unassign the guest from the table first", guest.ID, *tableID)
+	// A seated guest can only grow while the table has free seats
+	if tableID != nil && guest.Additionals > additionals {
+		capacity, used, err := utils.TableSeats(tx, eventID, *tableID)
+		if err != nil {
+			return err
+		}
+
+		needed := guest.Additionals - additionals
+		if free := capacity - used; free < needed {
+			return fmt.Errorf("not enough space at table %d: needed %d more, available %d", *tableID, needed, free)
+		}
 	}
 
-	res, err := s.db.Exec(`
-		UPDATE guests 
-		SET full_name = $1, additionals = $2, confirm_attendance = $3
-		WHERE id = $4
-	`, guest.FullName, guest.Additionals, guest.ConfirmAttendance, guest.ID)
+	// Named companions take additionals, they cannot be dropped from under them
+	var companions int
+	err = tx.QueryRow("SELECT COUNT(*) FROM companions WHERE guest_id = $1", guest.ID).Scan(&companions)
 	if err != nil {
 		return err
 	}
+	if guest.Additionals < companions {
+		return fmt.Errorf("cannot update guest: %d has %d named companions, remove them before lowering additionals", guest.ID, companions)
+	}
 
-	rowsAffected, err := res.RowsAffected()
+	_, err = tx.Exec(`
+		UPDATE guests 
+		SET full_name = $1, additionals = $2, rsvp_status = $3, responded_at = $4, email = $5, phone = $6, tags = $7
+		WHERE id = $8 AND event_id = $9
+	`, guest.FullName, guest.Additionals, guest.RSVPStatus, guest.RespondedAt, guest.Email, guest.Phone, pq.Array(nonNilTags(guest.Tags)), guest.ID, eventID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("guest with id %d not found", guest.ID)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The name and the number of tickets are printed
+	if guest.FullName != fullName || guest.Additionals != additionals {
+		QueueTicketRebuild(s.db, eventID, []int{guest.ID})
 	}
 
 	return nil
 }
 
 // Methods to assign and unassign guests to tables
-func (s *Store) AssignGuest(guestID int, tableID int) error {
+func (s *Store) AssignGuest(eventID int, guestID int, tableID int) ([]types.ConstraintViolation, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
+	warnings, err := AssignGuestTx(tx, eventID, guestID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	QueueTicketRebuild(s.db, eventID, []int{guestID})
+
+	return warnings, nil
+}
+
+// Seats a guest as part of a bigger transaction, the table and the guest stay
+// locked until the transaction ends. Returns the non strict constraints it
+// breaks.
+func AssignGuestTx(tx *sql.Tx, eventID int, guestID int, tableID int) ([]types.ConstraintViolation, error) {
+	// The table is locked before the guest, like everywhere else
+	capacity, used, err := utils.TableSeats(tx, eventID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
 	var oldTableID sql.NullInt32
 	var additionals int
 
-	// Fetch old table ID and additionals
+	// Locked, so the party cannot grow before the assignment commits
 	err = tx.QueryRow(`
 		SELECT table_id, additionals 
 		FROM guests 
-		WHERE id = $1
-	`, guestID).Scan(&oldTableID, &additionals)
+		WHERE id = $1 AND event_id = $2
+		FOR UPDATE
+	`, guestID, eventID).Scan(&oldTableID, &additionals)
 	if err != nil {
-		return fmt.Errorf("guest not found: %w", err)
+		return nil, fmt.Errorf("guest not found: %w", err)
 	}
 
 	totalSeats := 1 + additionals
 
 	if oldTableID.Valid && int(oldTableID.Int32) == tableID {
-		return fmt.Errorf("guest %d is already assigned to table %d", guestID, tableID)
-	}
-
-	// Check if new table has enough capacity
-	var capacity int
-	err = tx.QueryRow(`
-		SELECT capacity 
-		FROM tables 
-		WHERE id = $1
-	`, tableID).Scan(&capacity)
-	if err != nil {
-		return fmt.Errorf("table not found: %w", err)
-	}
-
-	if capacity < totalSeats {
-		return fmt.Errorf("not enough space at table %d: needed %d, available %d", tableID, totalSeats, capacity)
+		return nil, fmt.Errorf("guest %d is already assigned to table %d", guestID, tableID)
 	}
 
-	// Restore capacity to old table (if changing tables)
-	if oldTableID.Valid && int(oldTableID.Int32) != tableID {
-		_, err := tx.Exec(`
-
-			UPDATE tables 
-			SET capacity = capacity + $1 
-			WHERE id = $2
-		`, totalSeats, oldTableID.Int32)
-		if err != nil {
-			return fmt.Errorf("failed to restore old table capacity: %w", err)
-		}
+	if free := capacity - used; free < totalSeats {
+		return nil, fmt.Errorf("not enough space at table %d: needed %d, available %d", tableID, totalSeats, free)
 	}
 
-	// Subtract from new table
-	_, err = tx.Exec(`
-		UPDATE tables 
-		SET capacity = capacity - $1 
-		WHERE id = $2
-	`, totalSeats, tableID)
+	warnings, err := constraints.CheckGuestTx(tx, eventID, guestID, tableID)
 	if err != nil {
-		return fmt.Errorf("failed to update new table capacity: %w", err)
+		return nil, err
 	}
 
 	// Assign guest
@@ -300,13 +427,13 @@ func (s *Store) AssignGuest(guestID int, tableID int) error {
 		WHERE id = $2
 	`, tableID, guestID)
 	if err != nil {
-		return fmt.Errorf("failed to assign guest to table: %w", err)
+		return nil, fmt.Errorf("failed to assign guest to table: %w", err)
 	}
 
-	return tx.Commit()
+	return warnings, nil
 }
 
-func (s *Store) UnassignGuest(guestID int) error {
+func (s *Store) UnassignGuest(eventID int, guestID int) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -314,14 +441,13 @@ func (s *Store) UnassignGuest(guestID int) error {
 	defer tx.Rollback()
 
 	var tableID sql.NullInt32
-	var additionals int
 
-	// Get guest's current table and additionals
+	// Get guest's current table
 	err = tx.QueryRow(`
-		SELECT table_id, additionals
+		SELECT table_id
 		FROM guests
-		WHERE id = $1
-	`, guestID).Scan(&tableID, &additionals)
+		WHERE id = $1 AND event_id = $2
+	`, guestID, eventID).Scan(&tableID)
 	if err != nil {
 		return fmt.Errorf("guest not found: %w", err)
 	}
@@ -330,18 +456,6 @@ func (s *Store) UnassignGuest(guestID int) error {
 		return fmt.Errorf("guest is not assigned to any table")
 	}
 
-	totalSeats := 1 + additionals
-
-	// Increment table capacity
-	_, err = tx.Exec(`
-		UPDATE tables 
-		SET capacity = capacity + $1 
-		WHERE id = $2
-	`, totalSeats, tableID.Int32)
-	if err != nil {
-		return fmt.Errorf("failed to update table capacity: %w", err)
-	}
-
 	// Unassign guest
 	_, err = tx.Exec(`
 		UPDATE guests 
@@ -352,12 +466,41 @@ func (s *Store) UnassignGuest(guestID int) error {
 		return fmt.Errorf("failed to unassign guest: %w", err)
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	QueueTicketRebuild(s.db, eventID, []int{guestID})
+
+	return nil
+}
+
+// Replaces the invitation token, the old link stops working
+func (s *Store) RotateInviteToken(eventID int, guestID int) (string, error) {
+	inviteToken, err := utils.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := s.db.Exec("UPDATE guests SET invite_token = $1 WHERE id = $2 AND event_id = $3", inviteToken, guestID, eventID)
+	if err != nil {
+		return "", err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("guest with id %d not found", guestID)
+	}
+
+	return inviteToken, nil
 }
 
 // Methods to get the tickets per guest
-func (s *Store) GetTicketsPerGuest(guestID int) ([]types.GuestWithTickets, error) {
-	rows, err := s.db.Query("SELECT id, full_name, additionals, confirm_attendance, table_id, created_at, ticket_generated, qr_code_urls FROM guests WHERE id = $1", guestID)
+func (s *Store) GetTicketsPerGuest(eventID int, guestID int) ([]types.GuestWithTickets, error) {
+	rows, err := s.db.Query("SELECT id, full_name, additionals, rsvp_status, table_id, created_at, ticket_generated, qr_code_urls FROM guests WHERE id = $1 AND event_id = $2", guestID, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -391,7 +534,7 @@ func scanRowIntoGuestWithTickets(rows *sql.Rows) (*types.GuestWithTickets, error
 		&guest.ID,
 		&guest.FullName,
 		&guest.Additionals,
-		&guest.ConfirmAttendance,
+		&guest.RSVPStatus,
 		&tableId,
 		&guest.CreatedAt,
 		&guest.TicketGenerated,
@@ -412,3 +555,513 @@ func scanRowIntoGuestWithTickets(rows *sql.Rows) (*types.GuestWithTickets, error
 
 	return guest, nil
 }
+
+// Methods for the named companions of a guest
+func scanRowIntoCompanion(rows *sql.Rows) (*types.Companion, error) {
+	c := new(types.Companion)
+
+	err := rows.Scan(
+		&c.ID,
+		&c.GuestID,
+		&c.FullName,
+		&c.Email,
+		&c.Notes,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *Store) GetCompanions(eventID int, guestID int) ([]types.Companion, error) {
+	rows, err := s.db.Query(`
+		SELECT id, guest_id, full_name, email, notes, created_at
+		FROM companions
+		WHERE guest_id = $1 AND event_id = $2
+		ORDER BY id
+	`, guestID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	companions := make([]types.Companion, 0)
+	for rows.Next() {
+		c, err := scanRowIntoCompanion(rows)
+		if err != nil {
+			return nil, err
+		}
+		companions = append(companions, *c)
+	}
+
+	return companions, rows.Err()
+}
+
+func (s *Store) CreateCompanion(eventID int, companion types.Companion) (*types.Companion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the guest so two requests cannot take the last slot at once
+	var additionals int
+	err = tx.QueryRow(`
+		SELECT additionals FROM guests WHERE id = $1 AND event_id = $2 FOR UPDATE
+	`, companion.GuestID, eventID).Scan(&additionals)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("guest with id %d not found", companion.GuestID)
+		}
+		return nil, err
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM companions WHERE guest_id = $1", companion.GuestID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= additionals {
+		return nil, fmt.Errorf("guest %d already named all of their %d companions", companion.GuestID, additionals)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO companions (event_id, guest_id, full_name, email, notes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, eventID, companion.GuestID, companion.FullName, companion.Email, companion.Notes).Scan(&companion.ID, &companion.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	QueueTicketRebuild(s.db, eventID, []int{companion.GuestID})
+
+	return &companion, nil
+}
+
+func (s *Store) UpdateCompanion(eventID int, companion *types.Companion) error {
+	res, err := s.db.Exec(`
+		UPDATE companions
+		SET full_name = $1, email = $2, notes = $3
+		WHERE id = $4 AND guest_id = $5 AND event_id = $6
+	`, companion.FullName, companion.Email, companion.Notes, companion.ID, companion.GuestID, eventID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("companion with id %d not found", companion.ID)
+	}
+
+	QueueTicketRebuild(s.db, eventID, []int{companion.GuestID})
+
+	return nil
+}
+
+func (s *Store) DeleteCompanion(eventID int, guestID int, companionID int) error {
+	res, err := s.db.Exec("DELETE FROM companions WHERE id = $1 AND guest_id = $2 AND event_id = $3", companionID, guestID, eventID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("companion with id %d not found", companionID)
+	}
+
+	QueueTicketRebuild(s.db, eventID, []int{guestID})
+
+	return nil
+}
+
+// Validates the whole file and, unless it is a dry run or something is wrong,
+// creates every guest (and missing table) in a single transaction
+func (s *Store) ImportGuests(eventID int, rows []types.GuestImportRow, opts types.ImportOptions) (*types.ImportReport, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &types.ImportReport{
+		DryRun:        opts.DryRun,
+		TotalRows:     len(rows),
+		TablesCreated: []string{},
+		Errors:        []types.ImportIssue{},
+		Duplicates:    []types.ImportIssue{},
+	}
+
+	// Guests already in the event
+	existing := make(map[string]bool)
+	nameRows, err := tx.Query("SELECT LOWER(full_name) FROM guests WHERE event_id = $1", eventID)
+	if err != nil {
+		return nil, err
+	}
+	for nameRows.Next() {
+		var name string
+		if err := nameRows.Scan(&name); err != nil {
+			nameRows.Close()
+			return nil, err
+		}
+		existing[name] = true
+	}
+	nameRows.Close()
+
+	// Tables are locked so the free seats cannot change under the import
+	type importTable struct {
+		id   int
+		name string
+		free int
+	}
+	tables := make(map[string]*importTable)
+	tableRows, err := tx.Query(`
+		SELECT t.id, t.name, t.capacity - o.used_seats
+		FROM tables t
+		JOIN table_occupancy o ON o.table_id = t.id
+		WHERE t.event_id = $1
+		FOR UPDATE OF t
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	for tableRows.Next() {
+		t := new(importTable)
+		if err := tableRows.Scan(&t.id, &t.name, &t.free); err != nil {
+			tableRows.Close()
+			return nil, err
+		}
+		tables[strings.ToLower(strings.TrimSpace(t.name))] = t
+	}
+	tableRows.Close()
+
+	// New guests are in no together or apart rule yet, reserved tables apply
+	reserved, err := constraints.ReservedTablesTx(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]int)
+	var newTables []*importTable
+
+	for _, row := range rows {
+		issues := row.Issues
+		key := strings.ToLower(strings.TrimSpace(row.FullName))
+
+		if key != "" {
+			if first, ok := seen[key]; ok {
+				report.Duplicates = append(report.Duplicates, types.ImportIssue{Row: row.Row, Field: "name", Message: fmt.Sprintf("%q is repeated from row %d", row.FullName, first)})
+			} else if existing[key] {
+				report.Duplicates = append(report.Duplicates, types.ImportIssue{Row: row.Row, Field: "name", Message: fmt.Sprintf("guest with name '%s' already exists", row.FullName)})
+			} else {
+				seen[key] = row.Row
+			}
+		}
+
+		if row.TableName != "" {
+			tableKey := strings.ToLower(row.TableName)
+			t, ok := tables[tableKey]
+			if !ok && opts.CreateTables {
+				t = &importTable{name: row.TableName, free: opts.TableCapacity}
+				tables[tableKey] = t
+				newTables = append(newTables, t)
+			}
+
+			seats := 1 + row.Additionals
+			if t == nil {
+				issues = append(issues, types.ImportIssue{Row: row.Row, Field: "table", Message: fmt.Sprintf("table %q does not exist", row.TableName)})
+			} else if t.free < seats {
+				issues = append(issues, types.ImportIssue{Row: row.Row, Field: "table", Message: fmt.Sprintf("not enough space at table %q: needed %d, available %d", row.TableName, seats, t.free)})
+			} else {
+				t.free -= seats
+			}
+
+			// Tables created by the import are not reserved for anyone
+			if t != nil && t.id != 0 {
+				var conflict *types.ConstraintConflict
+				if _, err := constraints.CheckNewGuest(reserved, row.Tags, t.id); errors.As(err, &conflict) {
+					for _, v := range conflict.Violations {
+						issues = append(issues, types.ImportIssue{Row: row.Row, Field: "table", Message: v.Message})
+					}
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if len(issues) == 0 {
+			report.ValidRows++
+		}
+		report.Errors = append(report.Errors, issues...)
+	}
+
+	// All or nothing
+	if opts.DryRun || len(report.Errors) > 0 || len(report.Duplicates) > 0 {
+		return report, nil
+	}
+
+	for _, t := range newTables {
+		err := tx.QueryRow("INSERT INTO tables (event_id, name, capacity) VALUES ($1, $2, $3) RETURNING id", eventID, t.name, opts.TableCapacity).Scan(&t.id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create table %q: %w", t.name, err)
+		}
+		report.TablesCreated = append(report.TablesCreated, t.name)
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		inviteToken, err := utils.RandomToken(24)
+		if err != nil {
+			return nil, err
+		}
+
+		var respondedAt *time.Time
+		if row.RSVPStatus != types.RSVPPending {
+			respondedAt = &now
+		}
+
+		var tableID *int
+		if row.TableName != "" {
+			tableID = &tables[strings.ToLower(row.TableName)].id
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO guests (event_id, full_name, additionals, rsvp_status, responded_at, email, phone, tags, table_id, invite_token)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10)
+		`, eventID, row.FullName, row.Additionals, row.RSVPStatus, respondedAt, row.Email, row.Phone, pq.Array(nonNilTags(row.Tags)), tableID, inviteToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import row %d: %w", row.Row, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	report.Applied = true
+	report.Created = len(rows)
+
+	return report, nil
+}
+
+// Returned when the final layout of a batch does not fit a table
+var ErrNotEnoughSpace = errors.New("not enough space")
+
+// Applies every move and swap of the payload, or none of them
+func (s *Store) BatchSeating(eventID int, payload types.BatchSeatingPayload) ([]types.ConstraintViolation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	warnings, err := BatchSeatingTx(tx, eventID, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	QueueTicketRebuild(s.db, eventID, batchGuestIDs(payload))
+
+	return warnings, nil
+}
+
+// Moves and swaps guests and generals as part of a bigger transaction. Only
+// the final layout has to fit, so full tables can trade parties.
+func BatchSeatingTx(tx *sql.Tx, eventID int, payload types.BatchSeatingPayload) ([]types.ConstraintViolation, error) {
+	var err error
+
+	refs := make([]types.SeatRef, 0, len(payload.Moves)+2*len(payload.Swaps))
+	for _, m := range payload.Moves {
+		refs = append(refs, types.SeatRef{Kind: m.Kind, ID: m.ID})
+	}
+	for _, sw := range payload.Swaps {
+		refs = append(refs, sw.A, sw.B)
+	}
+
+	seen := make(map[types.SeatRef]bool)
+	for _, ref := range refs {
+		if seen[ref] {
+			return nil, fmt.Errorf("%s %d appears more than once", ref.Kind, ref.ID)
+		}
+		seen[ref] = true
+	}
+
+	// Lock every table of the event in the same order, so batches cannot
+	// deadlock each other
+	if _, err := tx.Exec("SELECT id FROM tables WHERE event_id = $1 ORDER BY id FOR UPDATE", eventID); err != nil {
+		return nil, err
+	}
+
+	// Where everyone sits now
+	current := make(map[types.SeatRef]*int)
+	for _, ref := range refs {
+		query := "SELECT table_id FROM guests WHERE id = $1 AND event_id = $2 FOR UPDATE"
+		if ref.Kind == types.SeatGeneral {
+			query = "SELECT table_id FROM generals WHERE id = $1 AND event_id = $2 FOR UPDATE"
+		}
+
+		var tableID *int
+		if err := tx.QueryRow(query, ref.ID, eventID).Scan(&tableID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%s with id %d not found", ref.Kind, ref.ID)
+			}
+			return nil, err
+		}
+		current[ref] = tableID
+	}
+
+	// Where everyone ends up
+	final := make(map[types.SeatRef]*int, len(current))
+	for ref, tableID := range current {
+		final[ref] = tableID
+	}
+	for _, m := range payload.Moves {
+		final[types.SeatRef{Kind: m.Kind, ID: m.ID}] = m.TableID
+	}
+	for _, sw := range payload.Swaps {
+		final[sw.A], final[sw.B] = current[sw.B], current[sw.A]
+	}
+
+	grown := make(map[int]bool)
+	for _, ref := range refs {
+		from, to := current[ref], final[ref]
+		if equalTable(from, to) {
+			continue
+		}
+
+		if to != nil {
+			var exists bool
+			err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tables WHERE id = $1 AND event_id = $2)", *to, eventID).Scan(&exists)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				return nil, fmt.Errorf("table with id %d not found", *to)
+			}
+			grown[*to] = true
+		}
+
+		if ref.Kind == types.SeatGeneral {
+			err = generals.SetGeneralTableTx(tx, eventID, ref.ID, to)
+		} else {
+			_, err = tx.Exec("UPDATE guests SET table_id = $1 WHERE id = $2 AND event_id = $3", to, ref.ID, eventID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to move %s %d: %w", ref.Kind, ref.ID, err)
+		}
+	}
+
+	// Only tables that received people can be over capacity
+	for tableID := range grown {
+		capacity, used, err := utils.TableSeats(tx, eventID, tableID)
+		if err != nil {
+			return nil, err
+		}
+		if used > capacity {
+			return nil, fmt.Errorf("%w at table %d: %d seats for a capacity of %d", ErrNotEnoughSpace, tableID, used, capacity)
+		}
+	}
+
+	warnings := make([]types.ConstraintViolation, 0)
+	for _, ref := range refs {
+		to := final[ref]
+		if to == nil || equalTable(current[ref], to) {
+			continue
+		}
+
+		var violations []types.ConstraintViolation
+		if ref.Kind == types.SeatGeneral {
+			violations, err = constraints.CheckGeneralTx(tx, eventID, ref.ID, *to)
+		} else {
+			violations, err = constraints.CheckGuestTx(tx, eventID, ref.ID, *to)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		warnings = append(warnings, violations...)
+	}
+
+	// A rule broken by several moves is only reported once
+	return constraints.Dedupe(warnings), nil
+}
+
+// Guests moved or swapped by a batch
+func batchGuestIDs(payload types.BatchSeatingPayload) []int {
+	ids := make([]int, 0)
+	for _, m := range payload.Moves {
+		if m.Kind == types.SeatGuest {
+			ids = append(ids, m.ID)
+		}
+	}
+	for _, sw := range payload.Swaps {
+		for _, ref := range []types.SeatRef{sw.A, sw.B} {
+			if ref.Kind == types.SeatGuest {
+				ids = append(ids, ref.ID)
+			}
+		}
+	}
+
+	return ids
+}
+
+func equalTable(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// Queues a rebuild of the tickets of the guests that already have them, so the
+// printed name, companions and table follow the change. The change is already
+// saved at this point, so a failure is only logged.
+func QueueTicketRebuild(db *sql.DB, eventID int, guestIDs []int) {
+	if !config.Envs.AutoRebuildTickets || len(guestIDs) == 0 {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id FROM guests WHERE event_id = $1 AND id = ANY($2) AND ticket_generated = TRUE
+	`, eventID, pq.Array(guestIDs))
+	if err != nil {
+		log.Printf("failed to look up tickets to rebuild: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guestID int
+		if err := rows.Scan(&guestID); err != nil {
+			log.Printf("failed to look up tickets to rebuild: %v", err)
+			return
+		}
+
+		job, err := json.Marshal(queue.TicketRebuildJob{EventID: eventID, GuestID: guestID})
+		if err != nil {
+			log.Printf("failed to marshal TicketRebuild job: %v", err)
+			continue
+		}
+
+		if err := queue.EnqueueJob(context.Background(), queue.TicketRebuildQueue, string(job)); err != nil {
+			log.Printf("failed to queue the ticket rebuild of guest %d: %v", guestID, err)
+		}
+	}
+}
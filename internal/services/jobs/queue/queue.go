@@ -20,6 +20,8 @@ const EmailJobQueue = "email_job_queue"
 
 const FullUploadQueue = "full_upload_jobs"
 
+const TicketRebuildQueue = "ticket_rebuild_jobs"
+
 // Structs for each queue
 type QrUploadJob struct {
 	TicketID   int      `json:"ticketID"`
@@ -46,6 +48,12 @@ type FullUploadJob struct {
 	PDFBase64  string   `json:"pdfBase64"`
 }
 
+type TicketRebuildJob struct {
+	EventID     int  `json:"eventID"`
+	GuestID     int  `json:"guestID"`
+	RotateCodes bool `json:"rotateCodes"`
+}
+
 var (
 	redisClient *redis.Client
 	once        sync.Once
@@ -62,6 +70,11 @@ func getRedisClient() *redis.Client {
 	return redisClient
 }
 
+// Shared with the auth package, which keeps the token revocation list in Redis
+func RedisClient() *redis.Client {
+	return getRedisClient()
+}
+
 func EnqueueJob(ctx context.Context, queueName string, jobPayload string) error {
 	client := getRedisClient()
 	return client.LPush(ctx, queueName, jobPayload).Err()
@@ -0,0 +1,273 @@
+package rsvp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"strconv"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.RSVPStore
+	guestStore types.GuestStore
+}
+
+func NewHandler(store types.RSVPStore, guestStore types.GuestStore) *Handler {
+	return &Handler{store: store, guestStore: guestStore}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Public routes, the secret token is the only credential
+	public := router.PathPrefix("/rsvp").Subrouter()
+
+	public.HandleFunc("/{token}", h.handleGetInvitation).Methods(http.MethodGet)
+	public.HandleFunc("/{token}", h.handleRespondInvitation).Methods(http.MethodPost)
+	public.HandleFunc("/{token}/tickets", h.handleGetInvitationTickets).Methods(http.MethodGet)
+
+	// The host names their own companions
+	public.HandleFunc("/{token}/companions", h.handleCreateCompanion).Methods(http.MethodPost)
+	public.HandleFunc("/{token}/companions/{companionId}", h.handleUpdateCompanion).Methods(http.MethodPatch)
+	public.HandleFunc("/{token}/companions/{companionId}", h.handleDeleteCompanion).Methods(http.MethodDelete)
+}
+
+// @Summary Get an invitation
+// @Description Returns the guest and event data behind a secret RSVP link
+// @Tags rsvp
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Success 200 {object} types.Invitation
+// @Failure 404 {object} types.ErrorResponse
+// @Router /rsvp/{token} [get]
+func (h *Handler) handleGetInvitation(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	inv, err := h.store.GetInvitation(token)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, inv)
+}
+
+// @Summary Answer an invitation
+// @Description Accepts or declines the invitation behind a secret RSVP link, with an optional message. Rejected after the event RSVP deadline
+// @Tags rsvp
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param payload body types.RSVPPayload true "RSVP Payload"
+// @Success 200 {object} types.Invitation
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Router /rsvp/{token} [post]
+func (h *Handler) handleRespondInvitation(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var payload types.RSVPPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	inv, err := h.store.RespondInvitation(token, payload.Status, payload.Message)
+	if errors.Is(err, ErrRSVPClosed) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, inv)
+}
+
+// @Summary Get the tickets of an invitation
+// @Description Returns the QR codes and PDF of a confirmed guest, optionally sending the PDF by email
+// @Tags rsvp
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param email query string false "Optional email to send the ticket PDF"
+// @Success 200 {object} types.ReturnGuestMetadata
+// @Failure 400 {object} types.ErrorResponse
+// @Router /rsvp/{token}/tickets [get]
+func (h *Handler) handleGetInvitationTickets(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	// Get optional email query param
+	email := r.URL.Query().Get("email")
+
+	t, err := h.store.GetInvitationTickets(token, email)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, t)
+}
+
+// @Summary Name a companion
+// @Description Names one of the additionals of the invitation. Rejected after the event RSVP deadline
+// @Tags rsvp
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param payload body types.CreateCompanionPayload true "Companion Payload"
+// @Success 201 {object} types.Companion
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Router /rsvp/{token}/companions [post]
+func (h *Handler) handleCreateCompanion(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.openInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.CreateCompanionPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	c, err := h.guestStore.CreateCompanion(inv.EventID, types.Companion{
+		GuestID:  inv.GuestID,
+		FullName: payload.FullName,
+		Email:    payload.Email,
+		Notes:    payload.Notes,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, c)
+}
+
+// @Summary Update a companion
+// @Description Updates a named companion of the invitation (partial update). Rejected after the event RSVP deadline
+// @Tags rsvp
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param companionId path int true "Companion ID"
+// @Param payload body types.UpdateCompanionPayload true "Companion fields to update"
+// @Success 200 {object} types.Companion
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Router /rsvp/{token}/companions/{companionId} [patch]
+func (h *Handler) handleUpdateCompanion(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.openInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	companionID, err := strconv.Atoi(mux.Vars(r)["companionId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid companion ID"))
+		return
+	}
+
+	var payload types.UpdateCompanionPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	companion, err := guests.FindCompanion(h.guestStore, inv.EventID, inv.GuestID, companionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	guests.ApplyCompanionUpdate(companion, payload)
+
+	if err := h.guestStore.UpdateCompanion(inv.EventID, companion); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, companion)
+}
+
+// @Summary Delete a companion
+// @Description Removes a named companion of the invitation. Rejected after the event RSVP deadline
+// @Tags rsvp
+// @Param token path string true "Invitation token"
+// @Param companionId path int true "Companion ID"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Router /rsvp/{token}/companions/{companionId} [delete]
+func (h *Handler) handleDeleteCompanion(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.openInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	companionID, err := strconv.Atoi(mux.Vars(r)["companionId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid companion ID"))
+		return
+	}
+
+	if err := h.guestStore.DeleteCompanion(inv.EventID, inv.GuestID, companionID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// Loads the invitation behind the token and makes sure it can still be changed
+func (h *Handler) openInvitation(w http.ResponseWriter, r *http.Request) (*types.Invitation, bool) {
+	inv, err := h.store.GetInvitation(mux.Vars(r)["token"])
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	if inv.RSVPClosed(time.Now()) {
+		utils.WriteError(w, http.StatusConflict, ErrRSVPClosed)
+		return nil, false
+	}
+
+	return inv, true
+}
@@ -0,0 +1,170 @@
+package rsvp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+var ErrRSVPClosed = errors.New("the RSVP deadline has passed, answers can no longer be changed")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetInvitation(token string) (*types.Invitation, error) {
+	var inv types.Invitation
+	err := s.db.QueryRow(`
+		SELECT g.event_id, g.id, g.full_name, g.additionals, g.rsvp_status, g.responded_at, g.rsvp_message,
+		       g.ticket_generated, t.name, e.name, e.event_date, e.venue, e.rsvp_deadline
+		FROM guests g
+		JOIN events e ON e.id = g.event_id
+		LEFT JOIN tables t ON t.id = g.table_id
+		WHERE g.invite_token = $1
+	`, token).Scan(
+		&inv.EventID,
+		&inv.GuestID,
+		&inv.GuestName,
+		&inv.Additionals,
+		&inv.RSVPStatus,
+		&inv.RespondedAt,
+		&inv.RSVPMessage,
+		&inv.TicketGenerated,
+		&inv.TableName,
+		&inv.EventName,
+		&inv.EventDate,
+		&inv.Venue,
+		&inv.RSVPDeadline,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation not found")
+		}
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, guest_id, full_name, email, notes, created_at
+		FROM companions
+		WHERE guest_id = $1
+		ORDER BY id
+	`, inv.GuestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inv.Companions = make([]types.Companion, 0)
+	for rows.Next() {
+		var c types.Companion
+		if err := rows.Scan(&c.ID, &c.GuestID, &c.FullName, &c.Email, &c.Notes, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		inv.Companions = append(inv.Companions, c)
+	}
+
+	return &inv, rows.Err()
+}
+
+func (s *Store) RespondInvitation(token string, status string, message *string) (*types.Invitation, error) {
+	inv, err := s.GetInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if inv.RSVPClosed(time.Now()) {
+		return nil, ErrRSVPClosed
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE guests
+		SET rsvp_status = $1, rsvp_message = $2, responded_at = NOW()
+		WHERE invite_token = $3
+	`, status, message, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update attendance confirmation: %w", err)
+	}
+
+	return s.GetInvitation(token)
+}
+
+// Returns the QR and PDF urls of a confirmed guest and, if an email is
+// given, queues the PDF to be sent there
+func (s *Store) GetInvitationTickets(token string, email string) (*types.ReturnGuestMetadata, error) {
+	var (
+		guestID         int
+		rsvpStatus      string
+		ticketGenerated bool
+		qrCodes         []string
+		pdfURL          sql.NullString
+		metadata        types.ReturnGuestMetadata
+	)
+	err := s.db.QueryRow(`
+		SELECT g.id, g.full_name, g.additionals, g.rsvp_status, g.ticket_generated,
+		       g.qr_code_urls, g.pdf_files, t.name
+		FROM guests g
+		LEFT JOIN tables t ON t.id = g.table_id
+		WHERE g.invite_token = $1
+	`, token).Scan(
+		&guestID,
+		&metadata.GuestName,
+		&metadata.Additionals,
+		&rsvpStatus,
+		&ticketGenerated,
+		pq.Array(&qrCodes),
+		&pdfURL,
+		&metadata.TableName,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation not found")
+		}
+		return nil, err
+	}
+
+	if rsvpStatus != types.RSVPAccepted {
+		return nil, fmt.Errorf("guest must confirm attendance before getting the tickets")
+	}
+
+	if !ticketGenerated || !pdfURL.Valid || pdfURL.String == "" {
+		return nil, fmt.Errorf("tickets are not ready yet")
+	}
+
+	metadata.QRCodes = qrCodes
+	metadata.PDFiles = pdfURL.String
+
+	// Send the email
+	if email != "" {
+		job := queue.EmailSendJob{
+			GuestID:   guestID,
+			Recipient: email,
+			PDFURL:    pdfURL.String,
+		}
+
+		jobJson, err := json.Marshal(job)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal email job: %w", err)
+		}
+
+		if err := queue.EnqueueJob(context.Background(), queue.EmailJobQueue, string(jobJson)); err != nil {
+			return nil, fmt.Errorf("failed to enqueue email job: %w", err)
+		}
+
+		if _, err := s.db.Exec(`UPDATE guests SET ticket_sent = TRUE WHERE id = $1`, guestID); err != nil {
+			return nil, fmt.Errorf("failed to update guest status %w", err)
+		}
+	}
+
+	return &metadata, nil
+}
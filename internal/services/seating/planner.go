@@ -0,0 +1,341 @@
+package seating
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+// Guests that have to be seated as one block: a guest with their additionals,
+// or several parties joined by a "together" group
+type party struct {
+	guests []types.PlannerGuest
+	seats  int
+	tags   map[string]bool
+	// Table of an already seated member of a "together" group
+	pinned *int
+	// Set when the party cannot be placed whatever the tables look like
+	invalid string
+}
+
+type plannerTable struct {
+	table  types.PlannerTable
+	free   int
+	guests map[int]bool
+	tags   map[string]int
+	// Tags a guest needs to sit here, from "reserved" constraints
+	reserved []string
+}
+
+// Proposes a table for every unseated guest without splitting parties. Guests
+// already seated stay where they are. Parties are placed biggest first at the
+// table that shares the most tags with them, then at the one they fill best.
+// The saved constraints of the state are honored along with the payload ones.
+func Plan(state *types.SeatingState, payload types.PlanSeatingPayload) types.SeatingPlan {
+	plan := types.SeatingPlan{
+		Guests:   []types.GuestPlacement{},
+		Generals: []types.GeneralPlacement{},
+		Unplaced: []types.UnplacedParty{},
+		Tables:   []types.PlannedTable{},
+	}
+
+	tables := make([]*plannerTable, 0, len(state.Tables))
+	tablesByID := make(map[int]*plannerTable)
+	for _, t := range state.Tables {
+		pt := &plannerTable{table: t, free: t.Capacity - t.UsedSeats, guests: map[int]bool{}, tags: map[string]int{}}
+		tables = append(tables, pt)
+		tablesByID[t.ID] = pt
+	}
+
+	guests := make(map[int]types.PlannerGuest)
+	for _, g := range state.Guests {
+		guests[g.ID] = g
+		if g.TableID == nil {
+			continue
+		}
+		if t, ok := tablesByID[*g.TableID]; ok {
+			t.guests[g.ID] = true
+			for _, tag := range g.Tags {
+				t.tags[tag]++
+			}
+		}
+	}
+
+	together := payload.Together
+	apartGroups := payload.Apart
+	for _, c := range state.Constraints {
+		switch c.Kind {
+		case types.ConstraintTogether:
+			together = append(together, c.GuestIDs)
+		case types.ConstraintApart:
+			apartGroups = append(apartGroups, c.GuestIDs)
+		case types.ConstraintReserved:
+			if c.TableID == nil || c.Tag == nil {
+				continue
+			}
+			if t, ok := tablesByID[*c.TableID]; ok {
+				t.reserved = append(t.reserved, *c.Tag)
+			}
+		}
+	}
+
+	apart := apartPairs(apartGroups)
+	parties := buildParties(guests, together, apart)
+
+	for _, p := range parties {
+		ids := partyIDs(p)
+
+		if p.invalid != "" {
+			plan.Unplaced = append(plan.Unplaced, types.UnplacedParty{GuestIDs: ids, Seats: p.seats, Reason: p.invalid})
+			continue
+		}
+
+		table, reason := pickTable(p, tables, tablesByID, apart)
+		if table == nil {
+			plan.Unplaced = append(plan.Unplaced, types.UnplacedParty{GuestIDs: ids, Seats: p.seats, Reason: reason})
+			continue
+		}
+
+		table.free -= p.seats
+		for _, g := range p.guests {
+			table.guests[g.ID] = true
+			for _, tag := range g.Tags {
+				table.tags[tag]++
+			}
+			plan.Guests = append(plan.Guests, types.GuestPlacement{
+				GuestID:   g.ID,
+				FullName:  g.FullName,
+				Seats:     g.Seats,
+				TableID:   table.table.ID,
+				TableName: table.table.Name,
+			})
+		}
+	}
+
+	// Generals take whatever seats are left, in table order, away from
+	// reserved tables
+	if payload.IncludeGenerals {
+		i := 0
+		for _, gen := range state.Generals {
+			if gen.TableId != nil {
+				continue
+			}
+			for i < len(tables) && (tables[i].free <= 0 || len(tables[i].reserved) > 0) {
+				i++
+			}
+			if i == len(tables) {
+				break
+			}
+
+			tables[i].free--
+			plan.Generals = append(plan.Generals, types.GeneralPlacement{
+				GeneralID: gen.ID,
+				Folio:     gen.Folio,
+				TableID:   tables[i].table.ID,
+				TableName: tables[i].table.Name,
+			})
+		}
+	}
+
+	for _, t := range tables {
+		plan.Tables = append(plan.Tables, types.PlannedTable{
+			ID:        t.table.ID,
+			Name:      t.table.Name,
+			Capacity:  t.table.Capacity,
+			UsedSeats: t.table.Capacity - t.free,
+			FreeSeats: t.free,
+		})
+	}
+
+	return plan
+}
+
+func apartPairs(groups [][]int) map[[2]int]bool {
+	pairs := make(map[[2]int]bool)
+	for _, group := range groups {
+		for i := range group {
+			for j := range group {
+				if group[i] != group[j] {
+					pairs[[2]int{group[i], group[j]}] = true
+				}
+			}
+		}
+	}
+
+	return pairs
+}
+
+// Joins the unseated guests of every "together" group into a single party
+func buildParties(guests map[int]types.PlannerGuest, together [][]int, apart map[[2]int]bool) []*party {
+	parent := make(map[int]int)
+	var find func(int) int
+	find = func(id int) int {
+		if p, ok := parent[id]; ok && p != id {
+			parent[id] = find(p)
+			return parent[id]
+		}
+		return id
+	}
+
+	for _, group := range together {
+		root := 0
+		for _, id := range group {
+			if _, ok := guests[id]; !ok {
+				continue
+			}
+			if root == 0 {
+				root = find(id)
+				continue
+			}
+			parent[find(id)] = root
+		}
+	}
+
+	byRoot := make(map[int]*party)
+	for _, g := range guests {
+		root := find(g.ID)
+		p, ok := byRoot[root]
+		if !ok {
+			p = &party{tags: map[string]bool{}}
+			byRoot[root] = p
+		}
+
+		// Seated members only pin the party to their table
+		if g.TableID != nil {
+			if p.pinned != nil && *p.pinned != *g.TableID {
+				p.invalid = "members of a together group are already seated at different tables"
+			}
+			tableID := *g.TableID
+			p.pinned = &tableID
+			continue
+		}
+
+		p.guests = append(p.guests, g)
+		p.seats += g.Seats
+		for _, tag := range g.Tags {
+			p.tags[tag] = true
+		}
+	}
+
+	parties := make([]*party, 0, len(byRoot))
+	for _, p := range byRoot {
+		if len(p.guests) == 0 {
+			continue
+		}
+
+		sort.Slice(p.guests, func(i, j int) bool { return p.guests[i].ID < p.guests[j].ID })
+		for i := range p.guests {
+			for j := i + 1; j < len(p.guests); j++ {
+				if apart[[2]int{p.guests[i].ID, p.guests[j].ID}] {
+					p.invalid = fmt.Sprintf("guests %d and %d must sit together and apart at the same time", p.guests[i].ID, p.guests[j].ID)
+				}
+			}
+		}
+
+		parties = append(parties, p)
+	}
+
+	// Pinned parties first, then biggest first so the large ones still fit
+	sort.Slice(parties, func(i, j int) bool {
+		a, b := parties[i], parties[j]
+		if (a.pinned != nil) != (b.pinned != nil) {
+			return a.pinned != nil
+		}
+		if a.seats != b.seats {
+			return a.seats > b.seats
+		}
+		return a.guests[0].ID < b.guests[0].ID
+	})
+
+	return parties
+}
+
+func pickTable(p *party, tables []*plannerTable, tablesByID map[int]*plannerTable, apart map[[2]int]bool) (*plannerTable, string) {
+	candidates := tables
+	if p.pinned != nil {
+		t, ok := tablesByID[*p.pinned]
+		if !ok {
+			return nil, fmt.Sprintf("table %d does not exist", *p.pinned)
+		}
+		candidates = []*plannerTable{t}
+	}
+
+	var best *plannerTable
+	bestShared, bestLeft := -1, 0
+	roomy, allowed := false, false
+
+	for _, t := range candidates {
+		if t.free < p.seats {
+			continue
+		}
+		roomy = true
+
+		if !admits(t, p) {
+			continue
+		}
+		allowed = true
+
+		if conflictsWith(p, t, apart) {
+			continue
+		}
+
+		shared := 0
+		for tag := range p.tags {
+			shared += t.tags[tag]
+		}
+		left := t.free - p.seats
+
+		if best == nil || shared > bestShared || (shared == bestShared && left < bestLeft) {
+			best, bestShared, bestLeft = t, shared, left
+		}
+	}
+
+	switch {
+	case best != nil:
+		return best, ""
+	case !roomy && p.pinned != nil:
+		return nil, fmt.Sprintf("not enough free seats at table %d for a party of %d", *p.pinned, p.seats)
+	case !roomy:
+		return nil, fmt.Sprintf("no table has %d free seats", p.seats)
+	case !allowed:
+		return nil, "every table with room is reserved for other guests"
+	default:
+		return nil, "every table with room has a guest this party must be kept apart from"
+	}
+}
+
+// Whether every member of the party has the tags the table is reserved for
+func admits(t *plannerTable, p *party) bool {
+	for _, tag := range t.reserved {
+		for _, g := range p.guests {
+			if !slices.Contains(g.Tags, tag) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func conflictsWith(p *party, t *plannerTable, apart map[[2]int]bool) bool {
+	for _, g := range p.guests {
+		for seated := range t.guests {
+			if apart[[2]int{g.ID, seated}] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func partyIDs(p *party) []int {
+	ids := make([]int, 0, len(p.guests))
+	for _, g := range p.guests {
+		ids = append(ids, g.ID)
+	}
+
+	return ids
+}
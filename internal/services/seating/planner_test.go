@@ -0,0 +1,140 @@
+package seating
+
+import (
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func placements(plan types.SeatingPlan) map[int]int {
+	tables := make(map[int]int)
+	for _, g := range plan.Guests {
+		tables[g.GuestID] = g.TableID
+	}
+
+	return tables
+}
+
+func TestPlan(t *testing.T) {
+	t.Run("should not split parties and fill the tightest table", func(t *testing.T) {
+		state := &types.SeatingState{
+			Tables: []types.PlannerTable{
+				{ID: 1, Name: "Mesa 1", Capacity: 10},
+				{ID: 2, Name: "Mesa 2", Capacity: 5},
+			},
+			Guests: []types.PlannerGuest{
+				{ID: 1, FullName: "Juan", Seats: 4},
+				{ID: 2, FullName: "Ana", Seats: 6},
+				{ID: 3, FullName: "Luis", Seats: 5},
+				{ID: 4, FullName: "Pedro", Seats: 3},
+			},
+		}
+
+		plan := Plan(state, types.PlanSeatingPayload{})
+		tables := placements(plan)
+
+		if tables[1] != 1 || tables[2] != 1 || tables[3] != 2 {
+			t.Errorf("unexpected placements %v", tables)
+		}
+		if len(plan.Unplaced) != 1 || plan.Unplaced[0].GuestIDs[0] != 4 {
+			t.Errorf("expected Pedro to be unplaced, got %+v", plan.Unplaced)
+		}
+	})
+
+	t.Run("should keep groups together and apart", func(t *testing.T) {
+		state := &types.SeatingState{
+			Tables: []types.PlannerTable{
+				{ID: 1, Name: "Mesa 1", Capacity: 6, UsedSeats: 2},
+				{ID: 2, Name: "Mesa 2", Capacity: 6},
+			},
+			Guests: []types.PlannerGuest{
+				{ID: 1, FullName: "Juan", Seats: 2, TableID: intPtr(1)},
+				{ID: 2, FullName: "Ana", Seats: 1},
+				{ID: 3, FullName: "Luis", Seats: 2},
+				{ID: 4, FullName: "Pedro", Seats: 1},
+			},
+		}
+
+		plan := Plan(state, types.PlanSeatingPayload{
+			Together: [][]int{{1, 3}},
+			Apart:    [][]int{{1, 4}},
+		})
+		tables := placements(plan)
+
+		if tables[3] != 1 {
+			t.Errorf("expected Luis next to Juan, got %v", tables)
+		}
+		if tables[4] != 2 {
+			t.Errorf("expected Pedro away from Juan, got %v", tables)
+		}
+		if len(plan.Unplaced) != 0 {
+			t.Errorf("unexpected unplaced %+v", plan.Unplaced)
+		}
+	})
+
+	t.Run("should prefer tables sharing tags", func(t *testing.T) {
+		state := &types.SeatingState{
+			Tables: []types.PlannerTable{
+				{ID: 1, Name: "Mesa 1", Capacity: 4, UsedSeats: 1},
+				{ID: 2, Name: "Mesa 2", Capacity: 10, UsedSeats: 1},
+			},
+			Guests: []types.PlannerGuest{
+				{ID: 1, FullName: "Juan", Seats: 1, Tags: []string{"trabajo"}, TableID: intPtr(1)},
+				{ID: 2, FullName: "Ana", Seats: 1, Tags: []string{"familia"}, TableID: intPtr(2)},
+				{ID: 3, FullName: "Luis", Seats: 1, Tags: []string{"familia"}},
+			},
+		}
+
+		if tables := placements(Plan(state, types.PlanSeatingPayload{})); tables[3] != 2 {
+			t.Errorf("expected Luis at the family table, got %v", tables)
+		}
+	})
+
+	t.Run("should fill free seats with generals", func(t *testing.T) {
+		state := &types.SeatingState{
+			Tables: []types.PlannerTable{{ID: 1, Name: "Mesa 1", Capacity: 2, UsedSeats: 1}},
+			Generals: []types.General{
+				{ID: 1, Folio: 1},
+				{ID: 2, Folio: 2},
+			},
+		}
+
+		plan := Plan(state, types.PlanSeatingPayload{IncludeGenerals: true})
+		if len(plan.Generals) != 1 || plan.Tables[0].FreeSeats != 0 {
+			t.Errorf("unexpected plan %+v", plan)
+		}
+	})
+
+	t.Run("should honor reserved tables", func(t *testing.T) {
+		tableID := 1
+		tag := "familia"
+		state := &types.SeatingState{
+			Tables: []types.PlannerTable{
+				{ID: 1, Name: "Mesa 1", Capacity: 4},
+				{ID: 2, Name: "Mesa 2", Capacity: 10},
+			},
+			Guests: []types.PlannerGuest{
+				{ID: 1, FullName: "Juan", Seats: 2},
+				{ID: 2, FullName: "Ana", Seats: 2, Tags: []string{"familia"}},
+			},
+			Generals: []types.General{{ID: 1, Folio: 1}},
+			Constraints: []types.SeatingConstraint{
+				{ID: 1, Kind: types.ConstraintReserved, TableID: &tableID, Tag: &tag},
+			},
+		}
+
+		plan := Plan(state, types.PlanSeatingPayload{IncludeGenerals: true})
+		tables := placements(plan)
+
+		if tables[1] != 2 || tables[2] != 1 {
+			t.Errorf("unexpected placements %v", tables)
+		}
+		if len(plan.Generals) != 1 || plan.Generals[0].TableID != 2 {
+			t.Errorf("expected the general away from the reserved table, got %+v", plan.Generals)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package seating
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/diegob0/rspv_backend/internal/services/auth"
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.SeatingStore
+}
+
+func NewHandler(store types.SeatingStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Router handler
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Protected routes
+	protected := router.PathPrefix("/seating").Subrouter()
+	protected.Use(auth.AuthMiddleware)
+
+	protected.HandleFunc("/plan", auth.RequirePermission(auth.PermRead, h.handlePlanSeating)).Methods(http.MethodPost)
+	protected.HandleFunc("/apply", auth.RequirePermission(auth.PermWrite, h.handleApplySeating)).Methods(http.MethodPost)
+}
+
+// @Summary Propose a seating plan
+// @Description Proposes a table for every confirmed guest without one, keeping parties and "together" groups at the same table and "apart" groups at different ones. Nothing is saved.
+// @Tags seating
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.PlanSeatingPayload true "Seating preferences"
+// @Success 200 {object} types.SeatingPlan
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/seating/plan [post]
+func (h *Handler) handlePlanSeating(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.PlanSeatingPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	state, err := h.store.GetSeatingState(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, Plan(state, payload))
+}
+
+// @Summary Apply a seating plan
+// @Description Seats the given guests and generals in a single transaction, if the final layout does not fit or breaks a strict constraint nothing is saved
+// @Tags seating
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.ApplySeatingPayload true "Assignments, usually the ones returned by /seating/plan"
+// @Success 200 {object} types.AssignResponse
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ConflictResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/seating/apply [post]
+func (h *Handler) handleApplySeating(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.ApplySeatingPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	if len(payload.Guests) == 0 && len(payload.Generals) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("nothing to apply"))
+		return
+	}
+
+	warnings, err := h.store.ApplySeating(eventID, payload)
+	if err != nil {
+		if errors.Is(err, guests.ErrNotEnoughSpace) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteSeatingError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.AssignResponse{Warnings: warnings})
+}
@@ -0,0 +1,136 @@
+package seating
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/services/constraints"
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Tables with their occupancy, every seated guest, the confirmed guests and
+// generals that still need a table, and the seating constraints
+func (s *Store) GetSeatingState(eventID int) (*types.SeatingState, error) {
+	state := &types.SeatingState{
+		Tables:   []types.PlannerTable{},
+		Guests:   []types.PlannerGuest{},
+		Generals: []types.General{},
+	}
+
+	tableRows, err := s.db.Query(`
+		SELECT t.id, t.name, t.capacity, o.used_seats
+		FROM tables t
+		JOIN table_occupancy o ON o.table_id = t.id
+		WHERE t.event_id = $1
+		ORDER BY t.id
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tables: %w", err)
+	}
+	defer tableRows.Close()
+
+	for tableRows.Next() {
+		var t types.PlannerTable
+		if err := tableRows.Scan(&t.ID, &t.Name, &t.Capacity, &t.UsedSeats); err != nil {
+			return nil, err
+		}
+		state.Tables = append(state.Tables, t)
+	}
+	if err := tableRows.Err(); err != nil {
+		return nil, err
+	}
+
+	guestRows, err := s.db.Query(`
+		SELECT id, full_name, 1 + additionals, tags, table_id
+		FROM guests
+		WHERE event_id = $1 AND (table_id IS NOT NULL OR rsvp_status = $2)
+		ORDER BY id
+	`, eventID, types.RSVPAccepted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guests: %w", err)
+	}
+	defer guestRows.Close()
+
+	for guestRows.Next() {
+		var g types.PlannerGuest
+		if err := guestRows.Scan(&g.ID, &g.FullName, &g.Seats, pq.Array(&g.Tags), &g.TableID); err != nil {
+			return nil, err
+		}
+		state.Guests = append(state.Guests, g)
+	}
+	if err := guestRows.Err(); err != nil {
+		return nil, err
+	}
+
+	genRows, err := s.db.Query(`
+		SELECT id, folio, table_id FROM generals WHERE event_id = $1 ORDER BY folio
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch generals: %w", err)
+	}
+	defer genRows.Close()
+
+	for genRows.Next() {
+		var gen types.General
+		if err := genRows.Scan(&gen.ID, &gen.Folio, &gen.TableId); err != nil {
+			return nil, err
+		}
+		state.Generals = append(state.Generals, gen)
+	}
+	if err := genRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The saved rules are honored on top of the ones sent with the request
+	state.Constraints, err = constraints.NewStore(s.db).GetConstraints(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Seats every guest and general of the payload, or none of them. Capacity is
+// checked against the final layout.
+func (s *Store) ApplySeating(eventID int, payload types.ApplySeatingPayload) ([]types.ConstraintViolation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var batch types.BatchSeatingPayload
+	for _, a := range payload.Guests {
+		batch.Moves = append(batch.Moves, types.SeatingMove{Kind: types.SeatGuest, ID: a.GuestID, TableID: &a.TableID})
+	}
+	for _, a := range payload.Generals {
+		batch.Moves = append(batch.Moves, types.SeatingMove{Kind: types.SeatGeneral, ID: a.GeneralID, TableID: &a.TableID})
+	}
+
+	warnings, err := guests.BatchSeatingTx(tx, eventID, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	guestIDs := make([]int, 0, len(payload.Guests))
+	for _, a := range payload.Guests {
+		guestIDs = append(guestIDs, a.GuestID)
+	}
+	guests.QueueTicketRebuild(s.db, eventID, guestIDs)
+
+	return warnings, nil
+}
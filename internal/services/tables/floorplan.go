@@ -0,0 +1,367 @@
+package tables
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Names printed for fixtures without a label
+var fixtureLabels = map[string]string{
+	"dance_floor": "Pista",
+	"stage":       "Escenario",
+	"bar":         "Barra",
+	"dj":          "DJ",
+	"entrance":    "Entrada",
+	"buffet":      "Buffet",
+}
+
+const (
+	// Space around the drawing and between unplaced tables, in meters
+	planMargin = 1.0
+	planGap    = 0.8
+	// Unplaced tables are lined up under the room, this many per row
+	unplacedPerRow    = 8
+	svgPixelsPerMeter = 50
+	// Large rooms are scaled down so the PNG stays under this many pixels a side
+	pngMaxSide = 4000
+)
+
+// Something to draw, in meters
+type planShape struct {
+	x, y, width, height, rotation float64
+	round                         bool
+	fill                          [3]int
+	dashed                        bool
+	lines                         []string
+}
+
+type planBounds struct {
+	minX, minY, maxX, maxY float64
+}
+
+func (b planBounds) width() float64  { return b.maxX - b.minX }
+func (b planBounds) height() float64 { return b.maxY - b.minY }
+
+// Turns the plan into shapes, tables that were never placed go in rows
+// under the room so they still show up
+func layoutFloorPlan(plan *types.FloorPlan) ([]planShape, planBounds) {
+	shapes := make([]planShape, 0, len(plan.Fixtures)+len(plan.Tables))
+	bounds := planBounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+
+	grow := func(s planShape) {
+		// Half diagonal, enough for any rotation
+		r := math.Hypot(s.width, s.height) / 2
+		bounds.minX = math.Min(bounds.minX, s.x-r)
+		bounds.minY = math.Min(bounds.minY, s.y-r)
+		bounds.maxX = math.Max(bounds.maxX, s.x+r)
+		bounds.maxY = math.Max(bounds.maxY, s.y+r)
+	}
+
+	for _, f := range plan.Fixtures {
+		label := fixtureLabels[f.Kind]
+		if f.Label != nil && *f.Label != "" {
+			label = *f.Label
+		}
+
+		s := planShape{
+			x: f.X, y: f.Y, width: f.Width, height: f.Height, rotation: f.Rotation,
+			fill: [3]int{236, 236, 236}, dashed: true, lines: []string{label},
+		}
+		shapes = append(shapes, s)
+		grow(s)
+	}
+
+	var unplaced []*types.TableAndGuests
+	for _, t := range plan.Tables {
+		if t.Geometry.X == nil || t.Geometry.Y == nil {
+			unplaced = append(unplaced, t)
+			continue
+		}
+
+		s := tableShape(t, *t.Geometry.X, *t.Geometry.Y)
+		shapes = append(shapes, s)
+		grow(s)
+	}
+
+	if math.IsInf(bounds.minX, 1) {
+		bounds = planBounds{0, 0, 0, 0}
+	}
+
+	startX, y := bounds.minX, bounds.maxY+planGap
+	x, rowHeight := startX, 0.0
+	for i, t := range unplaced {
+		if i > 0 && i%unplacedPerRow == 0 {
+			x, y = startX, y+rowHeight+planGap
+			rowHeight = 0
+		}
+
+		w, h := t.Geometry.Width, t.Geometry.Height
+		s := tableShape(t, x+w/2, y+h/2)
+		s.rotation = 0
+		shapes = append(shapes, s)
+		grow(s)
+
+		x += w + planGap
+		rowHeight = math.Max(rowHeight, h)
+	}
+
+	bounds.minX -= planMargin
+	bounds.minY -= planMargin
+	bounds.maxX += planMargin
+	bounds.maxY += planMargin
+
+	return shapes, bounds
+}
+
+func tableShape(t *types.TableAndGuests, x, y float64) planShape {
+	return planShape{
+		x:        x,
+		y:        y,
+		width:    t.Geometry.Width,
+		height:   t.Geometry.Height,
+		rotation: t.Geometry.Rotation,
+		round:    t.Geometry.Shape == types.ShapeRound,
+		fill:     occupancyColor(t.UsedSeats, t.Capacity),
+		lines:    []string{t.Name, fmt.Sprintf("%d/%d", t.UsedSeats, t.Capacity)},
+	}
+}
+
+// White when empty, green while there is room, gray when full, red when over
+func occupancyColor(used, capacity int) [3]int {
+	switch {
+	case used > capacity:
+		return [3]int{248, 215, 218}
+	case used == capacity && used > 0:
+		return [3]int{207, 216, 220}
+	case used > 0:
+		return [3]int{217, 242, 217}
+	default:
+		return [3]int{255, 255, 255}
+	}
+}
+
+func RenderFloorPlanSVG(w io.Writer, plan *types.FloorPlan) error {
+	shapes, b := layoutFloorPlan(plan)
+
+	// Room for the title above the room
+	titleHeight := 1.0
+	b.minY -= titleHeight
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%.2f %.2f %.2f %.2f" width="%.0f" height="%.0f" font-family="Arial, sans-serif">`+"\n",
+		b.minX, b.minY, b.width(), b.height(), b.width()*svgPixelsPerMeter, b.height()*svgPixelsPerMeter)
+	fmt.Fprintf(&sb, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="#ffffff"/>`+"\n", b.minX, b.minY, b.width(), b.height())
+	fmt.Fprintf(&sb, `<text x="%.2f" y="%.2f" font-size="0.5" font-weight="bold">%s</text>`+"\n",
+		b.minX+planMargin, b.minY+titleHeight, html.EscapeString(plan.EventName))
+
+	for _, s := range shapes {
+		fill := fmt.Sprintf("#%02x%02x%02x", s.fill[0], s.fill[1], s.fill[2])
+		dash := ""
+		if s.dashed {
+			dash = ` stroke-dasharray="0.15 0.1"`
+		}
+
+		fmt.Fprintf(&sb, `<g transform="rotate(%.2f %.2f %.2f)">`, s.rotation, s.x, s.y)
+		if s.round {
+			fmt.Fprintf(&sb, `<ellipse cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f" fill="%s" stroke="#333333" stroke-width="0.04"%s/>`,
+				s.x, s.y, s.width/2, s.height/2, fill, dash)
+		} else {
+			fmt.Fprintf(&sb, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s" stroke="#333333" stroke-width="0.04"%s/>`,
+				s.x-s.width/2, s.y-s.height/2, s.width, s.height, fill, dash)
+		}
+		sb.WriteString("</g>")
+
+		// Text stays horizontal so it can be read
+		fontSize := math.Min(0.3, s.height/float64(len(s.lines)+1))
+		top := s.y - fontSize*float64(len(s.lines)-1)/2
+		for i, line := range s.lines {
+			fmt.Fprintf(&sb, `<text x="%.2f" y="%.2f" font-size="%.2f" text-anchor="middle" dominant-baseline="middle">%s</text>`,
+				s.x, top+float64(i)*fontSize*1.1, fontSize, html.EscapeString(line))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Same drawing as the SVG, scaled to a landscape page for printing
+func RenderFloorPlanPDF(w io.Writer, plan *types.FloorPlan, paper string) error {
+	shapes, b := layoutFloorPlan(plan)
+
+	pdf := gofpdf.New("L", "mm", paper, "")
+	utils.AddPDFFonts(pdf)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+
+	left, top, right, bottom := pdf.GetMargins()
+	pageW, pageH := pdf.GetPageSize()
+
+	pdf.SetFont(utils.PDFFont, "B", 14)
+	pdf.CellFormat(0, 8, plan.EventName, "", 1, "L", false, 0, "")
+	titleHeight := 10.0
+
+	scale := math.Min((pageW-left-right)/b.width(), (pageH-top-bottom-titleHeight)/b.height())
+	toX := func(x float64) float64 { return left + (x-b.minX)*scale }
+	toY := func(y float64) float64 { return top + titleHeight + (y-b.minY)*scale }
+
+	pdf.SetLineWidth(0.3)
+	pdf.SetDrawColor(51, 51, 51)
+	for _, s := range shapes {
+		x, y := toX(s.x), toY(s.y)
+		width, height := s.width*scale, s.height*scale
+
+		pdf.SetFillColor(s.fill[0], s.fill[1], s.fill[2])
+		if s.dashed {
+			pdf.SetDashPattern([]float64{2, 1}, 0)
+		}
+
+		// gofpdf turns counterclockwise, SVG clockwise
+		pdf.TransformBegin()
+		pdf.TransformRotate(-s.rotation, x, y)
+		if s.round {
+			pdf.Ellipse(x, y, width/2, height/2, 0, "FD")
+		} else {
+			pdf.Rect(x-width/2, y-height/2, width, height, "FD")
+		}
+		pdf.TransformEnd()
+		pdf.SetDashPattern([]float64{}, 0)
+
+		fontSize := math.Min(10, height/float64(len(s.lines)+1)/0.35)
+		lineHeight := fontSize * 0.4
+		pdf.SetFont(utils.PDFFont, "", fontSize)
+		pdf.SetXY(x-width, y-lineHeight*float64(len(s.lines))/2)
+		for _, line := range s.lines {
+			pdf.SetX(x - width)
+			pdf.CellFormat(width*2, lineHeight, line, "", 2, "C", false, 0, "")
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+// Same drawing as the SVG as a raster image, for chats and screens that do not
+// show SVG
+func RenderFloorPlanPNG(w io.Writer, plan *types.FloorPlan) error {
+	shapes, b := layoutFloorPlan(plan)
+
+	titleHeight := 1.0
+	b.minY -= titleHeight
+
+	scale := float64(svgPixelsPerMeter)
+	if side := math.Max(b.width(), b.height()) * scale; side > pngMaxSide {
+		scale *= pngMaxSide / side
+	}
+	toX := func(x float64) float64 { return (x - b.minX) * scale }
+	toY := func(y float64) float64 { return (y - b.minY) * scale }
+
+	width, height := int(math.Ceil(b.width()*scale)), int(math.Ceil(b.height()*scale))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	regular, bold := utils.FontBytes()
+	regularFont, err := opentype.Parse(regular)
+	if err != nil {
+		return fmt.Errorf("failed to read the font: %w", err)
+	}
+	boldFont, err := opentype.Parse(bold)
+	if err != nil {
+		return fmt.Errorf("failed to read the font: %w", err)
+	}
+
+	if err := drawText(img, boldFont, plan.EventName, 0.5*scale, toX(b.minX+planMargin), toY(b.minY+titleHeight), false); err != nil {
+		return err
+	}
+
+	stroke := 0.04 * scale
+	for _, s := range shapes {
+		outline := color.RGBA{51, 51, 51, 255}
+		if s.dashed {
+			// Fixtures get a lighter outline instead of the dashes
+			outline = color.RGBA{150, 150, 150, 255}
+		}
+
+		x, y := toX(s.x), toY(s.y)
+		fillPolygon(img, shapePolygon(s, x, y, s.width*scale/2, s.height*scale/2), outline)
+		fillPolygon(img, shapePolygon(s, x, y, s.width*scale/2-stroke, s.height*scale/2-stroke), color.RGBA{uint8(s.fill[0]), uint8(s.fill[1]), uint8(s.fill[2]), 255})
+
+		fontSize := math.Min(0.3, s.height/float64(len(s.lines)+1)) * scale
+		top := y - fontSize*float64(len(s.lines)-1)/2
+		for i, line := range s.lines {
+			if err := drawText(img, regularFont, line, fontSize, x, top+float64(i)*fontSize*1.1, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// Corners of the shape in pixels, round shapes as a polygon, turned clockwise
+// like the SVG
+func shapePolygon(s planShape, cx, cy, rx, ry float64) [][2]float64 {
+	var points [][2]float64
+	if s.round {
+		for i := 0; i < 64; i++ {
+			a := 2 * math.Pi * float64(i) / 64
+			points = append(points, [2]float64{rx * math.Cos(a), ry * math.Sin(a)})
+		}
+	} else {
+		points = [][2]float64{{-rx, -ry}, {rx, -ry}, {rx, ry}, {-rx, ry}}
+	}
+
+	sin, cos := math.Sincos(s.rotation * math.Pi / 180)
+	for i, p := range points {
+		points[i] = [2]float64{cx + p[0]*cos - p[1]*sin, cy + p[0]*sin + p[1]*cos}
+	}
+
+	return points
+}
+
+func fillPolygon(img *image.RGBA, points [][2]float64, c color.Color) {
+	bounds := img.Bounds()
+	r := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	r.MoveTo(float32(points[0][0]), float32(points[0][1]))
+	for _, p := range points[1:] {
+		r.LineTo(float32(p[0]), float32(p[1]))
+	}
+	r.ClosePath()
+	r.Draw(img, bounds, image.NewUniform(c), image.Point{})
+}
+
+// Writes one line with its baseline at y, centered on x when center is set
+func drawText(img *image.RGBA, f *opentype.Font, text string, size float64, x, y float64, center bool) error {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return fmt.Errorf("failed to load the font: %w", err)
+	}
+	defer face.Close()
+
+	d := &font.Drawer{Dst: img, Src: image.Black, Face: face}
+	if center {
+		x -= float64(d.MeasureString(text)) / 64 / 2
+		// Middle of the line on y, like dominant-baseline="middle"
+		y += float64(face.Metrics().CapHeight) / 64 / 2
+	}
+	d.Dot = fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+	d.DrawString(text)
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package tables
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestFloorPlan(t *testing.T) {
+	x, y := 3.0, 2.0
+	label := "Pista & DJ"
+	plan := &types.FloorPlan{
+		EventName: "Boda",
+		Tables: []*types.TableAndGuests{
+			{ID: 1, Name: "Mesa 1", Capacity: 10, UsedSeats: 10, Geometry: types.TableGeometry{X: &x, Y: &y, Shape: types.ShapeRound, Width: 1.8, Height: 1.8}},
+			{ID: 2, Name: "Mesa 2", Capacity: 8, UsedSeats: 9, Geometry: types.TableGeometry{Shape: types.ShapeRectangle, Width: 2.4, Height: 1}},
+		},
+		Fixtures: []types.FloorFixture{
+			{ID: 1, Kind: "dance_floor", Label: &label, X: 8, Y: 2, Width: 4, Height: 4},
+			{ID: 2, Kind: "stage", X: 8, Y: 6, Width: 4, Height: 2, Rotation: 90},
+		},
+	}
+
+	t.Run("should line up unplaced tables under the room", func(t *testing.T) {
+		shapes, bounds := layoutFloorPlan(plan)
+		if len(shapes) != 4 {
+			t.Fatalf("expected 4 shapes, got %d", len(shapes))
+		}
+
+		unplaced := shapes[3]
+		if unplaced.lines[0] != "Mesa 2" || unplaced.y-unplaced.height/2 < 6 {
+			t.Errorf("unexpected unplaced table %+v", unplaced)
+		}
+		if unplaced.fill != occupancyColor(9, 8) || unplaced.lines[1] != "9/8" {
+			t.Errorf("expected an over capacity table, got %+v", unplaced)
+		}
+		if bounds.maxY < unplaced.y+unplaced.height/2 {
+			t.Errorf("bounds %+v do not include the unplaced table", bounds)
+		}
+	})
+
+	t.Run("should render an svg", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := RenderFloorPlanSVG(&buf, plan); err != nil {
+			t.Fatal(err)
+		}
+
+		svg := buf.String()
+		for _, want := range []string{"<svg", "Mesa 1", "10/10", "Pista &amp; DJ", "Escenario", "rotate(90.00"} {
+			if !strings.Contains(svg, want) {
+				t.Errorf("expected the svg to contain %q", want)
+			}
+		}
+	})
+
+	t.Run("should render a png", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := RenderFloorPlanPNG(&buf, plan); err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The table at (3, 2) is full, so its center is gray
+		b := img.Bounds()
+		if b.Dx() < 100 || b.Dy() < 100 {
+			t.Fatalf("unexpected size %v", b)
+		}
+		shapes, bounds := layoutFloorPlan(plan)
+		cx := int((shapes[2].x - bounds.minX) * svgPixelsPerMeter)
+		cy := int((shapes[2].y - bounds.minY + 1) * svgPixelsPerMeter)
+		r, g, bl, _ := img.At(cx, cy+30).RGBA()
+		if want := occupancyColor(10, 10); int(r>>8) != want[0] || int(g>>8) != want[1] || int(bl>>8) != want[2] {
+			t.Errorf("expected the table filled with %v, got %d %d %d", want, r>>8, g>>8, bl>>8)
+		}
+	})
+
+	t.Run("should render a pdf", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := RenderFloorPlanPDF(&buf, plan, "A4"); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(buf.String(), "%PDF") {
+			t.Error("expected a pdf document")
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package tables
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -27,15 +29,20 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	protected.Use(auth.AuthMiddleware)
 
 	// Methods with join tables
-	protected.HandleFunc("/guests", h.handleGetTablesAndGuests).Methods(http.MethodGet)
-	protected.HandleFunc("/guests/{id}", h.handleGetTableAndGuestsByID).Methods(http.MethodGet)
+	protected.HandleFunc("/guests", auth.RequirePermission(auth.PermRead, h.handleGetTablesAndGuests)).Methods(http.MethodGet)
+	protected.HandleFunc("/guests/{id}", auth.RequirePermission(auth.PermRead, h.handleGetTableAndGuestsByID)).Methods(http.MethodGet)
+
+	// Floor plan
+	protected.HandleFunc("/layout", auth.RequirePermission(auth.PermRead, h.handleGetFloorPlan)).Methods(http.MethodGet)
+	protected.HandleFunc("/layout", auth.RequirePermission(auth.PermWrite, h.handleSaveLayout)).Methods(http.MethodPut)
+	protected.HandleFunc("/layout/plan", auth.RequirePermission(auth.PermRead, h.handleRenderFloorPlan)).Methods(http.MethodGet)
 
 	// Other routes
-	protected.HandleFunc("", h.handleCreateTable).Methods(http.MethodPost)
-	protected.HandleFunc("", h.handleGetTables).Methods(http.MethodGet)
-	protected.HandleFunc("/{id}", h.handleGetTableByID).Methods(http.MethodGet)
-	protected.HandleFunc("/{id}", h.handleDeleteTable).Methods(http.MethodDelete)
-	protected.HandleFunc("/{id}", h.handleUpateTable).Methods(http.MethodPatch)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermWrite, h.handleCreateTable)).Methods(http.MethodPost)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermRead, h.handleGetTables)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermRead, h.handleGetTableByID)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermWrite, h.handleDeleteTable)).Methods(http.MethodDelete)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermWrite, h.handleUpateTable)).Methods(http.MethodPatch)
 }
 
 // @Summary Register a new table
@@ -44,12 +51,19 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param payload body types.CreateTablePayload true "Registration Payload"
 // @Success 201 {object} nil
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables [post]
+// @Router /events/{eventId}/tables [post]
 func (h *Handler) handleCreateTable(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get JSON paylaod
 	var payload types.CreateTablePayload
 
@@ -67,14 +81,14 @@ func (h *Handler) handleCreateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the table exists
-	_, err := h.store.GetTableByName(payload.Name)
+	_, err = h.store.GetTableByName(eventID, payload.Name)
 	if err == nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("table with name %s already exists", payload.Name))
 		return
 	}
 
 	// If not create the table
-	err = h.store.CreateTable(types.Table{
+	err = h.store.CreateTable(eventID, types.Table{
 		Name:     payload.Name,
 		Capacity: payload.Capacity,
 	})
@@ -91,16 +105,23 @@ func (h *Handler) handleCreateTable(w http.ResponseWriter, r *http.Request) {
 // @Tags mesas
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number"
 // @Param page_size query int false "Page size"
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.Table]
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables [get]
+// @Router /events/{eventId}/tables [get]
 func (h *Handler) handleGetTables(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	paginated, err := h.store.GetTables(params)
+	paginated, err := h.store.GetTables(eventID, params)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -114,12 +135,19 @@ func (h *Handler) handleGetTables(w http.ResponseWriter, r *http.Request) {
 // @Tags mesas
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Table ID"
 // @Success 200 {object} types.Table
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables/{id} [get]
+// @Router /events/{eventId}/tables/{id} [get]
 func (h *Handler) handleGetTableByID(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get the params
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -132,7 +160,7 @@ func (h *Handler) handleGetTableByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	t, err := h.store.GetTableByID(id)
+	t, err := h.store.GetTableByID(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -145,12 +173,19 @@ func (h *Handler) handleGetTableByID(w http.ResponseWriter, r *http.Request) {
 // @Description Deletes a table by ID
 // @Tags mesas
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Table ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables/{id} [delete]
+// @Router /events/{eventId}/tables/{id} [delete]
 func (h *Handler) handleDeleteTable(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -162,7 +197,7 @@ func (h *Handler) handleDeleteTable(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.DeleteTable(id)
+	err = h.store.DeleteTable(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -177,13 +212,21 @@ func (h *Handler) handleDeleteTable(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Table ID"
 // @Param payload body types.UpdateTablePayload true "Table fields to update"
 // @Success 200 {object} types.Table
 // @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables/{id} [patch]
+// @Router /events/{eventId}/tables/{id} [patch]
 func (h *Handler) handleUpateTable(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get id
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -210,7 +253,7 @@ func (h *Handler) handleUpateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current user from DB if partial update logic is needed
-	table, err := h.store.GetTableByID(id)
+	table, err := h.store.GetTableByID(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -224,7 +267,11 @@ func (h *Handler) handleUpateTable(w http.ResponseWriter, r *http.Request) {
 		table.Capacity = *payload.Capacity
 	}
 
-	if err := h.store.UpdateTable(table); err != nil {
+	if err := h.store.UpdateTable(eventID, table); err != nil {
+		if errors.Is(err, ErrCapacityBelowOccupancy) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -237,16 +284,23 @@ func (h *Handler) handleUpateTable(w http.ResponseWriter, r *http.Request) {
 // @Tags mesas
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Items per page" default(20)
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.TableAndGuests]
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables/guests [get]
+// @Router /events/{eventId}/tables/guests [get]
 func (h *Handler) handleGetTablesAndGuests(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	result, err := h.store.GetTablesWithGuests(params)
+	result, err := h.store.GetTablesWithGuests(eventID, params)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -260,12 +314,19 @@ func (h *Handler) handleGetTablesAndGuests(w http.ResponseWriter, r *http.Reques
 // @Tags mesas
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Table ID"
 // @Success 200 {object} types.TableAndGuests
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tables/guests/{id} [get]
+// @Router /events/{eventId}/tables/guests/{id} [get]
 func (h *Handler) handleGetTableAndGuestsByID(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Get the params
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -277,7 +338,7 @@ func (h *Handler) handleGetTableAndGuestsByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	t, err := h.store.GetTableWithGuestsByID(id)
+	t, err := h.store.GetTableWithGuestsByID(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -285,3 +346,127 @@ func (h *Handler) handleGetTableAndGuestsByID(w http.ResponseWriter, r *http.Req
 
 	utils.WriteJSON(w, http.StatusOK, t)
 }
+
+// @Summary Get the floor plan
+// @Description Returns every table with its guests, occupancy and geometry, and the fixtures of the room
+// @Tags mesas
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.FloorPlan
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tables/layout [get]
+func (h *Handler) handleGetFloorPlan(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	plan, err := h.store.GetFloorPlan(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
+
+// @Summary Save the floor plan
+// @Description Saves the position, shape, size, rotation and zone of the given tables (in meters, x/y is the center) and replaces the fixtures of the room
+// @Tags mesas
+// @Security BearerAuth
+// @Accept json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.SaveLayoutPayload true "Layout"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Router /events/{eventId}/tables/layout [put]
+func (h *Handler) handleSaveLayout(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.SaveLayoutPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	if err := h.store.SaveLayout(eventID, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// @Summary Draw the floor plan
+// @Description Draws the room with every table, its name and occupancy, and the fixtures. Tables without a position are lined up under the room.
+// @Tags mesas
+// @Security BearerAuth
+// @Produce image/svg+xml
+// @Produce application/pdf
+// @Produce image/png
+// @Param eventId path int true "Event ID"
+// @Param format query string false "svg, png or pdf (default svg)"
+// @Param paper query string false "Paper size of the pdf: Letter, Legal, Tabloid, A3, A4 or A5 (default Letter)"
+// @Success 200 {file} file
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tables/layout/plan [get]
+func (h *Handler) handleRenderFloorPlan(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" && format != "pdf" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unsupported format %q, use svg, png or pdf", format))
+		return
+	}
+
+	paper, err := utils.ParsePaperSize(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	plan, err := h.store.GetFloorPlan(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch format {
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=plano-%d.pdf", eventID))
+		err = RenderFloorPlanPDF(w, plan, paper)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=plano-%d.png", eventID))
+		err = RenderFloorPlanPNG(w, plan)
+	default:
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = RenderFloorPlanSVG(w, plan)
+	}
+
+	if err != nil {
+		log.Printf("failed to draw the floor plan of event %d: %v", eventID, err)
+	}
+}
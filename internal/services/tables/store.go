@@ -2,11 +2,13 @@ package tables
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/lib/pq"
 )
 
 type Store struct {
@@ -17,6 +19,23 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+const (
+	// Upper bound of tables drawn on a floor plan
+	maxFloorPlanTables = 1000
+	// Diameter of a table saved without a size, in meters
+	defaultTableSize = 1.8
+)
+
+// Returned when a table would end up smaller than the people seated at it
+var ErrCapacityBelowOccupancy = errors.New("capacity is below the seats in use")
+
+// Tables with their occupancy, computed by the table_occupancy view
+const tableSelect = `
+	SELECT id, name, capacity, o.used_seats, pos_x, pos_y, shape, width, height, rotation, zone, created_at::timestamptz
+	FROM tables
+	JOIN table_occupancy o ON o.table_id = tables.id
+`
+
 // Helper function to scan each row of the table mesas
 func scanRowIntoTable(rows *sql.Rows) (*types.Table, error) {
 	table := new(types.Table)
@@ -25,12 +44,22 @@ func scanRowIntoTable(rows *sql.Rows) (*types.Table, error) {
 		&table.ID,
 		&table.Name,
 		&table.Capacity,
+		&table.UsedSeats,
+		&table.Geometry.X,
+		&table.Geometry.Y,
+		&table.Geometry.Shape,
+		&table.Geometry.Width,
+		&table.Geometry.Height,
+		&table.Geometry.Rotation,
+		&table.Geometry.Zone,
 		&table.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	table.FreeSeats = table.Capacity - table.UsedSeats
+
 	return table, nil
 }
 
@@ -41,20 +70,30 @@ func scanRowIntoTableAndGuests(rows *sql.Rows) (*types.TableAndGuests, error) {
 		&t.ID,
 		&t.Name,
 		&t.Capacity,
+		&t.UsedSeats,
+		&t.Geometry.X,
+		&t.Geometry.Y,
+		&t.Geometry.Shape,
+		&t.Geometry.Width,
+		&t.Geometry.Height,
+		&t.Geometry.Rotation,
+		&t.Geometry.Zone,
 		&t.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	t.FreeSeats = t.Capacity - t.UsedSeats
+
 	t.Guests = []types.Guest{}
 	t.Generals = []types.General{}
 
 	return t, nil
 }
 
-func (s *Store) GetTableByID(id int) (*types.Table, error) {
-	rows, err := s.db.Query("SELECT * FROM tables WHERE id=$1", id)
+func (s *Store) GetTableByID(eventID int, id int) (*types.Table, error) {
+	rows, err := s.db.Query(tableSelect+" WHERE id=$1 AND event_id=$2", id, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,28 +115,25 @@ func (s *Store) GetTableByID(id int) (*types.Table, error) {
 	return t, nil
 }
 
-func (s *Store) GetTables(params types.PaginationParams) (*types.PaginatedResult[*types.Table], error) {
-	var whereClause string
-	var args []interface{}
+func (s *Store) GetTables(eventID int, params types.PaginationParams) (*types.PaginatedResult[*types.Table], error) {
+	whereClause := " WHERE event_id = $1"
+	args := []interface{}{eventID}
 	orderBy := "id"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		whereClause = " WHERE name ILIKE $1"
+		whereClause += " AND name ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
-	baseQuery := `
-		SELECT id, name, capacity, created_at::timestamptz
-		FROM tables
-	` + whereClause
+	baseQuery := tableSelect + whereClause
 
 	countQuery := `SELECT COUNT(*) FROM tables` + whereClause
 
 	return utils.Paginate(s.db, baseQuery, countQuery, scanRowIntoTable, params, orderBy, args...)
 }
 
-func (s *Store) GetTableByName(name string) (*types.Table, error) {
-	rows, err := s.db.Query("SELECT * FROM tables WHERE name=$1", name)
+func (s *Store) GetTableByName(eventID int, name string) (*types.Table, error) {
+	rows, err := s.db.Query(tableSelect+" WHERE name=$1 AND event_id=$2", name, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,8 +155,8 @@ func (s *Store) GetTableByName(name string) (*types.Table, error) {
 	return t, nil
 }
 
-func (s *Store) CreateTable(table types.Table) error {
-	_, err := s.db.Exec("INSERT INTO tables (name, capacity) VALUES ($1, $2)", table.Name, table.Capacity)
+func (s *Store) CreateTable(eventID int, table types.Table) error {
+	_, err := s.db.Exec("INSERT INTO tables (event_id, name, capacity) VALUES ($1, $2, $3)", eventID, table.Name, table.Capacity)
 	if err != nil {
 		return err
 	}
@@ -128,8 +164,8 @@ func (s *Store) CreateTable(table types.Table) error {
 	return nil
 }
 
-func (s *Store) DeleteTable(id int) error {
-	res, err := s.db.Exec("DELETE FROM tables WHERE id = $1", id)
+func (s *Store) DeleteTable(eventID int, id int) error {
+	res, err := s.db.Exec("DELETE FROM tables WHERE id = $1 AND event_id = $2", id, eventID)
 	if err != nil {
 		return err
 	}
@@ -143,42 +179,48 @@ func (s *Store) DeleteTable(id int) error {
 	return nil
 }
 
-func (s *Store) UpdateTable(table *types.Table) error {
-	res, err := s.db.Exec(`
-		UPDATE tables 
-		SET name = $1, capacity = $2
-		WHERE id = $3
-	`, table.Name, table.Capacity, table.ID)
+func (s *Store) UpdateTable(eventID int, table *types.Table) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
+	_, used, err := utils.TableSeats(tx, eventID, table.ID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("table with id %d not found", table.ID)
+	if table.Capacity < used {
+		return fmt.Errorf("%w: table %d has %d seats taken", ErrCapacityBelowOccupancy, table.ID, used)
 	}
 
-	return nil
+	_, err = tx.Exec(`
+		UPDATE tables 
+		SET name = $1, capacity = $2
+		WHERE id = $3 AND event_id = $4
+	`, table.Name, table.Capacity, table.ID, eventID)
+	if err != nil {
+		return err
+	}
+
+	table.UsedSeats = used
+	table.FreeSeats = table.Capacity - used
+
+	return tx.Commit()
 }
 
-func (s *Store) GetTablesWithGuests(params types.PaginationParams) (*types.PaginatedResult[*types.TableAndGuests], error) {
-	var whereClause string
-	var args []interface{}
+func (s *Store) GetTablesWithGuests(eventID int, params types.PaginationParams) (*types.PaginatedResult[*types.TableAndGuests], error) {
+	whereClause := " WHERE event_id = $1"
+	args := []interface{}{eventID}
 	orderBy := "id"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		whereClause = " WHERE name ILIKE $1"
+		whereClause += " AND name ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
-	baseQuery := `
-		SELECT id, name, capacity, created_at::timestamptz
-		FROM tables
-	` + whereClause
+	baseQuery := tableSelect + whereClause
 
 	countQuery := `SELECT COUNT(*) FROM tables` + whereClause
 
@@ -196,12 +238,12 @@ func (s *Store) GetTablesWithGuests(params types.PaginationParams) (*types.Pagin
 
 	// Step 3: Fetch and attach guests
 	guestRows, err := s.db.Query(`
-		SELECT id, full_name, additionals, confirm_attendance, table_id, created_at::timestamptz
+		SELECT id, full_name, additionals, rsvp_status, table_id, created_at::timestamptz
 		FROM guests
-		WHERE table_id IS NOT NULL
+		WHERE table_id IS NOT NULL AND event_id = $1
 		ORDER BY table_id, id
 
-	`)
+	`, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -210,7 +252,7 @@ func (s *Store) GetTablesWithGuests(params types.PaginationParams) (*types.Pagin
 	for guestRows.Next() {
 		var g types.Guest
 		var tableID int
-		err := guestRows.Scan(&g.ID, &g.FullName, &g.Additionals, &g.ConfirmAttendance, &tableID, &g.CreatedAt)
+		err := guestRows.Scan(&g.ID, &g.FullName, &g.Additionals, &g.RSVPStatus, &tableID, &g.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -220,13 +262,19 @@ func (s *Store) GetTablesWithGuests(params types.PaginationParams) (*types.Pagin
 		}
 	}
 
+	for _, t := range paginated.Data {
+		if err := s.attachCompanions(t.Guests); err != nil {
+			return nil, err
+		}
+	}
+
 	// Step 4: Fetch and attach generals
 	genRows, err := s.db.Query(`
 		SELECT id, folio, table_id, qr_code_url, pdf_file, created_at::timestamptz
 		FROM generals
-		WHERE table_id IS NOT NULL
+		WHERE table_id IS NOT NULL AND event_id = $1
 		ORDER BY table_id, id
-	`)
+	`, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -250,14 +298,23 @@ func (s *Store) GetTablesWithGuests(params types.PaginationParams) (*types.Pagin
 	return paginated, nil
 }
 
-func (s *Store) GetTableWithGuestsByID(tableID int) (*types.TableAndGuests, error) {
+func (s *Store) GetTableWithGuestsByID(eventID int, tableID int) (*types.TableAndGuests, error) {
 	var table types.TableAndGuests
-	tableQuery := `
-		SELECT id, name, capacity, created_at::timestamptz
-		FROM tables
-		WHERE id = $1;
-	`
-	err := s.db.QueryRow(tableQuery, tableID).Scan(&table.ID, &table.Name, &table.Capacity, &table.CreatedAt)
+	tableQuery := tableSelect + " WHERE id = $1 AND event_id = $2"
+	err := s.db.QueryRow(tableQuery, tableID, eventID).Scan(
+		&table.ID,
+		&table.Name,
+		&table.Capacity,
+		&table.UsedSeats,
+		&table.Geometry.X,
+		&table.Geometry.Y,
+		&table.Geometry.Shape,
+		&table.Geometry.Width,
+		&table.Geometry.Height,
+		&table.Geometry.Rotation,
+		&table.Geometry.Zone,
+		&table.CreatedAt,
+	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("table with id %d not found", tableID)
@@ -265,12 +322,13 @@ func (s *Store) GetTableWithGuestsByID(tableID int) (*types.TableAndGuests, erro
 		return nil, err
 	}
 
+	table.FreeSeats = table.Capacity - table.UsedSeats
 	table.Guests = []types.Guest{}
 
 	table.Generals = []types.General{}
 
 	guestsQuery := `
-		SELECT id, full_name, additionals, confirm_attendance, table_id, created_at::timestamptz
+		SELECT id, full_name, additionals, rsvp_status, table_id, created_at::timestamptz
 		FROM guests
 		WHERE table_id = $1
 		ORDER BY id;
@@ -284,7 +342,7 @@ func (s *Store) GetTableWithGuestsByID(tableID int) (*types.TableAndGuests, erro
 	for guestRows.Next() {
 		var g types.Guest
 		var tID int
-		err := guestRows.Scan(&g.ID, &g.FullName, &g.Additionals, &g.ConfirmAttendance, &tID, &g.CreatedAt)
+		err := guestRows.Scan(&g.ID, &g.FullName, &g.Additionals, &g.RSVPStatus, &tID, &g.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -293,6 +351,10 @@ func (s *Store) GetTableWithGuestsByID(tableID int) (*types.TableAndGuests, erro
 		table.Guests = append(table.Guests, g)
 	}
 
+	if err := s.attachCompanions(table.Guests); err != nil {
+		return nil, err
+	}
+
 	generalsQuery := `
 		SELECT id, folio, table_id, qr_code_url, pdf_file, created_at::timestamptz
 		FROM generals
@@ -320,3 +382,185 @@ func (s *Store) GetTableWithGuestsByID(tableID int) (*types.TableAndGuests, erro
 
 	return &table, nil
 }
+
+// Lists the named companions under each seated guest
+func (s *Store) attachCompanions(guests []types.Guest) error {
+	if len(guests) == 0 {
+		return nil
+	}
+
+	guestIDs := make([]int64, 0, len(guests))
+	byGuest := make(map[int]*types.Guest, len(guests))
+	for i := range guests {
+		guestIDs = append(guestIDs, int64(guests[i].ID))
+		byGuest[guests[i].ID] = &guests[i]
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, guest_id, full_name, email, notes, created_at
+		FROM companions
+		WHERE guest_id = ANY($1)
+		ORDER BY guest_id, id
+	`, pq.Array(guestIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c types.Companion
+		if err := rows.Scan(&c.ID, &c.GuestID, &c.FullName, &c.Email, &c.Notes, &c.CreatedAt); err != nil {
+			return err
+		}
+		if g, ok := byGuest[c.GuestID]; ok {
+			g.Companions = append(g.Companions, c)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Recomputes the occupancy of every table (of one event, or all of them when
+// eventID is 0) and returns the ones with more people than seats. With fix,
+// their capacity is raised to fit everyone.
+func (s *Store) ReconcileTables(eventID int, fix bool) ([]types.TableMismatch, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT t.event_id, t.id, t.name, t.capacity, o.used_seats
+		FROM tables t
+		JOIN table_occupancy o ON o.table_id = t.id
+		WHERE ($1 = 0 OR t.event_id = $1) AND o.used_seats > t.capacity
+		ORDER BY t.event_id, t.id
+		FOR UPDATE OF t
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := make([]types.TableMismatch, 0)
+	for rows.Next() {
+		var m types.TableMismatch
+		if err := rows.Scan(&m.EventID, &m.TableID, &m.Name, &m.Capacity, &m.UsedSeats); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return mismatches, nil
+	}
+
+	for i := range mismatches {
+		m := &mismatches[i]
+		if _, err := tx.Exec("UPDATE tables SET capacity = $1 WHERE id = $2", m.UsedSeats, m.TableID); err != nil {
+			return nil, fmt.Errorf("failed to fix table %d: %w", m.TableID, err)
+		}
+		m.Fixed = true
+	}
+
+	return mismatches, tx.Commit()
+}
+
+// Every table with its guests and geometry, and the fixtures of the room
+func (s *Store) GetFloorPlan(eventID int) (*types.FloorPlan, error) {
+	plan := &types.FloorPlan{Fixtures: []types.FloorFixture{}}
+
+	if err := s.db.QueryRow("SELECT name FROM events WHERE id = $1", eventID).Scan(&plan.EventName); err != nil {
+		return nil, fmt.Errorf("event not found: %w", err)
+	}
+
+	// Same data as the tables listing, in a single page
+	tables, err := s.GetTablesWithGuests(eventID, types.PaginationParams{Page: 1, PageSize: maxFloorPlanTables})
+	if err != nil {
+		return nil, err
+	}
+	plan.Tables = tables.Data
+
+	rows, err := s.db.Query(`
+		SELECT id, kind, label, pos_x, pos_y, width, height, rotation
+		FROM floor_fixtures
+		WHERE event_id = $1
+		ORDER BY id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f types.FloorFixture
+		if err := rows.Scan(&f.ID, &f.Kind, &f.Label, &f.X, &f.Y, &f.Width, &f.Height, &f.Rotation); err != nil {
+			return nil, err
+		}
+		plan.Fixtures = append(plan.Fixtures, f)
+	}
+
+	return plan, rows.Err()
+}
+
+// Stores the geometry of the given tables and replaces the fixtures
+func (s *Store) SaveLayout(eventID int, payload types.SaveLayoutPayload) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range payload.Tables {
+		shape := t.Shape
+		if shape == "" {
+			shape = types.ShapeRound
+		}
+		width, height := t.Width, t.Height
+		if width == 0 {
+			width = defaultTableSize
+		}
+		// Round and square tables are as tall as they are wide
+		if height == 0 || shape != types.ShapeRectangle {
+			height = width
+		}
+
+		res, err := tx.Exec(`
+			UPDATE tables
+			SET pos_x = $1, pos_y = $2, shape = $3, width = $4, height = $5, rotation = $6, zone = $7
+			WHERE id = $8 AND event_id = $9
+		`, t.X, t.Y, shape, width, height, t.Rotation, t.Zone, t.ID, eventID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("table with id %d not found", t.ID)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM floor_fixtures WHERE event_id = $1", eventID); err != nil {
+		return err
+	}
+
+	for _, f := range payload.Fixtures {
+		_, err := tx.Exec(`
+			INSERT INTO floor_fixtures (event_id, kind, label, pos_x, pos_y, width, height, rotation)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, eventID, f.Kind, f.Label, f.X, f.Y, f.Width, f.Height, f.Rotation)
+		if err != nil {
+			return fmt.Errorf("failed to save fixture: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
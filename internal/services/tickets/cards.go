@@ -0,0 +1,412 @@
+package tickets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/lib/pq"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Seated people of the event grouped by table. Guests and companions without a
+// table are left out, the cards only reflect the current seating
+func (s *Store) GetSeatingCards(eventID int) (*types.SeatingCards, error) {
+	// A single snapshot so the three sections agree with each other
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("event not found: %w", err)
+	}
+
+	cards := &types.SeatingCards{
+		EventName: event.Name,
+		EventDate: formatEventDate(event),
+		Tables:    []types.SeatingTable{},
+	}
+
+	tableRows, err := tx.Query(`SELECT id, name, capacity FROM tables WHERE event_id = $1 ORDER BY id`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tables: %w", err)
+	}
+	defer tableRows.Close()
+
+	byID := make(map[int]int)
+	for tableRows.Next() {
+		var t types.SeatingTable
+		if err := tableRows.Scan(&t.ID, &t.Name, &t.Capacity); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		t.Seats = []types.SeatingSeat{}
+		byID[t.ID] = len(cards.Tables)
+		cards.Tables = append(cards.Tables, t)
+	}
+	if err := tableRows.Err(); err != nil {
+		return nil, err
+	}
+
+	guestRows, err := tx.Query(`
+		SELECT g.table_id, g.full_name, g.additionals,
+		       COALESCE(ARRAY(SELECT c.full_name FROM companions c WHERE c.guest_id = g.id ORDER BY c.id), '{}')
+		FROM guests g
+		WHERE g.event_id = $1 AND g.table_id IS NOT NULL
+		ORDER BY g.table_id, g.id
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guests: %w", err)
+	}
+	defer guestRows.Close()
+
+	for guestRows.Next() {
+		var (
+			tableID     int
+			name        string
+			additionals int
+			companions  []string
+		)
+		if err := guestRows.Scan(&tableID, &name, &additionals, pq.Array(&companions)); err != nil {
+			return nil, fmt.Errorf("failed to scan guest: %w", err)
+		}
+
+		idx, ok := byID[tableID]
+		if !ok {
+			continue
+		}
+
+		host := name
+		seats := []types.SeatingSeat{{Name: name, Kind: types.SeatGuest}}
+		for _, companion := range companions {
+			seats = append(seats, types.SeatingSeat{Name: companion, Host: &host, Kind: types.SeatCompanion})
+		}
+		for len(seats) <= additionals {
+			seats = append(seats, types.SeatingSeat{Name: fmt.Sprintf("Acompañante de %s", name), Host: &host, Kind: types.SeatCompanion, Placeholder: true})
+		}
+
+		cards.Tables[idx].Seats = append(cards.Tables[idx].Seats, seats...)
+	}
+	if err := guestRows.Err(); err != nil {
+		return nil, err
+	}
+
+	genRows, err := tx.Query(`
+		SELECT table_id, folio FROM generals WHERE event_id = $1 AND table_id IS NOT NULL ORDER BY table_id, folio
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch generals: %w", err)
+	}
+	defer genRows.Close()
+
+	for genRows.Next() {
+		var tableID, folio int
+		if err := genRows.Scan(&tableID, &folio); err != nil {
+			return nil, fmt.Errorf("failed to scan general: %w", err)
+		}
+
+		if idx, ok := byID[tableID]; ok {
+			cards.Tables[idx].Seats = append(cards.Tables[idx].Seats, types.SeatingSeat{Name: fmt.Sprintf("General #%d", folio), Kind: types.SeatGeneral})
+		}
+	}
+	if err := genRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// Place cards are folded in half, this is the size of the unfolded card
+const (
+	placeCardWidth  = 90.0
+	placeCardHeight = 100.0
+	cardsMargin     = 10.0
+)
+
+type escortEntry struct {
+	name  string
+	table string
+}
+
+// Writes the requested sections, in the order escort list, place cards and
+// table cards, as a single PDF
+func RenderSeatingCards(w io.Writer, cards *types.SeatingCards, paper string, sections []string) error {
+	pdf := gofpdf.New("P", "mm", paper, "")
+	utils.AddPDFFonts(pdf)
+	pdf.SetMargins(cardsMargin, cardsMargin, cardsMargin)
+	pdf.SetAutoPageBreak(false, cardsMargin)
+
+	include := make(map[string]bool)
+	for _, section := range sections {
+		include[section] = true
+	}
+
+	if include[types.CardsEscort] {
+		writeEscortList(pdf, cards)
+	}
+	if include[types.CardsPlace] {
+		writePlaceCards(pdf, cards)
+	}
+	if include[types.CardsTable] {
+		writeTableCards(pdf, cards)
+	}
+
+	// gofpdf refuses to output a document without pages
+	if pdf.PageCount() == 0 {
+		pdf.AddPage()
+		pdf.SetFont(utils.PDFFont, "", 12)
+		pdf.CellFormat(0, 8, "Sin invitados sentados", "", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
+
+// Guests with the number of unnamed companions after their name, plus every
+// named companion, sorted the way a Spanish reader expects
+func escortEntries(cards *types.SeatingCards) []escortEntry {
+	entries := make([]escortEntry, 0)
+	for _, t := range cards.Tables {
+		unnamed := make(map[string]int)
+		for _, seat := range t.Seats {
+			if seat.Placeholder && seat.Host != nil {
+				unnamed[*seat.Host]++
+			}
+		}
+
+		for _, seat := range t.Seats {
+			switch {
+			case seat.Kind == types.SeatGuest:
+				name := seat.Name
+				if n := unnamed[seat.Name]; n > 0 {
+					name = fmt.Sprintf("%s (+%d)", name, n)
+				}
+				entries = append(entries, escortEntry{name: name, table: t.Name})
+			case seat.Kind == types.SeatCompanion && !seat.Placeholder:
+				entries = append(entries, escortEntry{name: seat.Name, table: t.Name})
+			}
+		}
+	}
+
+	c := collate.New(language.Spanish, collate.IgnoreCase, collate.IgnoreDiacritics)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return c.CompareString(entries[i].name, entries[j].name) < 0
+	})
+
+	return entries
+}
+
+func writeEscortList(pdf *gofpdf.Fpdf, cards *types.SeatingCards) {
+	entries := escortEntries(cards)
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	tableWidth := 50.0
+	nameWidth := pageWidth - 2*cardsMargin - tableWidth
+
+	newPage := func() {
+		pdf.AddPage()
+		pdf.SetFont(utils.PDFFont, "B", 16)
+		pdf.CellFormat(0, 9, cards.EventName, "", 1, "C", false, 0, "")
+		pdf.SetFont(utils.PDFFont, "", 11)
+		pdf.CellFormat(0, 6, fmt.Sprintf("%s - Encuentra tu mesa", cards.EventDate), "", 1, "C", false, 0, "")
+		pdf.Ln(4)
+	}
+	newPage()
+
+	if len(entries) == 0 {
+		pdf.CellFormat(0, 7, "Sin invitados sentados", "", 1, "L", false, 0, "")
+		return
+	}
+
+	letter := ""
+	for _, entry := range entries {
+		initial := initialOf(entry.name)
+
+		// Keep a letter heading together with its first name
+		needed := 7.0
+		if initial != letter {
+			needed += 10
+		}
+		if pdf.GetY()+needed > pageHeight-cardsMargin {
+			newPage()
+		}
+
+		if initial != letter {
+			letter = initial
+			pdf.Ln(2)
+			pdf.SetFont(utils.PDFFont, "B", 13)
+			pdf.CellFormat(0, 8, letter, "B", 1, "L", false, 0, "")
+		}
+
+		pdf.SetFont(utils.PDFFont, "", 11)
+		pdf.CellFormat(nameWidth, 7, utils.FitPDFText(pdf, entry.name, nameWidth), "", 0, "L", false, 0, "")
+		pdf.CellFormat(tableWidth, 7, utils.FitPDFText(pdf, entry.table, tableWidth), "", 1, "R", false, 0, "")
+	}
+}
+
+// One card per guest and named companion, as many per page as the paper fits
+func writePlaceCards(pdf *gofpdf.Fpdf, cards *types.SeatingCards) {
+	pageWidth, pageHeight := pdf.GetPageSize()
+	cols := max(1, int((pageWidth-2*cardsMargin)/placeCardWidth))
+	rows := max(1, int((pageHeight-2*cardsMargin)/placeCardHeight))
+	perPage := cols * rows
+
+	// Center the grid on the page
+	offsetX := (pageWidth - float64(cols)*placeCardWidth) / 2
+	offsetY := (pageHeight - float64(rows)*placeCardHeight) / 2
+
+	n := 0
+	for _, t := range cards.Tables {
+		for _, seat := range t.Seats {
+			if seat.Kind == types.SeatGeneral || seat.Placeholder {
+				continue
+			}
+
+			if n%perPage == 0 {
+				pdf.AddPage()
+			}
+			slot := n % perPage
+			x := offsetX + float64(slot%cols)*placeCardWidth
+			y := offsetY + float64(slot/cols)*placeCardHeight
+
+			drawTentCard(pdf, x, y, placeCardWidth, placeCardHeight, func(top float64, front bool) {
+				half := placeCardHeight / 2
+				setFittingFont(pdf, "B", seat.Name, placeCardWidth-10, 22, 10)
+				pdf.SetXY(x+5, top+half/2-8)
+				pdf.CellFormat(placeCardWidth-10, 10, seat.Name, "", 1, "C", false, 0, "")
+				pdf.SetFont(utils.PDFFont, "", 12)
+				pdf.SetX(x + 5)
+				pdf.CellFormat(placeCardWidth-10, 7, utils.FitPDFText(pdf, t.Name, placeCardWidth-10), "", 1, "C", false, 0, "")
+			})
+			n++
+		}
+	}
+}
+
+// One full-page tent card per table with the table name on both faces and
+// the people seated there on the front
+func writeTableCards(pdf *gofpdf.Fpdf, cards *types.SeatingCards) {
+	pageWidth, pageHeight := pdf.GetPageSize()
+	width := pageWidth - 2*cardsMargin
+	height := pageHeight - 2*cardsMargin
+	half := height / 2
+
+	for _, t := range cards.Tables {
+		names := make([]string, 0, len(t.Seats))
+		generals := 0
+		for _, seat := range t.Seats {
+			if seat.Kind == types.SeatGeneral {
+				generals++
+				continue
+			}
+			names = append(names, seat.Name)
+		}
+		if generals > 0 {
+			names = append(names, fmt.Sprintf("%d lugares generales", generals))
+		}
+
+		pdf.AddPage()
+		drawTentCard(pdf, cardsMargin, cardsMargin, width, height, func(top float64, front bool) {
+			title := t.Name
+			setFittingFont(pdf, "B", title, width-20, 48, 16)
+			pdf.SetXY(cardsMargin+10, top+10)
+			pdf.CellFormat(width-20, 20, title, "", 1, "C", false, 0, "")
+
+			// The back face only shows the table name
+			if !front {
+				return
+			}
+			writeNameColumns(pdf, names, cardsMargin+10, top+34, width-20, half-44)
+		})
+	}
+}
+
+// Draws a card folded along its horizontal middle. The top half is printed
+// upside down so both faces read correctly once the card stands up
+func drawTentCard(pdf *gofpdf.Fpdf, x, y, w, h float64, face func(top float64, front bool)) {
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.SetLineWidth(0.2)
+	pdf.Rect(x, y, w, h, "D")
+	pdf.SetDashPattern([]float64{2, 2}, 0)
+	pdf.Line(x, y+h/2, x+w, y+h/2)
+	pdf.SetDashPattern([]float64{}, 0)
+	pdf.SetDrawColor(0, 0, 0)
+
+	pdf.TransformBegin()
+	pdf.TransformRotate(180, x+w/2, y+h/4)
+	face(y, false)
+	pdf.TransformEnd()
+
+	face(y+h/2, true)
+}
+
+// Lays the names out in as few columns as the box allows, shrinking the font
+// before adding columns
+func writeNameColumns(pdf *gofpdf.Fpdf, names []string, x, y, w, h float64) {
+	if len(names) == 0 {
+		return
+	}
+
+	size, cols := 8.0, 3
+	for _, c := range []int{1, 2, 3} {
+		found := false
+		for s := 16.0; s >= 8; s-- {
+			rows := (len(names) + c - 1) / c
+			if float64(rows)*lineHeight(s) <= h {
+				size, cols, found = s, c, true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	rows := (len(names) + cols - 1) / cols
+	colWidth := w / float64(cols)
+	pdf.SetFont(utils.PDFFont, "", size)
+	for i, name := range names {
+		col, row := i/rows, i%rows
+		pdf.SetXY(x+float64(col)*colWidth, y+float64(row)*lineHeight(size))
+		pdf.CellFormat(colWidth, lineHeight(size), utils.FitPDFText(pdf, name, colWidth), "", 0, "C", false, 0, "")
+	}
+}
+
+// Line height in mm for a font size in points
+func lineHeight(size float64) float64 {
+	return size * 0.3528 * 1.4
+}
+
+// Sets the biggest font size, down to min, at which text fits in width
+func setFittingFont(pdf *gofpdf.Fpdf, style string, text string, width, maxSize, minSize float64) {
+	for size := maxSize; size >= minSize; size-- {
+		pdf.SetFont(utils.PDFFont, style, size)
+		if pdf.GetStringWidth(text) <= width {
+			return
+		}
+	}
+}
+
+// Heading letter for the escort list, accents folded
+func initialOf(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "#"
+	}
+
+	initial := strings.ToUpper(string([]rune(name)[0]))
+	initial = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U").Replace(initial)
+	if initial < "A" || (initial > "Z" && initial != "Ñ") {
+		return "#"
+	}
+
+	return initial
+}
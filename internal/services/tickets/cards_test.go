@@ -0,0 +1,63 @@
+package tickets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestSeatingCards(t *testing.T) {
+	ana, zoe := "Ana Núñez", "Zoe Ruiz"
+	cards := &types.SeatingCards{
+		EventName: "Boda",
+		EventDate: "14/02/2027 18:00",
+		Tables: []types.SeatingTable{
+			{ID: 1, Name: "Mesa 1", Capacity: 4, Seats: []types.SeatingSeat{
+				{Name: zoe, Kind: types.SeatGuest},
+				{Name: "Acompañante de Zoe Ruiz", Host: &zoe, Kind: types.SeatCompanion, Placeholder: true},
+				{Name: "General #3", Kind: types.SeatGeneral},
+			}},
+			{ID: 2, Name: "Mesa 2", Capacity: 4, Seats: []types.SeatingSeat{
+				{Name: ana, Kind: types.SeatGuest},
+				{Name: "Ángel Núñez", Host: &ana, Kind: types.SeatCompanion},
+			}},
+		},
+	}
+
+	t.Run("should list people alphabetically", func(t *testing.T) {
+		entries := escortEntries(cards)
+
+		expected := []escortEntry{
+			{name: "Ana Núñez", table: "Mesa 2"},
+			{name: "Ángel Núñez", table: "Mesa 2"},
+			{name: "Zoe Ruiz (+1)", table: "Mesa 1"},
+		}
+		if len(entries) != len(expected) {
+			t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+		}
+		for i := range expected {
+			if entries[i] != expected[i] {
+				t.Errorf("expected %+v at %d, got %+v", expected[i], i, entries[i])
+			}
+		}
+
+		if initialOf("Ángel") != "A" || initialOf("Ñandú") != "Ñ" || initialOf("1er") != "#" {
+			t.Error("unexpected initials")
+		}
+	})
+
+	t.Run("should render every section", func(t *testing.T) {
+		for _, paper := range []string{"Letter", "A5"} {
+			var buf bytes.Buffer
+			err := RenderSeatingCards(&buf, cards, paper, []string{types.CardsEscort, types.CardsPlace, types.CardsTable})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+				t.Errorf("expected a pdf on %s paper", paper)
+			}
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package tickets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/config"
+)
+
+func TestTicketCodes(t *testing.T) {
+	t.Run("should verify codes only for the event they were issued for", func(t *testing.T) {
+		code, err := newTicketCode(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) > 100 {
+			t.Errorf("code does not fit the tickets.code column: %d chars", len(code))
+		}
+
+		if err := checkTicketCode(3, code); err != nil {
+			t.Errorf("expected the code to verify, got %v", err)
+		}
+		if err := checkTicketCode(4, code); !errors.Is(err, ErrForgedCode) {
+			t.Errorf("expected a code from another event to be refused, got %v", err)
+		}
+
+		other, _ := newTicketCode(3)
+		if other == code {
+			t.Error("expected two different codes")
+		}
+	})
+
+	t.Run("should refuse tampered codes", func(t *testing.T) {
+		code, _ := newTicketCode(3)
+		parts := strings.Split(code, ".")
+		other, _ := newTicketCode(3)
+
+		for _, forged := range []string{
+			parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2],
+			parts[0] + "." + parts[1],
+			"v2." + parts[1] + "." + parts[2],
+			"",
+			"PREVIEW",
+		} {
+			if err := checkTicketCode(3, forged); !errors.Is(err, ErrForgedCode) {
+				t.Errorf("expected %q to be refused, got %v", forged, err)
+			}
+		}
+	})
+
+	t.Run("should accept legacy codes only during the migration window", func(t *testing.T) {
+		defer func(legacy bool) { config.Envs.LegacyTicketCodes = legacy }(config.Envs.LegacyTicketCodes)
+
+		config.Envs.LegacyTicketCodes = true
+		if err := checkTicketCode(3, "1718000000000000000123"); err != nil {
+			t.Errorf("expected a legacy code to pass, got %v", err)
+		}
+
+		config.Envs.LegacyTicketCodes = false
+		if err := checkTicketCode(3, "1718000000000000000123"); !errors.Is(err, ErrForgedCode) {
+			t.Errorf("expected a legacy code to be refused, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package tickets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/checkins"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+var (
+	ErrNotAParty     = errors.New("the code belongs to a general ticket, scan it on its own")
+	ErrGuestNotFound = errors.New("guest not found")
+)
+
+// A named ticket of the guest with its companion, if it has one
+type partyTicket struct {
+	id            int
+	companionID   *int
+	companionName *string
+	host          bool
+	status        string
+	usedAt        *time.Time
+	present       bool
+}
+
+// Names every ticket of the party the way its page was printed
+func partyMembers(guestName string, tickets []partyTicket) ([]types.PartyMember, types.CheckInCount) {
+	members := make([]types.PartyMember, 0, len(tickets))
+	count := types.CheckInCount{Expected: len(tickets)}
+
+	for _, t := range tickets {
+		m := types.PartyMember{TicketID: t.id, CompanionID: t.companionID, Status: t.status, UsedAt: t.usedAt, Present: t.present}
+
+		switch {
+		case t.companionName != nil:
+			m.Name = *t.companionName
+		case t.host:
+			m.Name, m.Host = guestName, true
+		default:
+			m.Name = fmt.Sprintf("Acompañante de %s", guestName)
+		}
+
+		if t.status == types.TicketUsed {
+			count.Arrived++
+		}
+		if t.present {
+			count.Present++
+		}
+		members = append(members, m)
+	}
+
+	return members, count
+}
+
+// Who of the guest's party has arrived and who is still missing
+func (s *Store) GetParty(eventID int, guestID int) (*types.PartyStatus, error) {
+	party := &types.PartyStatus{GuestID: guestID}
+
+	err := s.db.QueryRow(`
+		SELECT g.full_name, g.table_id, tb.name
+		FROM guests g
+		LEFT JOIN tables tb ON tb.id = g.table_id
+		WHERE g.id = $1 AND g.event_id = $2
+	`, guestID, eventID).Scan(&party.GuestName, &party.TableID, &party.TableName)
+	if err == sql.ErrNoRows {
+		return nil, ErrGuestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guest: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT t.id, t.companion_id, c.full_name, t.host, t.status, t.used_at, t.present
+		FROM tickets t
+		LEFT JOIN companions c ON c.id = t.companion_id
+		WHERE t.guest_id = $1 AND t.type = 'named' AND t.status <> 'revoked'
+		ORDER BY t.id
+	`, guestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch party tickets: %w", err)
+	}
+	defer rows.Close()
+
+	tickets := make([]partyTicket, 0)
+	for rows.Next() {
+		var t partyTicket
+		if err := rows.Scan(&t.id, &t.companionID, &t.companionName, &t.host, &t.status, &t.usedAt, &t.present); err != nil {
+			return nil, fmt.Errorf("failed to scan party ticket: %w", err)
+		}
+		tickets = append(tickets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	party.Members, party.CheckInCount = partyMembers(party.GuestName, tickets)
+
+	return party, nil
+}
+
+// Checks in everyone of the party still outside from any one of its codes,
+// for a host who arrives with everybody. On events with re-entry the members
+// who stepped out are let back in too. Like ScanQR it is one conditional
+// update, so a ticket scanned at another door at the same time is only
+// admitted once
+func (s *Store) CheckInParty(eventID int, code string, scan types.ScanContext) (*types.PartyCheckIn, error) {
+	if err := checkTicketCode(eventID, code); err != nil {
+		s.recordScan(eventID, nil, code, types.ScanForged, scan)
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		WITH scanned AS (
+			SELECT guest_id FROM tickets
+			WHERE code = $1 AND event_id = $2 AND type = 'named' AND status <> 'revoked'
+		), admitted AS (
+			UPDATE tickets SET status = 'used', used_at = NOW(), present = TRUE
+			WHERE guest_id = (SELECT guest_id FROM scanned) AND event_id = $2
+			  AND type = 'named' AND status = 'active'
+			RETURNING id, code, guest_id, used_at AS scanned_at
+		), reentered AS (
+			UPDATE tickets t SET present = TRUE
+			FROM events e
+			WHERE e.id = t.event_id AND e.re_entry
+			  AND t.guest_id = (SELECT guest_id FROM scanned) AND t.event_id = $2
+			  AND t.type = 'named' AND t.status = 'used' AND NOT t.present
+			RETURNING t.id, t.code, t.guest_id, NOW() AS scanned_at
+		), checked AS (
+			SELECT id, code, guest_id, scanned_at, 'admitted' AS result FROM admitted
+			UNION ALL
+			SELECT id, code, guest_id, scanned_at, 'reentered' AS result FROM reentered
+		), logged AS (
+			INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, device_id, gate, scanned_at)
+			SELECT $2, id, code, result, $3, NULLIF($4, ''), NULLIF($5, ''), scanned_at FROM checked
+		)
+		SELECT id, guest_id, scanned_at, result FROM checked ORDER BY id
+	`, code, eventID, scan.UserID, scan.DeviceID, scan.Gate)
+	if err != nil {
+		return nil, fmt.Errorf("error checking in the party: %w", err)
+	}
+	defer rows.Close()
+
+	type checkedTicket struct {
+		at      time.Time
+		outcome string
+	}
+
+	var guestID int
+	admitted := make([]int, 0)
+	reentered := make([]int, 0)
+	checked := make(map[int]checkedTicket)
+	for rows.Next() {
+		var id int
+		var t checkedTicket
+		if err := rows.Scan(&id, &guestID, &t.at, &t.outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan checked in ticket: %w", err)
+		}
+		if t.outcome == types.ScanReentered {
+			reentered = append(reentered, id)
+		} else {
+			admitted = append(admitted, id)
+		}
+		checked[id] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(checked) == 0 {
+		return nil, s.partyRefusal(eventID, code, scan)
+	}
+
+	party, err := s.GetParty(eventID, guestID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range party.Members {
+		t, ok := checked[m.TicketID]
+		if !ok {
+			continue
+		}
+
+		name := m.Name
+		live := types.CheckInEvent{
+			EventID:   eventID,
+			TicketID:  m.TicketID,
+			Result:    t.outcome,
+			Type:      "named",
+			Name:      &name,
+			TableID:   party.TableID,
+			TableName: party.TableName,
+			ScannedAt: t.at,
+		}
+		if scan.DeviceID != "" {
+			live.DeviceID = &scan.DeviceID
+		}
+		if scan.Gate != "" {
+			live.Gate = &scan.Gate
+		}
+		checkins.Publish(live)
+	}
+
+	return &types.PartyCheckIn{Admitted: admitted, Reentered: reentered, Party: *party}, nil
+}
+
+// Nobody was let in: the code is a general ticket, or the same reasons a
+// single scan is refused. With the whole party already in (and present, on
+// events with re-entry), the scanned ticket is a duplicate
+func (s *Store) partyRefusal(eventID int, code string, scan types.ScanContext) error {
+	var ticketType string
+	err := s.db.QueryRow(`SELECT type FROM tickets WHERE code = $1 AND event_id = $2`, code, eventID).Scan(&ticketType)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error consulting ticket: %w", err)
+	}
+	if ticketType == "general" {
+		return ErrNotAParty
+	}
+
+	ticketID, refusal := s.scanRefusal(eventID, code)
+	if outcome := refusalOutcome(refusal); outcome != "" {
+		s.recordScan(eventID, ticketID, code, outcome, scan)
+	}
+
+	return refusal
+}
@@ -0,0 +1,53 @@
+package tickets
+
+import (
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestPartyMembers(t *testing.T) {
+	maria := "Maria Lopez"
+	companionID := 7
+
+	t.Run("should name the guest, named companions and the rest", func(t *testing.T) {
+		members, count := partyMembers("Juan Perez", []partyTicket{
+			{id: 1, host: true, status: types.TicketUsed, present: true},
+			{id: 2, companionID: &companionID, companionName: &maria, status: types.TicketUsed},
+			{id: 3, status: types.TicketActive},
+			{id: 4, status: types.TicketActive},
+		})
+
+		if count.Arrived != 2 || count.Expected != 4 {
+			t.Errorf("expected 2 of 4 arrived, got %d of %d", count.Arrived, count.Expected)
+		}
+		if count.Present != 1 {
+			t.Errorf("expected 1 present after the companion stepped out, got %d", count.Present)
+		}
+
+		want := []string{"Juan Perez", "Maria Lopez", "Acompañante de Juan Perez", "Acompañante de Juan Perez"}
+		for i, m := range members {
+			if m.Name != want[i] {
+				t.Errorf("ticket %d: expected %q, got %q", m.TicketID, want[i], m.Name)
+			}
+			if m.Host != (i == 0) {
+				t.Errorf("ticket %d: unexpected host %v", m.TicketID, m.Host)
+			}
+		}
+	})
+
+	t.Run("should only take the guest's own ticket as the guest's", func(t *testing.T) {
+		members, _ := partyMembers("Juan Perez", []partyTicket{
+			{id: 2, companionID: &companionID, companionName: &maria, status: types.TicketActive},
+			{id: 4, status: types.TicketActive},
+			{id: 5, host: true, status: types.TicketActive},
+		})
+
+		if members[0].Host || members[1].Host || members[1].Name != "Acompañante de Juan Perez" {
+			t.Errorf("unexpected members %+v", members)
+		}
+		if !members[2].Host || members[2].Name != "Juan Perez" {
+			t.Errorf("expected ticket 5 to be the guest's, got %+v", members[2])
+		}
+	})
+}
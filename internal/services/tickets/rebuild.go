@@ -0,0 +1,306 @@
+package tickets
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+var ErrTicketsNotGenerated = errors.New("the guest has no tickets yet, generate them first")
+
+type issuedTicket struct {
+	id          int
+	code        string
+	companionID *int
+	host        bool
+	status      string
+}
+
+// The guest's own ticket, or the one already linked to a named companion
+func (h ticketHolder) owns(t issuedTicket) bool {
+	if h.host {
+		return t.host
+	}
+	return h.companionID != nil && t.companionID != nil && *t.companionID == *h.companionID
+}
+
+// Which existing ticket every holder keeps. The guest keeps their own ticket
+// and named companions the one already linked to them; the other companions
+// take the remaining ones in the order they were issued. Holders whose ticket
+// was revoked without a replacement (withheld) are held back, the rest left
+// without a ticket need a new one. Tickets left without a holder are no
+// longer needed.
+func matchTickets(holders []ticketHolder, issued []issuedTicket, withheld []issuedTicket) ([]*issuedTicket, []bool, []issuedTicket) {
+	matched := make([]*issuedTicket, len(holders))
+	held := make([]bool, len(holders))
+	taken := make([]bool, len(issued))
+
+	for i, h := range holders {
+		for j, t := range issued {
+			if !taken[j] && h.owns(t) {
+				matched[i] = &issued[j]
+				taken[j] = true
+				break
+			}
+		}
+	}
+
+	// Withheld tickets of unnamed companions can't be told apart, so they
+	// only count
+	anonymous := 0
+	for _, t := range withheld {
+		owner := -1
+		for i, h := range holders {
+			if h.owns(t) {
+				owner = i
+				break
+			}
+		}
+
+		switch {
+		case owner < 0 && !t.host:
+			anonymous++
+		case owner >= 0 && matched[owner] == nil:
+			held[owner] = true
+		}
+	}
+
+	for i, h := range holders {
+		if matched[i] != nil || held[i] || h.host {
+			continue
+		}
+		for j, t := range issued {
+			if !taken[j] && !t.host {
+				matched[i] = &issued[j]
+				taken[j] = true
+				break
+			}
+		}
+	}
+
+	for i, h := range holders {
+		if anonymous == 0 {
+			break
+		}
+		if matched[i] == nil && !held[i] && !h.host && h.companionID == nil {
+			held[i] = true
+			anonymous--
+		}
+	}
+
+	left := make([]issuedTicket, 0)
+	for j, t := range issued {
+		if !taken[j] {
+			left = append(left, t)
+		}
+	}
+
+	return matched, held, left
+}
+
+// Draws the guest's tickets again from the current name, companions, table
+// and template. Codes are kept unless rotateCodes is set (used tickets always
+// keep theirs), new additionals get new tickets and unneeded ones are revoked.
+// People whose ticket was revoked without a replacement stay without one
+// unless reissue is set. The new PDF and QR images are uploaded by the worker.
+func (s *Store) RebuildTickets(eventID int, guestID int, rotateCodes bool, reissue bool) (*types.RebuildTicketsResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin the transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := s.rebuildTicketsTx(tx, eventID, guestID, rotateCodes, reissue)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// A guest left with no tickets at all goes back to not having them generated.
+func (s *Store) rebuildTicketsTx(tx *sql.Tx, eventID int, guestID int, rotateCodes bool, reissue bool) (*types.RebuildTicketsResult, error) {
+	// Two rebuilds of the same guest would revoke each other's tickets
+	if _, err := tx.Exec(`SELECT id FROM guests WHERE id = $1 AND event_id = $2 FOR UPDATE`, guestID, eventID); err != nil {
+		return nil, fmt.Errorf("failed to lock guest: %w", err)
+	}
+
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	guest, err := s.getGuestByID(tx, eventID, guestID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("guest with id %d not found", guestID)
+		}
+		return nil, fmt.Errorf("failed to fetch guest: %w", err)
+	}
+
+	if !guest.TicketGenerated {
+		return nil, ErrTicketsNotGenerated
+	}
+
+	holders, err := s.getTicketHolders(tx, guest)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := getTicketTemplate(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var table string
+	err = tx.QueryRow(`
+		SELECT COALESCE(t.name, '') FROM guests g LEFT JOIN tables t ON t.id = g.table_id WHERE g.id = $1
+	`, guest.ID).Scan(&table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch guest table: %w", err)
+	}
+
+	if reissue {
+		if _, err := tx.Exec(`UPDATE tickets SET withheld = FALSE WHERE guest_id = $1 AND withheld`, guest.ID); err != nil {
+			return nil, fmt.Errorf("failed to release withheld tickets: %w", err)
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, code, companion_id, host, status
+		FROM tickets
+		WHERE guest_id = $1 AND type = 'named' AND (status <> 'revoked' OR withheld)
+		ORDER BY id
+	`, guest.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tickets: %w", err)
+	}
+	defer rows.Close()
+
+	issued := make([]issuedTicket, 0)
+	withheld := make([]issuedTicket, 0)
+	for rows.Next() {
+		var t issuedTicket
+		if err := rows.Scan(&t.id, &t.code, &t.companionID, &t.host, &t.status); err != nil {
+			return nil, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		if t.status == types.TicketRevoked {
+			withheld = append(withheld, t)
+		} else {
+			issued = append(issued, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &types.RebuildTicketsResult{GuestID: guest.ID}
+	matched, held, left := matchTickets(holders, issued, withheld)
+
+	var qrCodes [][]byte
+	pages := make([]ticketPage, 0, len(holders))
+
+	for i, holder := range holders {
+		t := matched[i]
+
+		var code string
+		switch {
+		case t == nil && held[i]:
+			continue
+		case t == nil:
+			code, err = newTicketCode(eventID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate ticket code: %w", err)
+			}
+			if err := s.insertTicketIntoDB(tx, eventID, code, "named", &guest.ID, holder.companionID, holder.host); err != nil {
+				return nil, fmt.Errorf("db insert failed: %w", err)
+			}
+			result.Added++
+		case rotateCodes && t.status == types.TicketActive:
+			code, err = newTicketCode(eventID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate ticket code: %w", err)
+			}
+			_, err := tx.Exec(`UPDATE tickets SET code = $1, companion_id = $2 WHERE id = $3`, code, holder.companionID, t.id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to rotate ticket code: %w", err)
+			}
+			result.Rotated++
+		default:
+			code = t.code
+			_, err := tx.Exec(`UPDATE tickets SET companion_id = $1 WHERE id = $2`, holder.companionID, t.id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update ticket: %w", err)
+			}
+		}
+
+		qrBytes, err := generateQRCode(code)
+		if err != nil {
+			return nil, fmt.Errorf("QR generation failed: %w", err)
+		}
+
+		pages = append(pages, ticketPage{name: holder.name, table: table, qr: qrBytes})
+		qrCodes = append(qrCodes, qrBytes)
+	}
+	result.Tickets = len(pages)
+
+	// Used tickets stay as they are, they already let someone in
+	for _, t := range left {
+		if t.status != types.TicketActive {
+			continue
+		}
+		if err := revokeTicketTx(tx, t.id, "replaced", false); err != nil {
+			return nil, err
+		}
+		result.Revoked++
+	}
+
+	if len(pages) == 0 {
+		_, err := tx.Exec(`
+			UPDATE guests SET ticket_generated = FALSE, pdf_files = NULL, qr_code_urls = NULL WHERE id = $1
+		`, guest.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to clear guest tickets: %w", err)
+		}
+
+		return result, nil
+	}
+
+	pdfData, err := renderTickets(tmpl, event, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var base64Qrs []string
+	for _, qr := range qrCodes {
+		base64Qrs = append(base64Qrs, base64.StdEncoding.EncodeToString(qr))
+	}
+
+	job := queue.FullUploadJob{
+		TicketID:   guest.ID,
+		QrCodes:    base64Qrs,
+		PDFBase64:  base64.StdEncoding.EncodeToString(pdfData),
+		TicketType: "named",
+	}
+
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal FullUpload job: %w", err)
+	}
+
+	if err := queue.EnqueueJob(context.Background(), queue.FullUploadQueue, string(jobJSON)); err != nil {
+		return nil, fmt.Errorf("failed to enqueue FullUpload job: %w", err)
+	}
+
+	return result, nil
+}
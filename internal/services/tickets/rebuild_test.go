@@ -0,0 +1,159 @@
+package tickets
+
+import (
+	"testing"
+
+	"github.com/diegob0/rspv_backend/internal/services/guests"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestMatchTickets(t *testing.T) {
+	ana, luis := 7, 8
+
+	t.Run("should keep named companions on their ticket and reuse the rest in order", func(t *testing.T) {
+		holders := []ticketHolder{
+			{name: "Juan", host: true},
+			{name: "Ana", companionID: &ana},
+			{name: "Luis", companionID: &luis},
+		}
+		issued := []issuedTicket{
+			{id: 1, host: true, status: "used"},
+			{id: 2, status: "active"},
+			{id: 3, companionID: &ana, status: "active"},
+		}
+
+		matched, _, left := matchTickets(holders, issued, nil)
+
+		if matched[0].id != 1 || matched[1].id != 3 || matched[2].id != 2 {
+			t.Errorf("unexpected match %d %d %d", matched[0].id, matched[1].id, matched[2].id)
+		}
+		if len(left) != 0 {
+			t.Errorf("expected no tickets left, got %+v", left)
+		}
+	})
+
+	t.Run("should leave new holders without a ticket and report extra tickets", func(t *testing.T) {
+		matched, held, left := matchTickets([]ticketHolder{{name: "Juan", host: true}, {name: "Acompañante de Juan"}}, []issuedTicket{{id: 1, host: true, status: "active"}}, nil)
+		if matched[0] == nil || matched[0].id != 1 || matched[1] != nil || held[1] {
+			t.Errorf("expected the second holder to need a new ticket")
+		}
+		if len(left) != 0 {
+			t.Errorf("expected no tickets left, got %+v", left)
+		}
+
+		_, _, left = matchTickets([]ticketHolder{{name: "Juan", host: true}}, []issuedTicket{{id: 1, host: true, status: "active"}, {id: 2, status: "active"}}, nil)
+		if len(left) != 1 || left[0].id != 2 {
+			t.Errorf("expected ticket 2 to be left over, got %+v", left)
+		}
+	})
+
+	t.Run("should not give the guest a companion's ticket", func(t *testing.T) {
+		holders := []ticketHolder{{name: "Juan", host: true}, {name: "Acompañante de Juan"}}
+		issued := []issuedTicket{{id: 2, status: "active"}}
+		withheld := []issuedTicket{{id: 1, host: true, status: "revoked"}}
+
+		matched, held, left := matchTickets(holders, issued, withheld)
+
+		if matched[0] != nil || !held[0] {
+			t.Errorf("expected the guest to stay without a ticket, got %+v", matched[0])
+		}
+		if matched[1] == nil || matched[1].id != 2 {
+			t.Errorf("expected the companion to keep ticket 2")
+		}
+		if len(left) != 0 {
+			t.Errorf("expected no tickets left, got %+v", left)
+		}
+	})
+
+	t.Run("should hold back the holders of withheld tickets", func(t *testing.T) {
+		holders := []ticketHolder{
+			{name: "Juan", host: true},
+			{name: "Ana", companionID: &ana},
+			{name: "Acompañante de Juan"},
+			{name: "Acompañante de Juan"},
+		}
+		issued := []issuedTicket{{id: 1, host: true, status: "active"}, {id: 4, status: "active"}}
+		withheld := []issuedTicket{{id: 2, companionID: &ana, status: "revoked"}, {id: 3, status: "revoked"}}
+
+		matched, held, _ := matchTickets(holders, issued, withheld)
+
+		if matched[1] != nil || !held[1] {
+			t.Errorf("expected Ana to stay without a ticket")
+		}
+		if matched[2] == nil || matched[2].id != 4 {
+			t.Errorf("expected the first companion to keep ticket 4")
+		}
+		if matched[3] != nil || !held[3] {
+			t.Errorf("expected the second companion to stay without a ticket")
+		}
+	})
+}
+
+// Also needs Redis (REDIS_ADDR), generating and rebuilding queue the uploads
+func TestRebuildAfterRevoke(t *testing.T) {
+	db := testDB(t)
+
+	var eventID, guestID int
+	err := db.QueryRow(`INSERT INTO events (name, event_date, venue) VALUES ('Rebuild test', NOW(), 'Salón') RETURNING id`).Scan(&eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM events WHERE id = $1`, eventID) })
+
+	err = db.QueryRow(`INSERT INTO guests (event_id, full_name, additionals) VALUES ($1, 'Juan Perez', 1) RETURNING id`, eventID).Scan(&guestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(db)
+	if err := store.GenerateTicket(eventID, guestID); err != nil {
+		t.Fatal(err)
+	}
+
+	var hostTicket int
+	if err := db.QueryRow(`SELECT id FROM tickets WHERE guest_id = $1 AND host`, guestID).Scan(&hostTicket); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.RevokeTicket(eventID, hostTicket, types.RevokeTicketsPayload{Reason: "lost phone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rename queues a rebuild, run here the way the worker does
+	guest := &types.Guest{ID: guestID, FullName: "Juan Pérez", Additionals: 1, RSVPStatus: "pending"}
+	if err := guests.NewStore(db).UpdateGuest(eventID, guest); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := store.RebuildTickets(eventID, guestID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 0 || result.Tickets != 1 {
+		t.Errorf("expected the revoked ticket not to come back, got %+v", result)
+	}
+
+	party, err := store.GetParty(eventID, guestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(party.Members) != 1 || party.Members[0].Host || party.Members[0].Name != "Acompañante de Juan Pérez" {
+		t.Errorf("expected only the companion, not as the guest, got %+v", party.Members)
+	}
+
+	result, err = store.RebuildTickets(eventID, guestID, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Tickets != 2 {
+		t.Errorf("expected the guest to get a new ticket when asked, got %+v", result)
+	}
+
+	party, err = store.GetParty(eventID, guestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(party.Members) != 2 || !party.Members[1].Host || party.Members[1].Name != "Juan Pérez" {
+		t.Errorf("expected the new ticket to be the guest's, got %+v", party.Members)
+	}
+}
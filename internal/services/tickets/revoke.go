@@ -0,0 +1,257 @@
+package tickets
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+var (
+	ErrTicketNotFound  = errors.New("ticket not found")
+	ErrNothingToRevoke = errors.New("there are no active tickets to revoke")
+)
+
+// Withheld tickets are not replaced by later rebuilds, their holder was meant
+// to be left without one
+func revokeTicketTx(tx *sql.Tx, ticketID int, reason string, withheld bool) error {
+	_, err := tx.Exec(`
+		UPDATE tickets SET status = 'revoked', revoked_at = NOW(), revoke_reason = $1, withheld = $3 WHERE id = $2
+	`, reason, ticketID, withheld)
+	if err != nil {
+		return fmt.Errorf("failed to revoke ticket %d: %w", ticketID, err)
+	}
+
+	return nil
+}
+
+// Revokes one ticket. The PDF of its guest or general is drawn again, with a
+// new code in place of the revoked one when payload.Reissue is set
+func (s *Store) RevokeTicket(eventID int, ticketID int, payload types.RevokeTicketsPayload) (*types.RevokeTicketsResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var guestID, generalID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT guest_id, general_id FROM tickets WHERE id = $1 AND event_id = $2
+	`, ticketID, eventID).Scan(&guestID, &generalID)
+	if err == sql.ErrNoRows {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ticket: %w", err)
+	}
+
+	// The owner is locked before the ticket, in the same order a rebuild does
+	if guestID.Valid {
+		if _, err := tx.Exec(`SELECT id FROM guests WHERE id = $1 FOR UPDATE`, guestID.Int64); err != nil {
+			return nil, fmt.Errorf("failed to lock guest: %w", err)
+		}
+	} else if generalID.Valid {
+		if _, err := tx.Exec(`SELECT id FROM generals WHERE id = $1 FOR UPDATE`, generalID.Int64); err != nil {
+			return nil, fmt.Errorf("failed to lock general: %w", err)
+		}
+	}
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM tickets WHERE id = $1 FOR UPDATE`, ticketID).Scan(&status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock ticket: %w", err)
+	}
+	if status != types.TicketActive {
+		return nil, fmt.Errorf("%w: the ticket is %s", ErrNothingToRevoke, status)
+	}
+
+	if err := revokeTicketTx(tx, ticketID, payload.Reason, !payload.Reissue); err != nil {
+		return nil, err
+	}
+
+	result := &types.RevokeTicketsResult{Revoked: 1}
+
+	switch {
+	case guestID.Valid:
+		err = s.redrawGuestTickets(tx, eventID, int(guestID.Int64), result)
+	case generalID.Valid:
+		err = s.redrawGeneralTicket(tx, eventID, int(generalID.Int64), payload.Reissue, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// Revokes every active ticket of the guest, companions included
+func (s *Store) RevokeGuestTickets(eventID int, guestID int, payload types.RevokeTicketsPayload) (*types.RevokeTicketsResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM guests WHERE id = $1 AND event_id = $2 FOR UPDATE`, guestID, eventID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("guest with id %d not found", guestID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock guest: %w", err)
+	}
+
+	revoked, err := revokeActiveTickets(tx, `guest_id = $2`, guestID, payload.Reason, !payload.Reissue)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.RevokeTicketsResult{Revoked: revoked}
+	if err := s.redrawGuestTickets(tx, eventID, guestID, result); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// Revokes the ticket of a general admission, a general only ever has one
+func (s *Store) RevokeGeneralTicket(eventID int, generalID int, payload types.RevokeTicketsPayload) (*types.RevokeTicketsResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM generals WHERE id = $1 AND event_id = $2 FOR UPDATE`, generalID, eventID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("general with id %d not found", generalID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock general: %w", err)
+	}
+
+	revoked, err := revokeActiveTickets(tx, `general_id = $2`, generalID, payload.Reason, !payload.Reissue)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.RevokeTicketsResult{Revoked: revoked}
+	if err := s.redrawGeneralTicket(tx, eventID, generalID, payload.Reissue, result); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// owner is a condition on $2, the reason is $1
+func revokeActiveTickets(tx *sql.Tx, owner string, ownerID int, reason string, withheld bool) (int, error) {
+	res, err := tx.Exec(`
+		UPDATE tickets SET status = 'revoked', revoked_at = NOW(), revoke_reason = $1, withheld = $3
+		WHERE `+owner+` AND status = 'active'
+	`, reason, ownerID, withheld)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tickets: %w", err)
+	}
+
+	revoked, _ := res.RowsAffected()
+	if revoked == 0 {
+		return 0, ErrNothingToRevoke
+	}
+
+	return int(revoked), nil
+}
+
+// The tickets were just revoked as withheld unless they are to be reissued, so
+// the rebuild replaces exactly the ones that should be
+func (s *Store) redrawGuestTickets(tx *sql.Tx, eventID int, guestID int, result *types.RevokeTicketsResult) error {
+	rebuilt, err := s.rebuildTicketsTx(tx, eventID, guestID, false, false)
+	if err != nil {
+		return err
+	}
+
+	result.Reissued = rebuilt.Added
+	return nil
+}
+
+// Generals have a single ticket, so the PDF is either replaced by one with a
+// new code or removed
+func (s *Store) redrawGeneralTicket(tx *sql.Tx, eventID int, generalID int, reissue bool, result *types.RevokeTicketsResult) error {
+	if !reissue {
+		_, err := tx.Exec(`UPDATE generals SET qr_code_url = NULL, pdf_file = NULL WHERE id = $1`, generalID)
+		if err != nil {
+			return fmt.Errorf("failed to clear general ticket: %w", err)
+		}
+		return nil
+	}
+
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	tmpl, err := getTicketTemplate(tx, eventID)
+	if err != nil {
+		return err
+	}
+
+	var folio int
+	if err := tx.QueryRow(`SELECT folio FROM generals WHERE id = $1`, generalID).Scan(&folio); err != nil {
+		return fmt.Errorf("failed to fetch general: %w", err)
+	}
+
+	code, err := newTicketCode(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to generate ticket code: %w", err)
+	}
+
+	qrBytes, err := generateQRCode(code)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR code: %w", err)
+	}
+
+	pdfData, err := renderTickets(tmpl, event, []ticketPage{{name: fmt.Sprintf("General #%d", folio), qr: qrBytes}})
+	if err != nil {
+		return err
+	}
+
+	if err := s.insertGeneralTicketIntoDB(tx, eventID, code, "general", &generalID); err != nil {
+		return fmt.Errorf("failed to insert ticket: %w", err)
+	}
+
+	job := queue.FullUploadJob{
+		TicketID:   generalID,
+		QrCodes:    []string{base64.StdEncoding.EncodeToString(qrBytes)},
+		PDFBase64:  base64.StdEncoding.EncodeToString(pdfData),
+		TicketType: "general",
+	}
+
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal FullUpload job: %w", err)
+	}
+
+	if err := queue.EnqueueJob(context.Background(), queue.FullUploadQueue, string(jobJSON)); err != nil {
+		return fmt.Errorf("failed to enqueue FullUpload job: %w", err)
+	}
+
+	result.Reissued = 1
+	return nil
+}
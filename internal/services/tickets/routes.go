@@ -1,14 +1,20 @@
 package tickets
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/diegob0/rspv_backend/internal/config"
 	"github.com/diegob0/rspv_backend/internal/services/auth"
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 )
 
@@ -25,37 +31,67 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	protected := router.PathPrefix("/tickets").Subrouter()
 	protected.Use(auth.AuthMiddleware)
 
-	// Public routes
-	router.HandleFunc("/tickets/info/{name}", h.handleGetGuestData).Methods(http.MethodGet)
+	// Public routes. The name lookup is guessable, prefer the /rsvp/{token} routes
+	if config.Envs.RSVPNameLookup {
+		router.HandleFunc("/tickets/info/{name}", h.handleGetGuestData).Methods(http.MethodGet)
+	}
 
-	protected.HandleFunc("/regenerate/{id}", h.handleRegenerateTicket).Methods(http.MethodGet)
-	protected.HandleFunc("/activate/{id}", h.handleActivateTickets).Methods(http.MethodGet)
-	protected.HandleFunc("/scan-qr/{code}", h.handleScanTicket).Methods(http.MethodGet)
+	protected.HandleFunc("/regenerate/{id}", auth.RequirePermission(auth.PermRead, h.handleRegenerateTicket)).Methods(http.MethodGet)
+	protected.HandleFunc("/rebuild/{id}", auth.RequirePermission(auth.PermWrite, h.handleRebuildTickets)).Methods(http.MethodPost)
+	protected.HandleFunc("/{ticketId:[0-9]+}/revoke", auth.RequirePermission(auth.PermWrite, h.handleRevokeTicket)).Methods(http.MethodPost)
+	protected.HandleFunc("/guest/{id}/revoke", auth.RequirePermission(auth.PermWrite, h.handleRevokeGuestTickets)).Methods(http.MethodPost)
+	protected.HandleFunc("/general/{id}/revoke", auth.RequirePermission(auth.PermWrite, h.handleRevokeGeneralTicket)).Methods(http.MethodPost)
+	protected.HandleFunc("/activate/{id}", auth.RequirePermission(auth.PermWrite, h.handleActivateTickets)).Methods(http.MethodGet)
+	protected.HandleFunc("/scan-qr/{code}", auth.RequirePermission(auth.PermScan, h.handleScanTicket)).Methods(http.MethodGet)
+	protected.HandleFunc("/scan-qr/{code}/party", auth.RequirePermission(auth.PermScan, h.handleCheckInParty)).Methods(http.MethodPost)
+	protected.HandleFunc("/guest/{id}/party", auth.RequirePermission(auth.PermRead, h.handleGetParty)).Methods(http.MethodGet)
+	protected.HandleFunc("/scans", auth.RequirePermission(auth.PermRead, h.handleGetScans)).Methods(http.MethodGet)
+	protected.HandleFunc("/{ticketId:[0-9]+}/scans", auth.RequirePermission(auth.PermRead, h.handleGetTicketHistory)).Methods(http.MethodGet)
+	protected.HandleFunc("/{ticketId:[0-9]+}/undo-check-in", auth.RequirePermission(auth.PermWrite, h.handleUndoCheckIn)).Methods(http.MethodPost)
+	protected.HandleFunc("/manifest", auth.RequirePermission(auth.PermScan, h.handleGetScanManifest)).Methods(http.MethodGet)
+	protected.HandleFunc("/sync", auth.RequirePermission(auth.PermScan, h.handleSyncScans)).Methods(http.MethodPost)
+	protected.HandleFunc("/scan-key", auth.RequirePermission(auth.PermScan, h.handleGetScanKey)).Methods(http.MethodGet)
 
-	protected.HandleFunc("/generate-general/{id}", h.handleGenerateGenerals).Methods(http.MethodGet)
-	protected.HandleFunc("/create-generals", h.handleActivateGenerals).Methods(http.MethodPost)
+	protected.HandleFunc("/generate-general/{id}", auth.RequirePermission(auth.PermRead, h.handleGenerateGenerals)).Methods(http.MethodGet)
+	protected.HandleFunc("/create-generals", auth.RequirePermission(auth.PermWrite, h.handleActivateGenerals)).Methods(http.MethodPost)
 
 	// Activate all guest tickets in the same operation
-	protected.HandleFunc("/activate-all", h.handleActivateAll).Methods(http.MethodGet)
+	protected.HandleFunc("/activate-all", auth.RequirePermission(auth.PermWrite, h.handleActivateAll)).Methods(http.MethodGet)
+
+	protected.HandleFunc("/generals", auth.RequirePermission(auth.PermRead, h.handleGetGeneralsInfo)).Methods(http.MethodGet)
+	protected.HandleFunc("/generals-unassigned", auth.RequirePermission(auth.PermRead, h.handleUnassignedGeneralsInfo)).Methods(http.MethodGet)
+	// protected.HandleFunc("/named", auth.RequirePermission(auth.PermRead, h.handleGetNamedInfo)).Methods(http.MethodGet)
 
-	protected.HandleFunc("/generals", h.handleGetGeneralsInfo).Methods(http.MethodGet)
-	protected.HandleFunc("/generals-unassigned", h.handleUnassignedGeneralsInfo).Methods(http.MethodGet)
-	// protected.HandleFunc("/named", h.handleGetNamedInfo).Methods(http.MethodGet)
+	protected.HandleFunc("/count", auth.RequirePermission(auth.PermRead, h.handleGetTicketsCount)).Methods(http.MethodGet)
 
-	protected.HandleFunc("/count", h.handleGetTicketsCount).Methods(http.MethodGet)
+	// Escort list, place cards and table cards from the current seating
+	protected.HandleFunc("/cards", auth.RequirePermission(auth.PermRead, h.handleGetSeatingCards)).Methods(http.MethodGet)
+
+	// Layout of the ticket PDFs
+	protected.HandleFunc("/template", auth.RequirePermission(auth.PermRead, h.handleGetTicketTemplate)).Methods(http.MethodGet)
+	protected.HandleFunc("/template", auth.RequirePermission(auth.PermWrite, h.handleSaveTicketTemplate)).Methods(http.MethodPut)
+	protected.HandleFunc("/template", auth.RequirePermission(auth.PermWrite, h.handleDeleteTicketTemplate)).Methods(http.MethodDelete)
+	protected.HandleFunc("/template/preview", auth.RequirePermission(auth.PermRead, h.handlePreviewTicket)).Methods(http.MethodPost)
 }
 
 // @Summary Return the guest metadata
-// @Description Return the guest tickets
+// @Description Return the guest tickets. Changing the answer is refused after the event RSVP deadline. Deprecated, disabled with RSVP_NAME_LOOKUP=false
 // @Tags tickets
+// @Param eventId path int true "Event ID"
 // @Param name path string true "Guest Name"
 // @Param confirmAttendance query bool false "Confirm attendance (true/false)"
 // @Param email query string false "Optional email to send the ticket PDF"
 // @Success 200 {array} types.ReturnGuestMetadata
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/info/{name} [get]
+// @Router /events/{eventId}/tickets/info/{name} [get]
 func (h *Handler) handleGetGuestData(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	guestName := vars["name"]
 	if guestName == "" {
@@ -69,7 +105,6 @@ func (h *Handler) handleGetGuestData(w http.ResponseWriter, r *http.Request) {
 
 	// Parse string to bool, default to false if empty or invalid
 	confirmAttendance := false
-	var err error
 	if confirmStr != "" {
 		confirmAttendance, err = strconv.ParseBool(confirmStr)
 		if err != nil {
@@ -82,7 +117,7 @@ func (h *Handler) handleGetGuestData(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 
 	// Call GenerateTickets using guestName instead of ID
-	t, err := h.store.GetTicketInfo(guestName, confirmAttendance, email)
+	t, err := h.store.GetTicketInfo(eventID, guestName, confirmAttendance, email)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -96,12 +131,19 @@ func (h *Handler) handleGetGuestData(w http.ResponseWriter, r *http.Request) {
 // @Description Generate the tickets and stores the urls into the guest table
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/activate/{id} [get]
+// @Router /events/{eventId}/tickets/activate/{id} [get]
 func (h *Handler) handleActivateTickets(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -112,7 +154,7 @@ func (h *Handler) handleActivateTickets(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.store.GenerateTicket(id)
+	err = h.store.GenerateTicket(eventID, id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -125,12 +167,19 @@ func (h *Handler) handleActivateTickets(w http.ResponseWriter, r *http.Request)
 // @Description Generate all the tickets that have not being generated yet
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Success 204 "No content"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/activate-all [get]
+// @Router /events/{eventId}/tickets/activate-all [get]
 func (h *Handler) handleActivateAll(w http.ResponseWriter, r *http.Request) {
-	err := h.store.GenerateAllTickets()
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.store.GenerateAllTickets(eventID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -143,12 +192,19 @@ func (h *Handler) handleActivateAll(w http.ResponseWriter, r *http.Request) {
 // @Description Regenerate a ticket that has been already been generated
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param id path int true "Guest ID"
 // @Success 200 {file} file "PDF Ticket"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/regenerate/{id} [get]
+// @Router /events/{eventId}/tickets/regenerate/{id} [get]
 func (h *Handler) handleRegenerateTicket(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -158,7 +214,7 @@ func (h *Handler) handleRegenerateTicket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	pdfData, err := h.store.RegenerateTicket(id)
+	pdfData, err := h.store.RegenerateTicket(eventID, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -170,42 +226,603 @@ func (h *Handler) handleRegenerateTicket(w http.ResponseWriter, r *http.Request)
 	w.Write(pdfData)
 }
 
+// @Summary Rebuild the tickets of a guest
+// @Description Draws the guest's tickets again from their current name, companions and table. Codes are kept unless rotateCodes is true; new additionals get new tickets and the ones no longer needed are revoked. People whose ticket was revoked without reissue stay without one unless reissue is true. The stored PDF and QR images are replaced by the worker.
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Param rotateCodes query bool false "Give the unused tickets new codes (default false)"
+// @Param reissue query bool false "Give new tickets to people whose ticket was revoked without reissue (default false)"
+// @Success 200 {object} types.RebuildTicketsResult
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/rebuild/{id} [post]
+func (h *Handler) handleRebuildTickets(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	rotateCodes := false
+	if rotateStr := r.URL.Query().Get("rotateCodes"); rotateStr != "" {
+		rotateCodes, err = strconv.ParseBool(rotateStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid rotateCodes value"))
+			return
+		}
+	}
+
+	reissue := false
+	if reissueStr := r.URL.Query().Get("reissue"); reissueStr != "" {
+		reissue, err = strconv.ParseBool(reissueStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid reissue value"))
+			return
+		}
+	}
+
+	result, err := h.store.RebuildTickets(eventID, id, rotateCodes, reissue)
+	if err != nil {
+		if errors.Is(err, ErrTicketsNotGenerated) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// @Summary Revoke a ticket
+// @Description Marks the ticket as revoked so scanning it is refused, and draws its guest's or general's PDF again. With reissue the revoked code is replaced by a new one.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param ticketId path int true "Ticket ID"
+// @Param payload body types.RevokeTicketsPayload true "Reason and reissue"
+// @Success 200 {object} types.RevokeTicketsResult
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/{ticketId}/revoke [post]
+func (h *Handler) handleRevokeTicket(w http.ResponseWriter, r *http.Request) {
+	h.revoke(w, r, "ticketId", "invalid ticket ID", h.store.RevokeTicket)
+}
+
+// @Summary Revoke the tickets of a guest
+// @Description Revokes every active ticket of the guest and their companions. With reissue they get new codes, otherwise the stored PDF keeps only the used tickets.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Param payload body types.RevokeTicketsPayload true "Reason and reissue"
+// @Success 200 {object} types.RevokeTicketsResult
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/guest/{id}/revoke [post]
+func (h *Handler) handleRevokeGuestTickets(w http.ResponseWriter, r *http.Request) {
+	h.revoke(w, r, "id", "invalid guest ID", h.store.RevokeGuestTickets)
+}
+
+// @Summary Revoke the ticket of a general
+// @Description Revokes the general's active ticket. With reissue a new code and PDF are issued, otherwise the stored files are removed.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "General ID"
+// @Param payload body types.RevokeTicketsPayload true "Reason and reissue"
+// @Success 200 {object} types.RevokeTicketsResult
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/general/{id}/revoke [post]
+func (h *Handler) handleRevokeGeneralTicket(w http.ResponseWriter, r *http.Request) {
+	h.revoke(w, r, "id", "invalid general ID", h.store.RevokeGeneralTicket)
+}
+
+// The three revoke routes only differ in what the path id points to
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request, param string, invalid string, revoke func(int, int, types.RevokeTicketsPayload) (*types.RevokeTicketsResult, error)) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)[param])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s", invalid))
+		return
+	}
+
+	var payload types.RevokeTicketsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	result, err := revoke(eventID, id, payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTicketNotFound):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrNothingToRevoke), errors.Is(err, ErrTicketsNotGenerated):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
 // @Summary Scan a ticket by QR code
-// @Description Validates a ticket code, marks it as used, and returns guest and table info.
+// @Description Validates a ticket code, marks it as used, and returns guest and table info. For parties of more than one, party says how many arrived and who is still missing. Every attempt is logged with the user, device and gate.
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param code path string true "Ticket Code"
+// @Param deviceId query string false "Scanner device"
+// @Param gate query string false "Door or gate the scan was made at"
 // @Success 200 {object} types.ReturnScannedData
 // @Failure 400 {object} types.ErrorResponse
+// @Failure 403 {object} types.ErrorResponse // Forged code
 // @Failure 404 {object} types.ErrorResponse
-// @Failure 409 {object} types.ErrorResponse // Already used
+// @Failure 409 {object} types.UsedResponse
+// @Failure 410 {object} types.RevokedResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/scan-qr/{code} [get]
+// @Router /events/{eventId}/tickets/scan-qr/{code} [get]
 func (h *Handler) handleScanTicket(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	scan, err := scanContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	code := vars["code"]
 
-	result, err := h.store.ScanQR(code)
+	result, err := h.store.ScanQR(eventID, code, scan)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeScanError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// @Summary Check in a whole party
+// @Description Checks in every ticket of the guest's party still outside from any one of its codes, for a host arriving with everyone. On events with re-entry the members who stepped out are let back in (reentered); otherwise tickets already used are left as they are.
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param code path string true "Code of any ticket of the party"
+// @Param deviceId query string false "Scanner device"
+// @Param gate query string false "Door or gate the scan was made at"
+// @Success 200 {object} types.PartyCheckIn
+// @Failure 400 {object} types.ErrorResponse // General ticket
+// @Failure 403 {object} types.ErrorResponse // Forged code
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.UsedResponse // Everyone is in
+// @Failure 410 {object} types.RevokedResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/scan-qr/{code}/party [post]
+func (h *Handler) handleCheckInParty(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	scan, err := scanContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.store.CheckInParty(eventID, mux.Vars(r)["code"], scan)
+	if err != nil {
+		writeScanError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// @Summary Party arrivals
+// @Description How many of the guest's party arrived, with every member and the status of their ticket
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param id path int true "Guest ID"
+// @Success 200 {object} types.PartyStatus
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/guest/{id}/party [get]
+func (h *Handler) handleGetParty(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	guestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid guest ID"))
+		return
+	}
+
+	party, err := h.store.GetParty(eventID, guestID)
+	if errors.Is(err, ErrGuestNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, party)
+}
+
+// Longest deviceId and gate the scan log keeps, the same limit offline syncs
+// are validated with
+const maxScanField = 100
+
+// Who scans and where, from the token and the query
+func scanContext(r *http.Request) (types.ScanContext, error) {
+	scan := types.ScanContext{
+		DeviceID: r.URL.Query().Get("deviceId"),
+		Gate:     r.URL.Query().Get("gate"),
+	}
+	if len(scan.DeviceID) > maxScanField {
+		return scan, fmt.Errorf("deviceId can be at most %d characters", maxScanField)
+	}
+	if len(scan.Gate) > maxScanField {
+		return scan, fmt.Errorf("gate can be at most %d characters", maxScanField)
+	}
+
+	if userID, ok := auth.UserIDFromContext(r.Context()); ok {
+		scan.UserID = &userID
+	}
+
+	return scan, nil
+}
+
+func writeScanError(w http.ResponseWriter, err error) {
+	var used *types.UsedTicket
+	var revoked *types.RevokedTicket
+
+	switch {
+	case errors.Is(err, ErrForgedCode):
+		utils.WriteError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrInvalidCode):
+		utils.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrNotAParty):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	case errors.As(err, &used):
+		utils.WriteJSON(w, http.StatusConflict, types.UsedResponse{Error: used.Error(), UsedAt: used.UsedAt})
+	case errors.As(err, &revoked):
+		utils.WriteJSON(w, http.StatusGone, types.RevokedResponse{
+			Error:     revoked.Error(),
+			Reason:    revoked.Reason,
+			RevokedAt: revoked.RevokedAt,
+		})
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// @Summary Scan log
+// @Description Every scan attempt of the event, newest first: admitted, duplicate, invalid, forged, revoked, exited, reentered or undone, with the user, device and gate.
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param result query string false "admitted, duplicate, invalid, forged, revoked, exited, reentered or undone"
+// @Param gate query string false "Gate"
+// @Param deviceId query string false "Scanner device"
+// @Param userId query int false "User who scanned"
+// @Param search query string false "Part of the scanned code"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} types.PaginatedResult[types.ScanLogEntry]
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/scans [get]
+func (h *Handler) handleGetScans(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filters := types.ScanFilters{
+		Result:   query.Get("result"),
+		Gate:     query.Get("gate"),
+		DeviceID: query.Get("deviceId"),
+	}
+
+	switch filters.Result {
+	case "", types.ScanAdmitted, types.ScanDuplicate, types.ScanInvalid, types.ScanForged, types.ScanRevoked,
+		types.ScanExited, types.ScanReentered, types.ScanUndone:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid result %q", filters.Result))
+		return
+	}
+
+	if userStr := query.Get("userId"); userStr != "" {
+		userID, err := strconv.Atoi(userStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+			return
+		}
+		filters.UserID = &userID
+	}
+
+	scans, err := h.store.GetScans(eventID, filters, utils.ParsePaginationParams(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, scans)
+}
+
+// @Summary Ticket history
+// @Description The ticket with its holder, status changes and every scan of its code, oldest first
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param ticketId path int true "Ticket ID"
+// @Success 200 {object} types.TicketHistory
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/{ticketId}/scans [get]
+func (h *Handler) handleGetTicketHistory(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ticketID, err := strconv.Atoi(mux.Vars(r)["ticketId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid ticket ID"))
+		return
+	}
+
+	history, err := h.store.GetTicketHistory(eventID, ticketID)
+	if err != nil {
+		if errors.Is(err, ErrTicketNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, history)
+}
+
+// @Summary Undo a check-in
+// @Description Takes back the check-in of a used ticket, e.g. a mistaken scan, so it can be scanned again. The undo is logged with the operator and the reason.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param ticketId path int true "Ticket ID"
+// @Param payload body types.UndoCheckInPayload true "Reason"
+// @Success 200 {object} types.TicketHistory
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 404 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/{ticketId}/undo-check-in [post]
+func (h *Handler) handleUndoCheckIn(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ticketID, err := strconv.Atoi(mux.Vars(r)["ticketId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid ticket ID"))
+		return
+	}
+
+	var payload types.UndoCheckInPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	var userID *int
+	if id, ok := auth.UserIDFromContext(r.Context()); ok {
+		userID = &id
+	}
+
+	history, err := h.store.UndoCheckIn(eventID, ticketID, payload.Reason, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTicketNotFound):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrNotCheckedIn):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, history)
+}
+
+// @Summary Offline scan manifest
+// @Description Every active and used ticket of the event with its code hashed (hex SHA-256) and the name, host, folio and table an online scan shows, so a scanner can check people in without a connection
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.ScanManifest
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/manifest [get]
+func (h *Handler) handleGetScanManifest(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	manifest, err := h.store.GetScanManifest(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, manifest)
+}
+
+// @Summary Upload offline scans
+// @Description Applies check-ins a scanner recorded while disconnected, with the device times. When several devices admitted the same ticket the earliest scan wins, whatever the upload order; the rest come back as conflicts. Uploading the same scans again is a no-op.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.SyncScansPayload true "Device, gate and scans"
+// @Success 200 {object} types.SyncScansResult
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/sync [post]
+func (h *Handler) handleSyncScans(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.SyncScansPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	var userID *int
+	if id, ok := auth.UserIDFromContext(r.Context()); ok {
+		userID = &id
+	}
+
+	result, err := h.store.SyncScans(eventID, userID, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, result)
 }
 
+// @Summary Key to verify ticket codes
+// @Description Returns the event key ticket signatures are made with, so a scanner can tell forged codes apart without a connection. Signed codes are "v1.<random>.<signature>" where the signature is the first 16 bytes of HMAC-SHA256(key, "v1.<random>"), base64url without padding.
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.ScanKeyResponse
+// @Failure 400 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/scan-key [get]
+func (h *Handler) handleGetScanKey(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.ScanKeyResponse{
+		EventID:     eventID,
+		Version:     codeVersion,
+		Key:         base64.RawURLEncoding.EncodeToString(eventSigningKey(eventID)),
+		LegacyCodes: config.Envs.LegacyTicketCodes,
+	})
+}
+
 // @Summary Create general tickets
 // @Description Generates general tickets and enqueues background jobs for QR and PDF upload.
 // @Tags tickets
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param count query int true "Number of general tickets to generate"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/create-generals [post]/
+// @Router /events/{eventId}/tickets/create-generals [post]/
 func (h *Handler) handleActivateGenerals(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	countStr := r.URL.Query().Get("count")
 	if countStr == "" {
 		http.Error(w, "Missing 'count' query param", http.StatusBadRequest)
@@ -218,7 +835,7 @@ func (h *Handler) handleActivateGenerals(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.store.GenerateGeneralTicket(count)
+	err = h.store.GenerateGeneralTicket(eventID, count)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to generate tickets: %v", err), http.StatusInternalServerError)
 		return
@@ -234,12 +851,19 @@ func (h *Handler) handleActivateGenerals(w http.ResponseWriter, r *http.Request)
 // @Description Get a PDF file for a single general ticket
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Param id path int true "General ID"
 // @Success 200 {file} file "PDF Ticket"
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/generate-general/{id} [get]
+// @Router /events/{eventId}/tickets/generate-general/{id} [get]
 func (h *Handler) handleGenerateGenerals(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -249,7 +873,7 @@ func (h *Handler) handleGenerateGenerals(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	pdfData, err := h.store.GenerateGeneral(id)
+	pdfData, err := h.store.GenerateGeneral(eventID, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -266,16 +890,23 @@ func (h *Handler) handleGenerateGenerals(w http.ResponseWriter, r *http.Request)
 // @Tags tickets
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number (default is 1)"
 // @Param page_size query int false "Page size (default is 10)"
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.GeneralTicket]
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/generals [get]
+// @Router /events/{eventId}/tickets/generals [get]
 func (h *Handler) handleGetGeneralsInfo(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	paginated, err := h.store.GetGeneralTicketsInfo(params)
+	paginated, err := h.store.GetGeneralTicketsInfo(eventID, params)
 	if err != nil {
 		log.Printf("❌ Failed to get general tickets: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
@@ -292,16 +923,23 @@ func (h *Handler) handleGetGeneralsInfo(w http.ResponseWriter, r *http.Request)
 // @Tags tickets
 // @Security BearerAuth
 // @Produce json
+// @Param eventId path int true "Event ID"
 // @Param page query int false "Page number (default is 1)"
 // @Param page_size query int false "Page size (default is 10)"
 // @Param search query string false "Search term to filter tables by name"
 // @Success 200 {object} types.PaginatedResult[types.GeneralTicket]
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/generals-unassigned [get]
+// @Router /events/{eventId}/tickets/generals-unassigned [get]
 func (h *Handler) handleUnassignedGeneralsInfo(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	params := utils.ParsePaginationParams(r)
 
-	paginated, err := h.store.GetUnassignedGeneralTickets(params)
+	paginated, err := h.store.GetUnassignedGeneralTickets(eventID, params)
 	if err != nil {
 		log.Printf("❌ Failed to get general tickets: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
@@ -334,14 +972,21 @@ func (h *Handler) handleUnassignedGeneralsInfo(w http.ResponseWriter, r *http.Re
 // }
 
 // @Summary Get ticket counts
-// @Description Returns the total number of named, general, and all tickets.
+// @Description Returns the total number of named, general, and all tickets, and guests per RSVP status (pending, accepted, declined).
 // @Tags tickets
 // @Security BearerAuth
+// @Param eventId path int true "Event ID"
 // @Success 200 {object} types.AllTickets
 // @Failure 500 {object} types.ErrorResponse
-// @Router /tickets/count [get]
+// @Router /events/{eventId}/tickets/count [get]
 func (h *Handler) handleGetTicketsCount(w http.ResponseWriter, r *http.Request) {
-	counts, err := h.store.GetTicketsCount()
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	counts, err := h.store.GetTicketsCount(eventID)
 	if err != nil {
 		log.Printf("❌ Failed to get ticket counts: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
@@ -352,3 +997,200 @@ func (h *Handler) handleGetTicketsCount(w http.ResponseWriter, r *http.Request)
 
 	utils.WriteJSON(w, http.StatusOK, counts)
 }
+
+// @Summary Print the seating cards
+// @Description Returns a single print-ready PDF with the alphabetical escort list, a folding place card per seated guest and named companion, and a folding tent card per table listing who sits there
+// @Tags tickets
+// @Security BearerAuth
+// @Produce application/pdf
+// @Param eventId path int true "Event ID"
+// @Param include query string false "Comma separated sections: escort, place, table (default all)"
+// @Param paper query string false "Paper size: Letter, Legal, Tabloid, A3, A4 or A5 (default Letter)"
+// @Success 200 {file} file "PDF cards"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/cards [get]
+func (h *Handler) handleGetSeatingCards(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	paper, err := utils.ParsePaperSize(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sections := []string{types.CardsEscort, types.CardsPlace, types.CardsTable}
+	if include := r.URL.Query().Get("include"); include != "" {
+		sections = nil
+		for _, section := range strings.Split(include, ",") {
+			section = strings.ToLower(strings.TrimSpace(section))
+			if section != types.CardsEscort && section != types.CardsPlace && section != types.CardsTable {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown section %q, use escort, place or table", section))
+				return
+			}
+			sections = append(sections, section)
+		}
+	}
+
+	cards, err := h.store.GetSeatingCards(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := RenderSeatingCards(&buf, cards, paper, sections); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tarjetas-%d.pdf\"", eventID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// @Summary Get the ticket template
+// @Description Returns the layout used to draw the event's tickets, the built-in one (default true) until a template is saved
+// @Tags tickets
+// @Security BearerAuth
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Success 200 {object} types.TicketTemplate
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/template [get]
+func (h *Handler) handleGetTicketTemplate(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tmpl, err := h.store.GetTicketTemplate(eventID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tmpl)
+}
+
+// @Summary Save the ticket template
+// @Description Replaces the layout of the event's tickets: page size, background asset, text fields and QR placement, all in millimeters. Tickets generated from now on use it.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event ID"
+// @Param payload body types.SaveTicketTemplatePayload true "Template"
+// @Success 200 {object} types.TicketTemplate
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/template [put]
+func (h *Handler) handleSaveTicketTemplate(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.SaveTicketTemplatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	tmpl, err := h.store.SaveTicketTemplate(eventID, payload)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTemplate) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tmpl)
+}
+
+// @Summary Reset the ticket template
+// @Description Deletes the saved template so the event's tickets use the built-in layout again
+// @Tags tickets
+// @Security BearerAuth
+// @Param eventId path int true "Event ID"
+// @Success 204 "No content"
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/template [delete]
+func (h *Handler) handleDeleteTicketTemplate(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.DeleteTicketTemplate(eventID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// @Summary Preview a ticket
+// @Description Draws a sample ticket with the given template, or the saved one when it is missing. No ticket or code is created.
+// @Tags tickets
+// @Security BearerAuth
+// @Accept json
+// @Produce application/pdf
+// @Param eventId path int true "Event ID"
+// @Param payload body types.PreviewTicketPayload true "Template and sample data"
+// @Success 200 {file} file "PDF Ticket"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /events/{eventId}/tickets/template/preview [post]
+func (h *Handler) handlePreviewTicket(w http.ResponseWriter, r *http.Request) {
+	eventID, err := utils.ParseEventID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.PreviewTicketPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	pdfData, err := h.store.PreviewTicket(eventID, payload)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTemplate) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\"preview.pdf\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdfData)
+}
@@ -1 +1,189 @@
 package tickets
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/gorilla/mux"
+)
+
+func TestTicketHandlers(t *testing.T) {
+	handler := NewHandler(&mockTicketStore{})
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{eventId}/tickets/{ticketId}/revoke", handler.handleRevokeTicket)
+	router.HandleFunc("/events/{eventId}/tickets/scan-qr/{code}", handler.handleScanTicket)
+	router.HandleFunc("/events/{eventId}/tickets/scan-qr/{code}/party", handler.handleCheckInParty)
+	router.HandleFunc("/events/{eventId}/tickets/{ticketId}/undo-check-in", handler.handleUndoCheckIn)
+	router.HandleFunc("/events/{eventId}/tickets/scans", handler.handleGetScans)
+
+	t.Run("should require a reason", func(t *testing.T) {
+		body, _ := json.Marshal(types.RevokeTicketsPayload{Reissue: true})
+		req := httptest.NewRequest(http.MethodPost, "/events/1/tickets/5/revoke", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should report tickets that are not active as a conflict", func(t *testing.T) {
+		body, _ := json.Marshal(types.RevokeTicketsPayload{Reason: "lost phone"})
+		req := httptest.NewRequest(http.MethodPost, "/events/1/tickets/5/revoke", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should answer gone with the reason for a revoked code", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events/1/tickets/scan-qr/REVOKED", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusGone {
+			t.Fatalf("expected status code %d, got %d", http.StatusGone, rr.Code)
+		}
+
+		var res types.RevokedResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Reason != "lost phone" {
+			t.Errorf("expected the revoke reason, got %q", res.Reason)
+		}
+	})
+
+	t.Run("should map every refused scan to its own status", func(t *testing.T) {
+		for code, status := range map[string]int{
+			"UNKNOWN": http.StatusNotFound,
+			"USED":    http.StatusConflict,
+			"FORGED":  http.StatusForbidden,
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/events/1/tickets/scan-qr/"+code, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != status {
+				t.Errorf("%s: expected status code %d, got %d", code, status, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should refuse a device id longer than the scan log keeps", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events/1/tickets/scan-qr/USED?deviceId="+strings.Repeat("x", 101), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should require a reason to undo a check-in", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/events/1/tickets/5/undo-check-in", bytes.NewBufferString(`{}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not undo a ticket that is not checked in", func(t *testing.T) {
+		body, _ := json.Marshal(types.UndoCheckInPayload{Reason: "scanned by mistake"})
+		req := httptest.NewRequest(http.MethodPost, "/events/1/tickets/5/undo-check-in", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should filter the scan log by undone check-ins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events/1/tickets/scans?result=undone", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var res types.PaginatedResult[types.ScanLogEntry]
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 1 || res.Data[0].Result != types.ScanUndone {
+			t.Errorf("expected only the undone scan, got %+v", res.Data)
+		}
+	})
+
+	t.Run("should refuse an unknown scan result", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events/1/tickets/scans?result=teleported", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should refuse to check in a party from a general ticket", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/events/1/tickets/scan-qr/GENERAL/party", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+// Only the methods the tests reach are implemented
+type mockTicketStore struct {
+	types.TicketStore
+}
+
+func (m *mockTicketStore) RevokeTicket(eventID int, ticketID int, payload types.RevokeTicketsPayload) (*types.RevokeTicketsResult, error) {
+	return nil, ErrNothingToRevoke
+}
+
+func (m *mockTicketStore) ScanQR(eventID int, code string, scan types.ScanContext) (types.QRScanResult, error) {
+	now := time.Now()
+	switch code {
+	case "REVOKED":
+		return nil, &types.RevokedTicket{Reason: "lost phone", RevokedAt: now}
+	case "USED":
+		return nil, &types.UsedTicket{UsedAt: &now}
+	case "FORGED":
+		return nil, ErrForgedCode
+	}
+	return nil, ErrInvalidCode
+}
+
+func (m *mockTicketStore) CheckInParty(eventID int, code string, scan types.ScanContext) (*types.PartyCheckIn, error) {
+	return nil, ErrNotAParty
+}
+
+func (m *mockTicketStore) UndoCheckIn(eventID int, ticketID int, reason string, userID *int) (*types.TicketHistory, error) {
+	return nil, ErrNotCheckedIn
+}
+
+func (m *mockTicketStore) GetScans(eventID int, filters types.ScanFilters, params types.PaginationParams) (*types.PaginatedResult[types.ScanLogEntry], error) {
+	scans := make([]types.ScanLogEntry, 0)
+	for _, result := range []string{types.ScanAdmitted, types.ScanExited, types.ScanUndone} {
+		if filters.Result == "" || filters.Result == result {
+			scans = append(scans, types.ScanLogEntry{Result: result})
+		}
+	}
+	return &types.PaginatedResult[types.ScanLogEntry]{Data: scans, Page: 1, PageSize: 10, TotalCount: len(scans), TotalPages: 1}, nil
+}
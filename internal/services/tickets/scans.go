@@ -0,0 +1,130 @@
+package tickets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+)
+
+// The log outcome of a refused scan, empty for errors that say nothing about
+// the code (the database being down, for one)
+func refusalOutcome(err error) string {
+	var used *types.UsedTicket
+	var revoked *types.RevokedTicket
+
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		return types.ScanInvalid
+	case errors.Is(err, ErrForgedCode):
+		return types.ScanForged
+	case errors.As(err, &used):
+		return types.ScanDuplicate
+	case errors.As(err, &revoked):
+		return types.ScanRevoked
+	}
+
+	return ""
+}
+
+// A lost log row must not turn the guest away at the door, so failures are
+// only logged
+func (s *Store) recordScan(eventID int, ticketID *int, code string, outcome string, scan types.ScanContext) {
+	_, err := s.db.Exec(`
+		INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, device_id, gate)
+		VALUES ($1, $2, LEFT($3, 100), $4, $5, NULLIF(LEFT($6, 100), ''), NULLIF(LEFT($7, 100), ''))
+	`, eventID, ticketID, code, outcome, scan.UserID, scan.DeviceID, scan.Gate)
+	if err != nil {
+		log.Printf("failed to record %s scan for event %d: %v", outcome, eventID, err)
+	}
+}
+
+const scanLogColumns = `
+	SELECT s.id, s.ticket_id, s.code, s.result, s.user_id, u.email, s.device_id, s.gate, s.scanned_at, s.offline, s.note
+	FROM ticket_scans s
+	LEFT JOIN users u ON u.id = s.user_id
+`
+
+func scanLogEntry(rows *sql.Rows) (types.ScanLogEntry, error) {
+	var e types.ScanLogEntry
+	err := rows.Scan(&e.ID, &e.TicketID, &e.Code, &e.Result, &e.UserID, &e.Operator, &e.DeviceID, &e.Gate, &e.ScannedAt, &e.Offline, &e.Note)
+	return e, err
+}
+
+// Newest first. Search matches the scanned code
+func (s *Store) GetScans(eventID int, filters types.ScanFilters, params types.PaginationParams) (*types.PaginatedResult[types.ScanLogEntry], error) {
+	whereClause := " WHERE s.event_id = $1"
+	args := []interface{}{eventID}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		whereClause += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	if filters.Result != "" {
+		add("s.result = $%d", filters.Result)
+	}
+	if filters.Gate != "" {
+		add("s.gate = $%d", filters.Gate)
+	}
+	if filters.DeviceID != "" {
+		add("s.device_id = $%d", filters.DeviceID)
+	}
+	if filters.UserID != nil {
+		add("s.user_id = $%d", *filters.UserID)
+	}
+	if params.Search != nil && *params.Search != "" {
+		add("s.code ILIKE $%d", "%"+*params.Search+"%")
+	}
+
+	baseQuery := scanLogColumns + whereClause
+	countQuery := `SELECT COUNT(*) FROM ticket_scans s` + whereClause
+
+	return utils.Paginate(s.db, baseQuery, countQuery, scanLogEntry, params, "s.scanned_at DESC, s.id DESC", args...)
+}
+
+func (s *Store) GetTicketHistory(eventID int, ticketID int) (*types.TicketHistory, error) {
+	h := types.TicketHistory{TicketID: ticketID}
+
+	err := s.db.QueryRow(`
+		SELECT t.code, t.type, t.status, COALESCE(c.full_name, g.full_name), ge.folio,
+		       t.created_at, t.used_at, t.present, t.revoked_at, t.revoke_reason
+		FROM tickets t
+		LEFT JOIN guests g ON g.id = t.guest_id
+		LEFT JOIN companions c ON c.id = t.companion_id
+		LEFT JOIN generals ge ON ge.id = t.general_id
+		WHERE t.id = $1 AND t.event_id = $2
+	`, ticketID, eventID).Scan(&h.Code, &h.Type, &h.Status, &h.Holder, &h.Folio, &h.CreatedAt, &h.UsedAt, &h.Present, &h.RevokedAt, &h.RevokeReason)
+	if err == sql.ErrNoRows {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ticket: %w", err)
+	}
+
+	rows, err := s.db.Query(scanLogColumns+`
+		WHERE s.ticket_id = $1 AND s.event_id = $2
+		ORDER BY s.scanned_at, s.id
+	`, ticketID, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scans: %w", err)
+	}
+	defer rows.Close()
+
+	h.Scans = make([]types.ScanLogEntry, 0)
+	for rows.Next() {
+		e, err := scanLogEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scan log: %w", err)
+		}
+		h.Scans = append(h.Scans, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
@@ -1,7 +1,6 @@
 package tickets
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/base64"
@@ -10,21 +9,18 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/diegob0/rspv_backend/internal/services/checkins"
 	"github.com/diegob0/rspv_backend/internal/services/jobs/queue"
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/diegob0/rspv_backend/internal/utils"
-	"github.com/jung-kurt/gofpdf"
 	"github.com/lib/pq"
 	"github.com/skip2/go-qrcode"
-	"golang.org/x/text/encoding/charmap"
 )
 
 type Store struct {
@@ -35,14 +31,28 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+// Get the event
+func (s *Store) getEventByID(tx *sql.Tx, eventID int) (*types.Event, error) {
+	var e types.Event
+	err := tx.QueryRow(`
+		SELECT id, name, event_date, venue, timezone, background_image, text_color, rsvp_deadline
+		FROM events
+		WHERE id = $1
+	`, eventID).Scan(&e.ID, &e.Name, &e.EventDate, &e.Venue, &e.Timezone, &e.BackgroundImage, &e.TextColor, &e.RSVPDeadline)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
 // Get the guest
-func (s *Store) getGuestByID(tx *sql.Tx, guestID int) (*types.Guest, error) {
+func (s *Store) getGuestByID(tx *sql.Tx, eventID int, guestID int) (*types.Guest, error) {
 	var g types.Guest
 	err := tx.QueryRow(`
-		SELECT id, full_name, additionals, ticket_generated, confirm_attendance, ticket_sent
+		SELECT id, full_name, additionals, ticket_generated, rsvp_status, ticket_sent
 		FROM guests
-		WHERE id = $1
-	`, guestID).Scan(&g.ID, &g.FullName, &g.Additionals, &g.TicketGenerated, &g.ConfirmAttendance, &g.TicketSent)
+		WHERE id = $1 AND event_id = $2
+	`, guestID, eventID).Scan(&g.ID, &g.FullName, &g.Additionals, &g.TicketGenerated, &g.RSVPStatus, &g.TicketSent)
 	if err != nil {
 		return nil, err
 	}
@@ -50,14 +60,14 @@ func (s *Store) getGuestByID(tx *sql.Tx, guestID int) (*types.Guest, error) {
 }
 
 // Regenerate tickets
-func (s *Store) RegenerateTicket(guestID int) ([]byte, error) {
+func (s *Store) RegenerateTicket(eventID int, guestID int) ([]byte, error) {
 	var pdfURL string
 
 	err := s.db.QueryRow(`
-	SELECT pdf_files
+	SELECT COALESCE(pdf_files, '')
 	FROM guests
-	WHERE id = $1
-`, guestID).Scan(&pdfURL)
+	WHERE id = $1 AND event_id = $2
+`, guestID, eventID).Scan(&pdfURL)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("guest not found")
@@ -78,14 +88,14 @@ func (s *Store) RegenerateTicket(guestID int) ([]byte, error) {
 }
 
 // Generate generals
-func (s *Store) GenerateGeneral(generalID int) ([]byte, error) {
+func (s *Store) GenerateGeneral(eventID int, generalID int) ([]byte, error) {
 	var pdfURL string
 
 	err := s.db.QueryRow(`
-	SELECT pdf_file
+	SELECT COALESCE(pdf_file, '')
 	FROM generals
-	WHERE id = $1
-`, generalID).Scan(&pdfURL)
+	WHERE id = $1 AND event_id = $2
+`, generalID, eventID).Scan(&pdfURL)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("general not found")
@@ -106,7 +116,7 @@ func (s *Store) GenerateGeneral(generalID int) ([]byte, error) {
 }
 
 // Get the tikcet info
-func (s *Store) GetTicketInfo(guestName string, confirmAttendance bool, email string) ([]types.ReturnGuestMetadata, error) {
+func (s *Store) GetTicketInfo(eventID int, guestName string, confirmAttendance bool, email string) ([]types.ReturnGuestMetadata, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin the transaction %w", err)
@@ -127,8 +137,8 @@ func (s *Store) GetTicketInfo(guestName string, confirmAttendance bool, email st
 
 	var guestID int
 	err = s.db.QueryRow(`
-		SELECT id FROM guests WHERE LOWER(full_name) = $1
-	`, normalized).Scan(&guestID)
+		SELECT id FROM guests WHERE LOWER(full_name) = $1 AND event_id = $2
+	`, normalized, eventID).Scan(&guestID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("guest %s not found", guestName)
@@ -136,7 +146,7 @@ func (s *Store) GetTicketInfo(guestName string, confirmAttendance bool, email st
 		return nil, fmt.Errorf("failed to find guest ID: %w", err)
 	}
 
-	guest, err := s.getGuestByID(tx, guestID)
+	guest, err := s.getGuestByID(tx, eventID, guestID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch guest: %w", err)
 	}
@@ -145,16 +155,30 @@ func (s *Store) GetTicketInfo(guestName string, confirmAttendance bool, email st
 		return nil, fmt.Errorf("ticket already generated for this guest: %v", guestID)
 	}
 
-	if guest.ConfirmAttendance != confirmAttendance {
-		_, err := tx.Exec(`UPDATE guests SET confirm_attendance = $1 WHERE id = $2`, confirmAttendance, guestID)
+	status := types.RSVPDeclined
+	if confirmAttendance {
+		status = types.RSVPAccepted
+	}
+
+	if guest.RSVPStatus != status {
+		event, err := s.getEventByID(tx, eventID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch event: %w", err)
+		}
+
+		if event.RSVPClosed(time.Now()) {
+			return nil, fmt.Errorf("the RSVP deadline has passed, answers can no longer be changed")
+		}
+
+		_, err = tx.Exec(`UPDATE guests SET rsvp_status = $1, responded_at = NOW() WHERE id = $2`, status, guestID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to update attendance confirmation: %w", err)
 		}
 
-		guest.ConfirmAttendance = confirmAttendance
+		guest.RSVPStatus = status
 	}
 
-	if !guest.ConfirmAttendance {
+	if guest.RSVPStatus != types.RSVPAccepted {
 		return nil, fmt.Errorf("user must confirm attendance before generating the ticket")
 	}
 
@@ -222,8 +246,8 @@ func (s *Store) GetTicketInfo(guestName string, confirmAttendance bool, email st
 	return []types.ReturnGuestMetadata{metadata}, nil
 }
 
-func (s *Store) GenerateAllTickets() error {
-	guests, err := s.getAllGuestsWithoutTickets()
+func (s *Store) GenerateAllTickets(eventID int) error {
+	guests, err := s.getAllGuestsWithoutTickets(eventID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch guests without tickets: %w", err)
 	}
@@ -234,7 +258,7 @@ func (s *Store) GenerateAllTickets() error {
 	}
 
 	for _, guest := range guests {
-		err := s.GenerateTicket(guest.ID)
+		err := s.GenerateTicket(eventID, guest.ID)
 		if err != nil {
 
 			log.Printf("failed to generate ticket for guest ID %d: %v", guest.ID, err)
@@ -246,8 +270,8 @@ func (s *Store) GenerateAllTickets() error {
 	return nil
 }
 
-func (s *Store) getAllGuestsWithoutTickets() ([]*types.Guest, error) {
-	rows, err := s.db.Query(`SELECT id, full_name, additionals, ticket_generated FROM guests WHERE ticket_generated = FALSE`)
+func (s *Store) getAllGuestsWithoutTickets(eventID int) ([]*types.Guest, error) {
+	rows, err := s.db.Query(`SELECT id, full_name, additionals, ticket_generated FROM guests WHERE ticket_generated = FALSE AND event_id = $1`, eventID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query guests: %w", err)
 	}
@@ -272,7 +296,7 @@ func (s *Store) getAllGuestsWithoutTickets() ([]*types.Guest, error) {
 }
 
 // Public function to activate the tickets(generate them and store them in s3)
-func (s *Store) GenerateTicket(guestID int) error {
+func (s *Store) GenerateTicket(eventID int, guestID int) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin the transaction %w", err)
@@ -290,7 +314,12 @@ func (s *Store) GenerateTicket(guestID int) error {
 		}
 	}()
 
-	guest, err := s.getGuestByID(tx, guestID)
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	guest, err := s.getGuestByID(tx, eventID, guestID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch guest: %w", err)
 	}
@@ -299,7 +328,7 @@ func (s *Store) GenerateTicket(guestID int) error {
 		return fmt.Errorf("ticket already generated for this guest")
 	}
 
-	qrCodes, pdfData, err := s.generateTicketsForGuest(tx, guest)
+	qrCodes, pdfData, err := s.generateTicketsForGuest(tx, event, guest)
 	if err != nil {
 		return err
 	}
@@ -378,160 +407,194 @@ func (s *Store) GenerateTicket(guestID int) error {
 	return nil
 }
 
-func (s *Store) generateTicketsForGuest(tx *sql.Tx, guest *types.Guest) ([][]byte, []byte, error) {
-	names := []string{guest.FullName}
-	for i := 1; i <= guest.Additionals; i++ {
-		names = append(names, fmt.Sprintf("Acompañante de %s", guest.FullName))
+// One page per person: the guest, their named companions and an anonymous
+// page for every additional still without a name
+type ticketHolder struct {
+	name        string
+	companionID *int
+	host        bool
+}
+
+func (s *Store) getTicketHolders(tx *sql.Tx, guest *types.Guest) ([]ticketHolder, error) {
+	holders := []ticketHolder{{name: guest.FullName, host: true}}
+
+	rows, err := tx.Query(`SELECT id, full_name FROM companions WHERE guest_id = $1 ORDER BY id`, guest.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companions: %w", err)
 	}
+	defer rows.Close()
 
-	weddingDate := os.Getenv("WEDDING_DATE")
-	weddingPlace := os.Getenv("WEDDING_PLACE")
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan companion: %w", err)
+		}
+		holders = append(holders, ticketHolder{name: name, companionID: &id})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		UnitStr: "mm",
-		Size:    gofpdf.SizeType{Wd: 200, Ht: 80},
-	})
+	for len(holders) <= guest.Additionals {
+		holders = append(holders, ticketHolder{name: fmt.Sprintf("Acompañante de %s", guest.FullName)})
+	}
+
+	return holders, nil
+}
+
+func (s *Store) generateTicketsForGuest(tx *sql.Tx, event *types.Event, guest *types.Guest) ([][]byte, []byte, error) {
+	holders, err := s.getTicketHolders(tx, guest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := getTicketTemplate(tx, event.ID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	bgBytes, err := os.ReadFile("assets/Pase3.png")
+	var table string
+	err = tx.QueryRow(`
+		SELECT COALESCE(t.name, '') FROM guests g LEFT JOIN tables t ON t.id = g.table_id WHERE g.id = $1
+	`, guest.ID).Scan(&table)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read background image: %w", err)
+		return nil, nil, fmt.Errorf("failed to fetch guest table: %w", err)
 	}
-	bgAlias := "bg"
-	imgOpts := gofpdf.ImageOptions{
-		ImageType: "PNG",
-		ReadDpi:   false,
+
+	// Generated again from scratch everyone gets a ticket, revoked or not
+	if _, err := tx.Exec(`UPDATE tickets SET withheld = FALSE WHERE guest_id = $1 AND withheld`, guest.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to release withheld tickets: %w", err)
 	}
-	pdf.RegisterImageOptionsReader(bgAlias, imgOpts, bytes.NewReader(bgBytes))
 
 	var qrCodes [][]byte
+	pages := make([]ticketPage, 0, len(holders))
 
-	for idx, name := range names {
-		code := generateUniqueCode()
-		// qrContent := fmt.Sprintf("INVITADO: %s\nFECHA: %s", name, time.Now().Format("2006-01-02 15:04:05"))
+	for _, holder := range holders {
+		code, err := newTicketCode(event.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ticket code: %w", err)
+		}
 
 		qrBytes, err := generateQRCode(code)
 		if err != nil {
 			return nil, nil, fmt.Errorf("QR generation failed: %w", err)
 		}
 
-		if err := s.insertTicketIntoDB(tx, code, "named", &guest.ID); err != nil {
+		if err := s.insertTicketIntoDB(tx, event.ID, code, "named", &guest.ID, holder.companionID, holder.host); err != nil {
 			return nil, nil, fmt.Errorf("db insert failed: %w", err)
 		}
 
-		imgOpts := gofpdf.ImageOptions{
-			ImageType: "PNG",
-			ReadDpi:   false,
-		}
-		imageAlias := fmt.Sprintf("qr%d", idx)
-		pdf.RegisterImageOptionsReader(imageAlias, imgOpts, bytes.NewReader(qrBytes))
-
-		pdf.AddPage()
-
-		rightWidth := 58.0
-		leftWidth := 202.0 - rightWidth
-
-		pdf.ImageOptions(bgAlias, 0, 0, 200, 80, false, imgOpts, 0, "")
-
-		pdf.SetTextColor(255, 255, 255)
-		pdf.SetFont("Arial", "B", 12)
-
-		labelX := 35.0
-
-		startY := 32.0
-		lineSpacing := 7.0
-
-		pdf.SetXY(labelX, startY)
-		pdf.CellFormat(0, 6, toLatin1(fmt.Sprintf("Invitado: %s", name)), "", 0, "L", false, 0, "")
-
-		pdf.SetXY(labelX, startY+lineSpacing)
-		pdf.CellFormat(0, 6, fmt.Sprintf("Fecha: %s", weddingDate), "", 0, "L", false, 0, "")
-
-		pdf.SetXY(labelX, startY+lineSpacing*2)
-		pdf.CellFormat(0, 6, fmt.Sprintf("Lugar: %s", weddingPlace), "", 0, "L", false, 0, "")
-
-		qrSize := 40.0
-		ticketHeight := 82.0
-
-		qrX := leftWidth + (rightWidth-qrSize)/2
-		qrY := (ticketHeight - qrSize) / 2
-		pdf.ImageOptions(imageAlias, qrX, qrY, qrSize, 0, false, imgOpts, 0, "")
-
+		pages = append(pages, ticketPage{name: holder.name, table: table, qr: qrBytes})
 		qrCodes = append(qrCodes, qrBytes)
 	}
 
-	var buf bytes.Buffer
-	if err := pdf.Output(&buf); err != nil {
-		return nil, nil, fmt.Errorf("PDF output failed: %w", err)
+	pdfData, err := renderTickets(tmpl, event, pages)
+	if err != nil {
+		return nil, nil, err
 	}
-	return qrCodes, buf.Bytes(), nil
+
+	return qrCodes, pdfData, nil
+}
+
+// A ticket let through by a scan
+type scannedTicket struct {
+	ID          int
+	GuestID     sql.NullInt64
+	GeneralID   sql.NullInt64
+	CompanionID sql.NullInt64
+	ScannedAt   time.Time
 }
 
-// Scan QR
-func (s *Store) ScanQR(code string) (types.QRScanResult, error) {
-	var ticket struct {
-		ID        int
-		GuestID   sql.NullInt64
-		GeneralID sql.NullInt64
-		Status    string
+// Scan QR. Checking in is one conditional update, so when two scanners read
+// the same code at once only one of them lets the person in. On events with
+// re-entry a used ticket lets its holder out or back in instead. Every attempt
+// is logged with who scanned it and where
+func (s *Store) ScanQR(eventID int, code string, scan types.ScanContext) (types.QRScanResult, error) {
+	var ticket scannedTicket
+
+	// Forged codes are refused before looking them up
+	if err := checkTicketCode(eventID, code); err != nil {
+		s.recordScan(eventID, nil, code, types.ScanForged, scan)
+		return nil, err
 	}
 
+	// The admitted scan is logged in the same statement as the check-in
 	err := s.db.QueryRow(`
-		SELECT id, guest_id, general_id, status FROM tickets WHERE code = $1`, code).Scan(&ticket.ID, &ticket.GuestID, &ticket.GeneralID, &ticket.Status)
+		WITH checked AS (
+			UPDATE tickets SET status = 'used', used_at = NOW(), present = TRUE
+			WHERE code = $1 AND event_id = $2 AND status = 'active'
+			  AND (guest_id IS NOT NULL OR general_id IS NOT NULL)
+			RETURNING id, guest_id, general_id, companion_id, used_at
+		), logged AS (
+			INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, device_id, gate, scanned_at)
+			SELECT $2, id, $1, 'admitted', $3, NULLIF($4, ''), NULLIF($5, ''), used_at FROM checked
+		)
+		SELECT id, guest_id, general_id, companion_id, used_at FROM checked
+	`, code, eventID, scan.UserID, scan.DeviceID, scan.Gate).Scan(&ticket.ID, &ticket.GuestID, &ticket.GeneralID, &ticket.CompanionID, &ticket.ScannedAt)
 
+	// Not active: on events with re-entry a used ticket lets its holder out or back in
+	status, outcome := types.TicketActive, types.ScanAdmitted
+	if err == sql.ErrNoRows {
+		status = types.TicketUsed
+		outcome, err = s.toggleReEntry(eventID, code, scan, &ticket)
+	}
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("invalid code")
+		ticketID, refusal := s.scanRefusal(eventID, code)
+		if outcome := refusalOutcome(refusal); outcome != "" {
+			s.recordScan(eventID, ticketID, code, outcome, scan)
+		}
+		return nil, refusal
 	} else if err != nil {
-		return nil, fmt.Errorf("error consulting ticket: %w", err)
+		return nil, fmt.Errorf("error updating ticket: %w", err)
 	}
 
-	if ticket.Status == "used" {
-		return nil, fmt.Errorf("this ticket was already used")
+	live := types.CheckInEvent{EventID: eventID, TicketID: ticket.ID, Result: outcome, ScannedAt: ticket.ScannedAt}
+	if scan.DeviceID != "" {
+		live.DeviceID = &scan.DeviceID
 	}
-
-	_, err = s.db.Exec(`UPDATE tickets SET status = 'used' WHERE id = $1`, ticket.ID)
-	if err != nil {
-		return nil, fmt.Errorf("error updating ticket: %w", err)
+	if scan.Gate != "" {
+		live.Gate = &scan.Gate
 	}
 
-	status := ticket.Status
-
 	if ticket.GuestID.Valid {
 
-		var guest struct {
-			FullName    string
-			Additionals int
-			TableID     *int
-		}
-
-		err = s.db.QueryRow(`
-		SELECT full_name, additionals, table_id FROM guests WHERE id = $1
-	`, ticket.GuestID).Scan(&guest.FullName, &guest.Additionals, &guest.TableID)
+		party, err := s.GetParty(eventID, int(ticket.GuestID.Int64))
 		if err != nil {
-			return nil, fmt.Errorf("error consulting the guest: %w", err)
+			return nil, fmt.Errorf("error consulting the party: %w", err)
 		}
 
-		name := guest.FullName
-		if guest.Additionals > 0 {
-			name += " y compañía"
+		name := party.GuestName
+		var hostName *string
+
+		// Named companions show up as themselves, with the guest as host
+		for _, m := range party.Members {
+			if m.TicketID == ticket.ID {
+				name = m.Name
+				if !m.Host {
+					hostName = &party.GuestName
+				}
+				break
+			}
 		}
 
-		var tableName *string
-		if guest.TableID != nil {
+		live.Type, live.Name, live.TableID, live.TableName = "named", &name, party.TableID, party.TableName
+		checkins.Publish(live)
 
-			var tName string
-			err = s.db.QueryRow(`SELECT name FROM tables WHERE id = $1`, *guest.TableID).Scan(&tName)
-			if err != nil && err != sql.ErrNoRows {
-				return nil, fmt.Errorf("error consulting the table: %w", err)
-			}
-			tableName = &tName
+		result := &types.ReturnScannedData{
+			GuestName:    name,
+			HostName:     hostName,
+			TableName:    party.TableName,
+			TicketStatus: status,
+			Result:       outcome,
+		}
 
+		// Parties of one have nobody else to wait for
+		if party.Expected > 1 {
+			result.Party = party
 		}
 
-		return &types.ReturnScannedData{
-			GuestName:    name,
-			TableName:    tableName,
-			TicketStatus: status,
-		}, nil
+		return result, nil
 
 	} else if ticket.GeneralID.Valid {
 
@@ -561,20 +624,95 @@ func (s *Store) ScanQR(code string) (types.QRScanResult, error) {
 
 		}
 
+		live.Type, live.Folio, live.TableID, live.TableName = "general", folio, general.TableID, tableName
+		checkins.Publish(live)
+
 		return &types.ReturnGeneralScannedData{
 			GeneralFolio: folio,
 			TableName:    tableName,
 			TicketStatus: status,
+			Result:       outcome,
 		}, nil
-	} else {
-		return nil, fmt.Errorf("the code does not match with any ticket")
 	}
+
+	// Both updates skip tickets whose holder was deleted
+	return nil, ErrInvalidCode
+}
+
+// Lets the holder of a used ticket out, or back in, when the event allows
+// re-entry. Like the check-in it is one conditional update logged in the same
+// statement. sql.ErrNoRows when the ticket is not used or re-entry is off
+func (s *Store) toggleReEntry(eventID int, code string, scan types.ScanContext, ticket *scannedTicket) (string, error) {
+	var present bool
+
+	err := s.db.QueryRow(`
+		WITH toggled AS (
+			UPDATE tickets t SET present = NOT t.present
+			FROM events e
+			WHERE e.id = t.event_id AND e.re_entry
+			  AND t.code = $1 AND t.event_id = $2 AND t.status = 'used'
+			  AND (t.guest_id IS NOT NULL OR t.general_id IS NOT NULL)
+			RETURNING t.id, t.guest_id, t.general_id, t.companion_id, t.present, NOW() AS scanned_at
+		), logged AS (
+			INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, device_id, gate, scanned_at)
+			SELECT $2, id, $1, CASE WHEN present THEN 'reentered' ELSE 'exited' END,
+			       $3, NULLIF($4, ''), NULLIF($5, ''), scanned_at
+			FROM toggled
+		)
+		SELECT id, guest_id, general_id, companion_id, present, scanned_at FROM toggled
+	`, code, eventID, scan.UserID, scan.DeviceID, scan.Gate).Scan(&ticket.ID, &ticket.GuestID, &ticket.GeneralID, &ticket.CompanionID, &present, &ticket.ScannedAt)
+	if err != nil {
+		return "", err
+	}
+
+	if present {
+		return types.ScanReentered, nil
+	}
+	return types.ScanExited, nil
+}
+
+// Why a code could not be checked in: unknown, already used or revoked. The
+// ticket id is nil for unknown codes. A ticket whose guest or general was
+// deleted after it was used belongs to nobody, so it is invalid
+func (s *Store) scanRefusal(eventID int, code string) (*int, error) {
+	var ticketID int
+	var status string
+	var orphaned bool
+	var usedAt, revokedAt sql.NullTime
+	var reason sql.NullString
+
+	err := s.db.QueryRow(`
+		SELECT id, status, guest_id IS NULL AND general_id IS NULL, used_at, revoked_at, revoke_reason
+		FROM tickets WHERE code = $1 AND event_id = $2
+	`, code, eventID).Scan(&ticketID, &status, &orphaned, &usedAt, &revokedAt, &reason)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCode
+	} else if err != nil {
+		return nil, fmt.Errorf("error consulting ticket: %w", err)
+	}
+
+	if orphaned && status != types.TicketRevoked {
+		return &ticketID, ErrInvalidCode
+	}
+
+	switch status {
+	case types.TicketUsed:
+		used := &types.UsedTicket{}
+		if usedAt.Valid {
+			used.UsedAt = &usedAt.Time
+		}
+		return &ticketID, used
+	case types.TicketRevoked:
+		return &ticketID, &types.RevokedTicket{Reason: reason.String, RevokedAt: revokedAt.Time}
+	}
+
+	return &ticketID, fmt.Errorf("the ticket could not be checked in, try again")
 }
 
 // --- GENERAL TICKETS
 
 // Generate the actual ticket
-func (s *Store) GenerateGeneralTicket(count int) (err error) {
+func (s *Store) GenerateGeneralTicket(eventID int, count int) (err error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -591,9 +729,19 @@ func (s *Store) GenerateGeneralTicket(count int) (err error) {
 		}
 	}()
 
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	tmpl, err := getTicketTemplate(tx, eventID)
+	if err != nil {
+		return err
+	}
+
 	// Get the next folio
 	var lastFolio int
-	err = tx.QueryRow(`SELECT COALESCE(MAX(folio), 0) FROM generals`).Scan(&lastFolio)
+	err = tx.QueryRow(`SELECT COALESCE(MAX(folio), 0) FROM generals WHERE event_id = $1`, eventID).Scan(&lastFolio)
 	if err != nil {
 		return fmt.Errorf("failed to fetch last general folio: %w", err)
 	}
@@ -604,79 +752,31 @@ func (s *Store) GenerateGeneralTicket(count int) (err error) {
 
 		var generalID int
 		err = tx.QueryRow(`
-    INSERT INTO generals (table_id, created_at, folio)
-    VALUES (NULL, NOW(), $1) RETURNING id
-`, nextFolio).Scan(&generalID)
+    INSERT INTO generals (event_id, table_id, created_at, folio)
+    VALUES ($1, NULL, NOW(), $2) RETURNING id
+`, eventID, nextFolio).Scan(&generalID)
 		if err != nil {
 			return fmt.Errorf("failed to insert general: %w", err)
 		}
 
 		// Generate QR code and PDF
-		code := generateUniqueCode()
-		qrBytes, err := generateQRCode(code)
+		code, err := newTicketCode(eventID)
 		if err != nil {
-			return fmt.Errorf("failed to generate QR code: %w", err)
+			return fmt.Errorf("failed to generate ticket code: %w", err)
 		}
 
-		weddingDate := os.Getenv("WEDDING_DATE")
-
-		weddingPlace := os.Getenv("WEDDING_PLACE")
-
-		// Build PDF
-		pdf := gofpdf.NewCustom(&gofpdf.InitType{
-			UnitStr: "mm",
-			Size:    gofpdf.SizeType{Wd: 200, Ht: 80},
-		})
-
-		bgBytes, err := os.ReadFile("assets/Pase3.png")
+		qrBytes, err := generateQRCode(code)
 		if err != nil {
-			return fmt.Errorf("failed to read background image: %w", err)
+			return fmt.Errorf("failed to generate QR code: %w", err)
 		}
 
-		bgAlias := "bg"
-		imgOpts := gofpdf.ImageOptions{ImageType: "PNG"}
-		pdf.RegisterImageOptionsReader(bgAlias, imgOpts, bytes.NewReader(bgBytes))
-
-		imageAlias := "qr0"
-		pdf.RegisterImageOptionsReader(imageAlias, imgOpts, bytes.NewReader(qrBytes))
-
-		pdf.AddPage()
-		pdf.ImageOptions(bgAlias, 0, 0, 200, 80, false, imgOpts, 0, "")
-
-		pdf.SetTextColor(255, 255, 255)
-		pdf.SetFont("Arial", "B", 12)
-
-		labelX := 35.0
-		startY := 32.0
-		lineSpacing := 7.0
-
-		pdf.SetXY(labelX, startY)
-
-		pdf.CellFormat(0, 6, toLatin1(fmt.Sprintf("Invitado: General #%d", nextFolio)), "", 0, "L", false, 0, "")
-
-		pdf.SetXY(labelX, startY+lineSpacing)
-		pdf.CellFormat(0, 6, fmt.Sprintf("Fecha: %s", weddingDate), "", 0, "L", false, 0, "")
-
-		pdf.SetXY(labelX, startY+lineSpacing*2)
-
-		pdf.CellFormat(0, 6, fmt.Sprintf("Lugar: %s", weddingPlace), "", 0, "L", false, 0, "")
-
-		qrSize := 40.0
-		rightWidth := 58.0
-		leftWidth := 202.0 - rightWidth
-		qrX := leftWidth + (rightWidth-qrSize)/2
-		qrY := (82.0 - qrSize) / 2
-
-		pdf.ImageOptions(imageAlias, qrX, qrY, qrSize, 0, false, imgOpts, 0, "")
-
-		var pdfBuf bytes.Buffer
-		if err := pdf.Output(&pdfBuf); err != nil {
-			return fmt.Errorf("failed to write PDF: %w", err)
+		pdfData, err := renderTickets(tmpl, event, []ticketPage{{name: fmt.Sprintf("General #%d", nextFolio), qr: qrBytes}})
+		if err != nil {
+			return err
 		}
-		pdfData := pdfBuf.Bytes()
 
 		// Insert ticket linked to general
-		if err := s.insertGeneralTicketIntoDB(tx, code, "general", &generalID); err != nil {
+		if err := s.insertGeneralTicketIntoDB(tx, eventID, code, "general", &generalID); err != nil {
 			return fmt.Errorf("failed to insert ticket: %w", err)
 		}
 
@@ -730,42 +830,42 @@ func (s *Store) GenerateGeneralTicket(count int) (err error) {
 }
 
 // --- INFO ABOUT THE TICKETS (named and generals)
-func (s *Store) GetTicketsCount() (types.AllTickets, error) {
+func (s *Store) GetTicketsCount(eventID int) (types.AllTickets, error) {
 	var result types.AllTickets
 
 	err := s.db.QueryRow(`
 		SELECT
 			-- Count general tickets from generals table
-			(SELECT COUNT(*) FROM generals) AS general_count,
+			(SELECT COUNT(*) FROM generals WHERE event_id = $1) AS general_count,
 
 			-- Named tickets = guests + their additionals
 
-			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests) AS named_count,
+			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1) AS named_count,
 
 			-- Total tickets = general_count + named_count
 			(
-				(SELECT COUNT(*) FROM generals) +
-				(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests)
+				(SELECT COUNT(*) FROM generals WHERE event_id = $1) +
+				(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1)
 			) AS total_count,
 
 			-- Guests total = guests + additionals
 
-			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests) AS total_guest_count,
+			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1) AS total_guest_count,
 
-			-- Guests confirmed count (guests + additionals)
-			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE confirm_attendance = true) AS confirmed_guest_count,
-
-			-- Guests not confirmed count (guests + additionals)
-			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE confirm_attendance = false) AS not_confirmed_guest_count
-	`).Scan(
+			-- Guests per RSVP status (guests + additionals)
+			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1 AND rsvp_status = 'accepted') AS accepted_guest_count,
+			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1 AND rsvp_status = 'declined') AS declined_guest_count,
+			(SELECT COALESCE(SUM(additionals + 1), 0) FROM guests WHERE event_id = $1 AND rsvp_status = 'pending') AS pending_guest_count
+	`, eventID).Scan(
 		&result.GeneralTickets,
 		&result.NamedTickets,
 
 		&result.TotalTickets,
 		&result.GuestTotal,
 
-		&result.GuestConfirmed,
-		&result.GuestNotConfirmed,
+		&result.GuestAccepted,
+		&result.GuestDeclined,
+		&result.GuestPending,
 	)
 	if err != nil {
 		return types.AllTickets{}, fmt.Errorf("failed to fetch ticket and guest counts: %w", err)
@@ -774,13 +874,14 @@ func (s *Store) GetTicketsCount() (types.AllTickets, error) {
 	return result, nil
 }
 
-func (s *Store) GetNamedTicketsInfo() ([]types.NamedTicket, error) {
+func (s *Store) GetNamedTicketsInfo(eventID int) ([]types.NamedTicket, error) {
 	rows, err := s.db.Query(`
-		SELECT id, full_name, additionals, confirm_attendance, table_id,
+		SELECT id, full_name, additionals, rsvp_status, table_id,
 		       ticket_generated, ticket_sent, qr_code_urls, pdf_files, created_at
 		FROM guests
+		WHERE event_id = $1
 		ORDER BY full_name ASC
-	`)
+	`, eventID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch named tickets: %w", err)
 	}
@@ -795,7 +896,7 @@ func (s *Store) GetNamedTicketsInfo() ([]types.NamedTicket, error) {
 			&ticket.ID,
 			&ticket.FullName,
 			&ticket.Additionals,
-			&ticket.ConfirmAttendance,
+			&ticket.RSVPStatus,
 			&ticket.TableId,
 			&ticket.TicketGenerated,
 			&ticket.TicketSent,
@@ -816,13 +917,13 @@ func (s *Store) GetNamedTicketsInfo() ([]types.NamedTicket, error) {
 	return tickets, nil
 }
 
-func (s *Store) GetGeneralTicketsInfo(params types.PaginationParams) (*types.PaginatedResult[types.GeneralTicket], error) {
-	var whereClause string
-	var args []interface{}
+func (s *Store) GetGeneralTicketsInfo(eventID int, params types.PaginationParams) (*types.PaginatedResult[types.GeneralTicket], error) {
+	whereClause := " WHERE event_id = $1"
+	args := []interface{}{eventID}
 	orderBy := "folio"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		whereClause = " WHERE CAST(folio AS TEXT) ILIKE $1"
+		whereClause += " AND CAST(folio AS TEXT) ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
@@ -850,14 +951,14 @@ func (s *Store) GetGeneralTicketsInfo(params types.PaginationParams) (*types.Pag
 	}, params, orderBy, args...)
 }
 
-func (s *Store) GetUnassignedGeneralTickets(params types.PaginationParams) (*types.PaginatedResult[types.GeneralTicket], error) {
+func (s *Store) GetUnassignedGeneralTickets(eventID int, params types.PaginationParams) (*types.PaginatedResult[types.GeneralTicket], error) {
 	var andWhere string
-	var args []interface{}
+	args := []interface{}{eventID}
 	orderBy := "folio"
-	whereClause := " WHERE table_id IS NULL"
+	whereClause := " WHERE table_id IS NULL AND event_id = $1"
 
 	if params.Search != nil && strings.TrimSpace(*params.Search) != "" {
-		andWhere = " AND CAST(folio AS TEXT) ILIKE $1"
+		andWhere = " AND CAST(folio AS TEXT) ILIKE $2"
 		args = append(args, "%"+strings.TrimSpace(*params.Search)+"%")
 	}
 
@@ -890,40 +991,28 @@ func generateQRCode(content string) ([]byte, error) {
 	return qrcode.Encode(content, qrcode.Medium, 256)
 }
 
-func generateUniqueCode() string {
-	return strconv.FormatInt(time.Now().UnixNano(), 10) + strconv.Itoa(rand.Intn(1000))
-}
-
-func (s *Store) insertTicketIntoDB(tx *sql.Tx, code string, ticketType string, guestID *int) error {
-	if guestID == nil {
-		_, err := tx.Exec(`
-			INSERT INTO tickets (code, type, guest_id, created_at)
-			VALUES ($1, $2, NULL, $3)
-		`, code, ticketType, time.Now())
-		return err
-	}
-
+func (s *Store) insertTicketIntoDB(tx *sql.Tx, eventID int, code string, ticketType string, guestID *int, companionID *int, host bool) error {
 	_, err := tx.Exec(`
-        INSERT INTO tickets (code, type, guest_id, created_at)
-        VALUES ($1, $2, $3, $4)
-    `, code, ticketType, *guestID, time.Now())
+        INSERT INTO tickets (event_id, code, type, guest_id, companion_id, host, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, eventID, code, ticketType, guestID, companionID, host, time.Now())
 
 	return err
 }
 
-func (s *Store) insertGeneralTicketIntoDB(tx *sql.Tx, code string, ticketType string, generalID *int) error {
+func (s *Store) insertGeneralTicketIntoDB(tx *sql.Tx, eventID int, code string, ticketType string, generalID *int) error {
 	if generalID == nil {
 		_, err := tx.Exec(`
-			INSERT INTO tickets (code, type, general_id, created_at)
-			VALUES ($1, $2, NULL, $3)
-		`, code, ticketType, time.Now())
+			INSERT INTO tickets (event_id, code, type, general_id, created_at)
+			VALUES ($1, $2, $3, NULL, $4)
+		`, eventID, code, ticketType, time.Now())
 		return err
 	}
 
 	_, err := tx.Exec(`
-        INSERT INTO tickets (code, type, general_id, created_at)
-        VALUES ($1, $2, $3, $4)
-    `, code, ticketType, *generalID, time.Now())
+        INSERT INTO tickets (event_id, code, type, general_id, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `, eventID, code, ticketType, *generalID, time.Now())
 
 	return err
 }
@@ -1030,15 +1119,24 @@ func normalizeName(name string) string {
 	return name
 }
 
-// Convert UTF strings to Latin format
-func toLatin1(input string) string {
-	encoder := charmap.ISO8859_1.NewEncoder()
-	output, err := encoder.String(input)
+// Format the event date in the event's own timezone
+func formatEventDate(event *types.Event) string {
+	loc, err := time.LoadLocation(event.Timezone)
 	if err != nil {
-		return input
+		loc = time.UTC
+	}
+
+	return event.EventDate.In(loc).Format("02/01/2006 15:04")
+}
+
+// Parse a "#RRGGBB" color, falling back to white
+func hexToRGB(hex string) (int, int, int) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return 255, 255, 255
 	}
 
-	return output
+	return int(value >> 16 & 0xFF), int(value >> 8 & 0xFF), int(value & 0xFF)
 }
 
 func downloadPDF(url string) ([]byte, error) {
@@ -0,0 +1,378 @@
+package tickets
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/checkins"
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/lib/pq"
+)
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// What a scanner shows for a ticket, the same name, host and table an online
+// scan returns
+const ticketDisplayQuery = `
+	SELECT t.id, t.code, t.type, t.status, t.used_at,
+	       CASE
+	           WHEN c.id IS NOT NULL THEN c.full_name
+	           WHEN t.host THEN g.full_name
+	           ELSE 'Acompañante de ' || g.full_name
+	       END,
+	       CASE WHEN NOT t.host THEN g.full_name END,
+	       g.id, ge.folio, tb.id, tb.name
+	FROM tickets t
+	LEFT JOIN guests g ON g.id = t.guest_id
+	LEFT JOIN companions c ON c.id = t.companion_id
+	LEFT JOIN generals ge ON ge.id = t.general_id
+	LEFT JOIN tables tb ON tb.id = COALESCE(g.table_id, ge.table_id)
+`
+
+func (s *Store) getDisplayTickets(where string, args ...any) ([]types.ManifestTicket, error) {
+	rows, err := s.db.Query(ticketDisplayQuery+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tickets: %w", err)
+	}
+	defer rows.Close()
+
+	tickets := make([]types.ManifestTicket, 0)
+	for rows.Next() {
+		var t types.ManifestTicket
+		var code string
+		if err := rows.Scan(&t.TicketID, &code, &t.Type, &t.Status, &t.UsedAt, &t.Name, &t.HostName, &t.GuestID, &t.Folio, &t.TableID, &t.Table); err != nil {
+			return nil, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		t.Hash = hashCode(code)
+		tickets = append(tickets, t)
+	}
+
+	return tickets, rows.Err()
+}
+
+// Active and used tickets, revoked codes are left out
+func (s *Store) GetScanManifest(eventID int) (*types.ScanManifest, error) {
+	tickets, err := s.getDisplayTickets(`WHERE t.event_id = $1 AND t.status <> 'revoked' ORDER BY t.id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ScanManifest{
+		EventID:       eventID,
+		GeneratedAt:   time.Now().UTC(),
+		HashAlgorithm: "sha256",
+		Tickets:       tickets,
+	}, nil
+}
+
+// A ticket as the sync sees it. device is the one that admitted it, nil when
+// unknown
+type syncTicket struct {
+	id     int
+	status string
+	usedAt *time.Time
+	device *string
+}
+
+// Decides a scan against the ticket as it stands and updates it. The earliest
+// scan wins and equal times go to the lower device id, so the outcome does not
+// depend on which device uploads first. Returns the admission the scan
+// displaced, if any
+func resolveScan(t *syncTicket, at time.Time, device string) (string, *syncTicket) {
+	if t == nil {
+		return types.ScanInvalid, nil
+	}
+
+	switch t.status {
+	case types.TicketRevoked:
+		return types.ScanRevoked, nil
+	case types.TicketActive:
+		t.status, t.usedAt, t.device = types.TicketUsed, &at, &device
+		return types.ScanAdmitted, nil
+	}
+
+	// Tickets used before the time was recorded keep their admission
+	if t.usedAt == nil {
+		return types.ScanDuplicate, nil
+	}
+
+	admittedBy := ""
+	if t.device != nil {
+		admittedBy = *t.device
+	}
+	if at.Before(*t.usedAt) || (at.Equal(*t.usedAt) && device < admittedBy) {
+		previous := *t
+		t.usedAt, t.device = &at, &device
+		return types.ScanAdmitted, &previous
+	}
+
+	return types.ScanDuplicate, nil
+}
+
+// Oldest first, so within a batch the first scan of a code is the admission.
+// Times are cut to what Postgres stores so uploads can be matched again
+func sortOfflineScans(scans []types.OfflineScan) []types.OfflineScan {
+	sorted := make([]types.OfflineScan, len(scans))
+	for i, scan := range scans {
+		sorted[i] = types.OfflineScan{Code: scan.Code, ScannedAt: scan.ScannedAt.UTC().Truncate(time.Microsecond)}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].ScannedAt.Equal(sorted[j].ScannedAt) {
+			return sorted[i].ScannedAt.Before(sorted[j].ScannedAt)
+		}
+		return sorted[i].Code < sorted[j].Code
+	})
+
+	return sorted
+}
+
+func offlineScanKey(code string, at time.Time) string {
+	return fmt.Sprintf("%s|%d", code, at.UnixMicro())
+}
+
+// Applies check-ins a scanner made while disconnected. Every scan is logged
+// with the device time; the ones that did not admit anybody come back as
+// conflicts
+func (s *Store) SyncScans(eventID int, userID *int, payload types.SyncScansPayload) (*types.SyncScansResult, error) {
+	scans := sortOfflineScans(payload.Scans)
+
+	codes := make([]string, 0, len(scans))
+	for _, scan := range scans {
+		codes = append(codes, scan.Code)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locked in id order so two devices syncing at once cannot deadlock
+	rows, err := tx.Query(`
+		SELECT id, code, status, used_at FROM tickets
+		WHERE event_id = $1 AND code = ANY($2)
+		ORDER BY id
+		FOR UPDATE
+	`, eventID, pq.Array(codes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock tickets: %w", err)
+	}
+
+	tickets := make(map[string]*syncTicket)
+	var used []int64
+	for rows.Next() {
+		var code string
+		t := &syncTicket{}
+		if err := rows.Scan(&t.id, &code, &t.status, &t.usedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		tickets[code] = t
+		if t.status == types.TicketUsed {
+			used = append(used, int64(t.id))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadAdmittingDevices(tx, used, tickets); err != nil {
+		return nil, err
+	}
+
+	// Scans this device already uploaded
+	seen := make(map[string]bool)
+	rows, err = tx.Query(`
+		SELECT code, scanned_at FROM ticket_scans
+		WHERE event_id = $1 AND device_id = $2 AND offline AND code = ANY($3)
+	`, eventID, payload.DeviceID, pq.Array(codes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch synced scans: %w", err)
+	}
+	for rows.Next() {
+		var code string
+		var at time.Time
+		if err := rows.Scan(&code, &at); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan synced scan: %w", err)
+		}
+		seen[offlineScanKey(code, at)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &types.SyncScansResult{Conflicts: make([]types.ScanConflict, 0)}
+	arrivals := make(map[int]time.Time)
+
+	for _, scan := range scans {
+		key := offlineScanKey(scan.Code, scan.ScannedAt)
+		if seen[key] {
+			result.Skipped++
+			continue
+		}
+		seen[key] = true
+
+		outcome := types.ScanForged
+		var t, displaced *syncTicket
+		if checkTicketCode(eventID, scan.Code) == nil {
+			t = tickets[scan.Code]
+			outcome, displaced = resolveScan(t, scan.ScannedAt, payload.DeviceID)
+		}
+
+		var ticketID *int
+		if t != nil {
+			id := t.id
+			ticketID = &id
+		}
+
+		if displaced != nil {
+			_, err := tx.Exec(`
+				UPDATE ticket_scans SET result = 'duplicate' WHERE ticket_id = $1 AND result = 'admitted' AND scanned_at = $2
+			`, t.id, displaced.usedAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update the earlier admission: %w", err)
+			}
+
+			result.Conflicts = append(result.Conflicts, types.ScanConflict{
+				Code:           scan.Code,
+				TicketID:       ticketID,
+				Result:         types.ScanDuplicate,
+				DeviceID:       displaced.device,
+				ScannedAt:      displaced.usedAt,
+				AdmittedAt:     t.usedAt,
+				AdmittedDevice: t.device,
+				Displaced:      true,
+			})
+		}
+
+		if outcome == types.ScanAdmitted {
+			_, err := tx.Exec(`UPDATE tickets SET status = 'used', used_at = $1, present = TRUE WHERE id = $2`, scan.ScannedAt, t.id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check in ticket: %w", err)
+			}
+			result.Admitted++
+
+			// A displaced admission was already counted on the dashboards
+			if displaced == nil {
+				arrivals[t.id] = scan.ScannedAt
+			}
+		} else {
+			at := scan.ScannedAt
+			conflict := types.ScanConflict{
+				Code:      scan.Code,
+				TicketID:  ticketID,
+				Result:    outcome,
+				DeviceID:  &payload.DeviceID,
+				ScannedAt: &at,
+			}
+			if t != nil && outcome == types.ScanDuplicate {
+				conflict.AdmittedAt = t.usedAt
+				conflict.AdmittedDevice = t.device
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, device_id, gate, scanned_at, offline, synced_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, TRUE, NOW())
+		`, eventID, ticketID, scan.Code, outcome, userID, payload.DeviceID, payload.Gate, scan.ScannedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record scan: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.publishArrivals(eventID, arrivals, payload)
+
+	return result, nil
+}
+
+func (s *Store) publishArrivals(eventID int, arrivals map[int]time.Time, payload types.SyncScansPayload) {
+	if len(arrivals) == 0 {
+		return
+	}
+
+	ids := make([]int64, 0, len(arrivals))
+	for id := range arrivals {
+		ids = append(ids, int64(id))
+	}
+
+	tickets, err := s.getDisplayTickets(`WHERE t.id = ANY($1) ORDER BY t.used_at, t.id`, pq.Array(ids))
+	if err != nil {
+		log.Printf("failed to publish offline check-ins for event %d: %v", eventID, err)
+		return
+	}
+
+	for _, t := range tickets {
+		live := types.CheckInEvent{
+			EventID:   eventID,
+			TicketID:  t.TicketID,
+			Result:    types.ScanAdmitted,
+			Type:      t.Type,
+			Name:      t.Name,
+			Folio:     t.Folio,
+			TableID:   t.TableID,
+			TableName: t.Table,
+			DeviceID:  &payload.DeviceID,
+			ScannedAt: arrivals[t.TicketID],
+			Offline:   true,
+		}
+		if payload.Gate != "" {
+			live.Gate = &payload.Gate
+		}
+		checkins.Publish(live)
+	}
+}
+
+// Device of the scan that admitted each used ticket. Admissions undone since
+// do not match the ticket's used_at anymore
+func loadAdmittingDevices(tx *sql.Tx, ticketIDs []int64, tickets map[string]*syncTicket) error {
+	if len(ticketIDs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*syncTicket, len(tickets))
+	for _, t := range tickets {
+		byID[t.id] = t
+	}
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT ON (s.ticket_id) s.ticket_id, s.device_id
+		FROM ticket_scans s
+		JOIN tickets t ON t.id = s.ticket_id AND t.used_at = s.scanned_at
+		WHERE s.ticket_id = ANY($1) AND s.result = 'admitted'
+		ORDER BY s.ticket_id, s.id
+	`, pq.Array(ticketIDs))
+	if err != nil {
+		return fmt.Errorf("failed to fetch admissions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var device *string
+		if err := rows.Scan(&id, &device); err != nil {
+			return fmt.Errorf("failed to scan admission: %w", err)
+		}
+		if t, ok := byID[id]; ok {
+			t.device = device
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,74 @@
+package tickets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestResolveScan(t *testing.T) {
+	at := time.Date(2027, 2, 14, 20, 0, 0, 0, time.UTC)
+
+	t.Run("should give the ticket to the earliest scan whatever the upload order", func(t *testing.T) {
+		uploads := [][]string{{"door-a", "door-b"}, {"door-b", "door-a"}}
+		times := map[string]time.Time{"door-a": at.Add(time.Minute), "door-b": at}
+
+		for _, order := range uploads {
+			ticket := &syncTicket{id: 1, status: types.TicketActive}
+			for _, device := range order {
+				resolveScan(ticket, times[device], device)
+			}
+			if *ticket.device != "door-b" || !ticket.usedAt.Equal(at) {
+				t.Errorf("upload order %v: expected door-b at %v, got %s at %v", order, at, *ticket.device, *ticket.usedAt)
+			}
+		}
+	})
+
+	t.Run("should report the admission an older scan displaced", func(t *testing.T) {
+		later := at.Add(time.Minute)
+		online := "entrance"
+		ticket := &syncTicket{id: 1, status: types.TicketUsed, usedAt: &later, device: &online}
+
+		outcome, displaced := resolveScan(ticket, at, "door-a")
+		if outcome != types.ScanAdmitted || displaced == nil || *displaced.device != "entrance" {
+			t.Errorf("expected the online admission to be displaced, got %s %+v", outcome, displaced)
+		}
+
+		outcome, displaced = resolveScan(ticket, later, "door-c")
+		if outcome != types.ScanDuplicate || displaced != nil {
+			t.Errorf("expected a duplicate, got %s", outcome)
+		}
+	})
+
+	t.Run("should break ties on the device id", func(t *testing.T) {
+		for _, order := range [][]string{{"b", "a"}, {"a", "b"}} {
+			ticket := &syncTicket{id: 1, status: types.TicketActive}
+			for _, device := range order {
+				resolveScan(ticket, at, device)
+			}
+			if *ticket.device != "a" {
+				t.Errorf("upload order %v: expected device a, got %s", order, *ticket.device)
+			}
+		}
+	})
+
+	t.Run("should refuse unknown and revoked codes", func(t *testing.T) {
+		if outcome, _ := resolveScan(nil, at, "a"); outcome != types.ScanInvalid {
+			t.Errorf("expected invalid, got %s", outcome)
+		}
+		if outcome, _ := resolveScan(&syncTicket{status: types.TicketRevoked}, at, "a"); outcome != types.ScanRevoked {
+			t.Errorf("expected revoked, got %s", outcome)
+		}
+	})
+
+	t.Run("should sort scans oldest first at microsecond precision", func(t *testing.T) {
+		scans := sortOfflineScans([]types.OfflineScan{
+			{Code: "b", ScannedAt: at.Add(time.Second)},
+			{Code: "a", ScannedAt: at.Add(1500 * time.Nanosecond)},
+		})
+		if scans[0].Code != "a" || scans[0].ScannedAt.Nanosecond() != 1000 {
+			t.Errorf("unexpected order %+v", scans)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package tickets
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+	"github.com/diegob0/rspv_backend/internal/utils"
+	"github.com/jung-kurt/gofpdf"
+)
+
+var ErrInvalidTemplate = errors.New("invalid ticket template")
+
+// Backgrounds are read from disk, so they are limited to the assets folder
+const templateAssetsDir = "assets"
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// The layout tickets had before templates existed: guest, date and venue on
+// the left and the QR on the right of a 200x80mm page
+func defaultTicketTemplate(eventID int) *types.TicketTemplate {
+	return &types.TicketTemplate{
+		EventID: eventID,
+		Width:   200,
+		Height:  80,
+		QR:      types.TicketQR{X: 153, Y: 21, Size: 40},
+		Fields: []types.TicketField{
+			{Text: "Invitado: {name}", X: 35, Y: 32, FontSize: 12, Bold: true},
+			{Text: "Fecha: {date}", X: 35, Y: 39, FontSize: 12, Bold: true},
+			{Text: "Lugar: {venue}", X: 35, Y: 46, FontSize: 12, Bold: true},
+		},
+		Default: true,
+	}
+}
+
+func getTicketTemplate(q querier, eventID int) (*types.TicketTemplate, error) {
+	t := types.TicketTemplate{EventID: eventID}
+	var fields []byte
+
+	err := q.QueryRow(`
+		SELECT width, height, background, qr_x, qr_y, qr_size, fields, updated_at
+		FROM ticket_templates
+		WHERE event_id = $1
+	`, eventID).Scan(&t.Width, &t.Height, &t.Background, &t.QR.X, &t.QR.Y, &t.QR.Size, &fields, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return defaultTicketTemplate(eventID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ticket template: %w", err)
+	}
+
+	if err := json.Unmarshal(fields, &t.Fields); err != nil {
+		return nil, fmt.Errorf("failed to read ticket template fields: %w", err)
+	}
+
+	return &t, nil
+}
+
+func (s *Store) GetTicketTemplate(eventID int) (*types.TicketTemplate, error) {
+	return getTicketTemplate(s.db, eventID)
+}
+
+func (s *Store) SaveTicketTemplate(eventID int, payload types.SaveTicketTemplatePayload) (*types.TicketTemplate, error) {
+	tmpl := templateFromPayload(eventID, payload)
+	if err := checkTicketTemplate(tmpl); err != nil {
+		return nil, err
+	}
+
+	fields, err := json.Marshal(tmpl.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ticket template fields: %w", err)
+	}
+
+	err = s.db.QueryRow(`
+		INSERT INTO ticket_templates (event_id, width, height, background, qr_x, qr_y, qr_size, fields)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (event_id) DO UPDATE SET
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			background = EXCLUDED.background,
+			qr_x = EXCLUDED.qr_x,
+			qr_y = EXCLUDED.qr_y,
+			qr_size = EXCLUDED.qr_size,
+			fields = EXCLUDED.fields,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, eventID, tmpl.Width, tmpl.Height, tmpl.Background, tmpl.QR.X, tmpl.QR.Y, tmpl.QR.Size, fields).Scan(&tmpl.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save ticket template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// Goes back to the default layout
+func (s *Store) DeleteTicketTemplate(eventID int) error {
+	_, err := s.db.Exec(`DELETE FROM ticket_templates WHERE event_id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete ticket template: %w", err)
+	}
+
+	return nil
+}
+
+// Draws a single ticket with a sample QR. Nothing is written, so it can be
+// used while the template is being designed
+func (s *Store) PreviewTicket(eventID int, payload types.PreviewTicketPayload) ([]byte, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event, err := s.getEventByID(tx, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	var tmpl *types.TicketTemplate
+	if payload.Template != nil {
+		tmpl = templateFromPayload(eventID, *payload.Template)
+		if err := checkTicketTemplate(tmpl); err != nil {
+			return nil, err
+		}
+	} else {
+		tmpl, err = getTicketTemplate(tx, eventID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := payload.Name
+	if name == "" {
+		name = "Juan Perez"
+	}
+	table := payload.Table
+	if table == "" {
+		table = "Mesa 1"
+	}
+
+	qr, err := generateQRCode("PREVIEW")
+	if err != nil {
+		return nil, fmt.Errorf("QR generation failed: %w", err)
+	}
+
+	return renderTickets(tmpl, event, []ticketPage{{name: name, table: table, qr: qr}})
+}
+
+func templateFromPayload(eventID int, payload types.SaveTicketTemplatePayload) *types.TicketTemplate {
+	tmpl := &types.TicketTemplate{
+		EventID: eventID,
+		Width:   payload.Width,
+		Height:  payload.Height,
+		QR:      payload.QR,
+		Fields:  payload.Fields,
+	}
+	if payload.Background != nil && strings.TrimSpace(*payload.Background) != "" {
+		background := filepath.ToSlash(filepath.Clean(strings.TrimSpace(*payload.Background)))
+		tmpl.Background = &background
+	}
+	if tmpl.Fields == nil {
+		tmpl.Fields = []types.TicketField{}
+	}
+
+	return tmpl
+}
+
+// Everything has to fall inside the page and the background has to be an
+// image in the assets folder
+func checkTicketTemplate(tmpl *types.TicketTemplate) error {
+	if tmpl.QR.X+tmpl.QR.Size > tmpl.Width || tmpl.QR.Y+tmpl.QR.Size > tmpl.Height {
+		return fmt.Errorf("%w: the QR does not fit in a %gx%gmm ticket", ErrInvalidTemplate, tmpl.Width, tmpl.Height)
+	}
+
+	for i, field := range tmpl.Fields {
+		if field.X+field.Width > tmpl.Width || field.X >= tmpl.Width || field.Y >= tmpl.Height {
+			return fmt.Errorf("%w: field %d is outside the ticket", ErrInvalidTemplate, i+1)
+		}
+	}
+
+	if tmpl.Background != nil {
+		background := *tmpl.Background
+		if !strings.HasPrefix(background, templateAssetsDir+"/") {
+			return fmt.Errorf("%w: the background must be in the %s folder", ErrInvalidTemplate, templateAssetsDir)
+		}
+		if imageType(background) == "" {
+			return fmt.Errorf("%w: the background must be a png or jpg image", ErrInvalidTemplate)
+		}
+		if _, err := os.Stat(background); err != nil {
+			return fmt.Errorf("%w: background %q not found", ErrInvalidTemplate, background)
+		}
+	}
+
+	return nil
+}
+
+// One page of a ticket PDF
+type ticketPage struct {
+	name  string
+	table string
+	qr    []byte
+}
+
+// Draws every page with the template. Named and general tickets share it
+func renderTickets(tmpl *types.TicketTemplate, event *types.Event, pages []ticketPage) ([]byte, error) {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    gofpdf.SizeType{Wd: tmpl.Width, Ht: tmpl.Height},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	utils.AddPDFFonts(pdf)
+
+	background := event.BackgroundImage
+	if tmpl.Background != nil {
+		background = *tmpl.Background
+	}
+
+	bgAlias := ""
+	if background != "" {
+		bgBytes, err := os.ReadFile(background)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read background image: %w", err)
+		}
+		bgAlias = "bg"
+		pdf.RegisterImageOptionsReader(bgAlias, gofpdf.ImageOptions{ImageType: imageType(background)}, bytes.NewReader(bgBytes))
+	}
+
+	date := formatEventDate(event)
+	qrOpts := gofpdf.ImageOptions{ImageType: "PNG"}
+
+	for idx, page := range pages {
+		replacer := strings.NewReplacer(
+			"{name}", page.name,
+			"{event}", event.Name,
+			"{date}", date,
+			"{venue}", event.Venue,
+			"{table}", page.table,
+		)
+
+		pdf.AddPage()
+		if bgAlias != "" {
+			pdf.ImageOptions(bgAlias, 0, 0, tmpl.Width, tmpl.Height, false, gofpdf.ImageOptions{}, 0, "")
+		}
+
+		for _, field := range tmpl.Fields {
+			color := field.Color
+			if color == "" {
+				color = event.TextColor
+			}
+			r, g, b := hexToRGB(color)
+			pdf.SetTextColor(r, g, b)
+
+			style := ""
+			if field.Bold {
+				style = "B"
+			}
+			pdf.SetFont(utils.PDFFont, style, field.FontSize)
+
+			align := field.Align
+			if align == "" {
+				align = "L"
+			}
+
+			// The cell is centered on the line, as the old layout did with 12pt text in 6mm
+			pdf.SetXY(field.X, field.Y)
+			pdf.CellFormat(field.Width, field.FontSize/2, replacer.Replace(field.Text), "", 0, align, false, 0, "")
+		}
+
+		qrAlias := fmt.Sprintf("qr%d", idx)
+		pdf.RegisterImageOptionsReader(qrAlias, qrOpts, bytes.NewReader(page.qr))
+		pdf.ImageOptions(qrAlias, tmpl.QR.X, tmpl.QR.Y, tmpl.QR.Size, 0, false, qrOpts, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("PDF output failed: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gofpdf image type for a file, empty when it is not supported
+func imageType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "PNG"
+	case ".jpg", ".jpeg":
+		return "JPG"
+	}
+
+	return ""
+}
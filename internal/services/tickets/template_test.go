@@ -0,0 +1,77 @@
+package tickets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+func TestTicketTemplate(t *testing.T) {
+	t.Run("should reject templates that do not fit or read outside assets", func(t *testing.T) {
+		cases := map[string]types.SaveTicketTemplatePayload{
+			"qr outside": {Width: 100, Height: 50, QR: types.TicketQR{X: 80, Y: 5, Size: 30}},
+			"field outside": {Width: 100, Height: 50, QR: types.TicketQR{Size: 10}, Fields: []types.TicketField{
+				{Text: "{name}", X: 60, Width: 50, FontSize: 12},
+			}},
+			"background outside assets": {Width: 100, Height: 50, QR: types.TicketQR{Size: 10}, Background: strPtr("assets/../../etc/passwd")},
+			"background not an image":   {Width: 100, Height: 50, QR: types.TicketQR{Size: 10}, Background: strPtr("assets/notes.txt")},
+		}
+
+		for name, payload := range cases {
+			if err := checkTicketTemplate(templateFromPayload(1, payload)); !errors.Is(err, ErrInvalidTemplate) {
+				t.Errorf("%s: expected an invalid template, got %v", name, err)
+			}
+		}
+
+		if err := checkTicketTemplate(defaultTicketTemplate(1)); err != nil {
+			t.Errorf("expected the default template to be valid, got %v", err)
+		}
+	})
+
+	t.Run("should draw one page per ticket", func(t *testing.T) {
+		event := &types.Event{ID: 1, Name: "Boda", EventDate: time.Date(2027, 2, 14, 18, 0, 0, 0, time.UTC), Venue: "Jardín", Timezone: "UTC", TextColor: "#000000"}
+		qr, err := generateQRCode("TEST")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tmpl := defaultTicketTemplate(1)
+		tmpl.Fields = append(tmpl.Fields, types.TicketField{Text: "{table}", X: 35, Y: 60, FontSize: 10, Color: "#FF0000", Align: "C", Width: 100})
+
+		pdf, err := renderTickets(tmpl, event, []ticketPage{
+			{name: "Ana Núñez", table: "Mesa 1", qr: qr},
+			{name: "Acompañante de Ana Núñez", table: "Mesa 1", qr: qr},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.HasPrefix(pdf, []byte("%PDF")) || bytes.Count(pdf, []byte("/Type /Page\n")) != 2 {
+			t.Errorf("expected a two page pdf")
+		}
+	})
+
+	t.Run("should embed a unicode font for names outside latin-1", func(t *testing.T) {
+		event := &types.Event{ID: 1, Name: "Свадьба", Timezone: "UTC", TextColor: "#000000"}
+		qr, err := generateQRCode("TEST")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pdf, err := renderTickets(defaultTicketTemplate(1), event, []ticketPage{{name: "Łukasz “Ёжик” Ωmega", qr: qr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Contains(pdf, []byte("/FontFile2")) || !bytes.Contains(pdf, []byte("/Identity-H")) {
+			t.Error("expected an embedded TrueType font")
+		}
+	})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,70 @@
+package tickets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/diegob0/rspv_backend/internal/services/checkins"
+	"github.com/diegob0/rspv_backend/internal/types"
+)
+
+var ErrNotCheckedIn = errors.New("the ticket is not checked in")
+
+// Takes a check-in back, for a mistaken scan. The ticket is active again and
+// the undo is logged with the operator and the reason
+func (s *Store) UndoCheckIn(eventID int, ticketID int, reason string, userID *int) (*types.TicketHistory, error) {
+	var undoneAt time.Time
+
+	err := s.db.QueryRow(`
+		WITH undone AS (
+			UPDATE tickets SET status = 'active', used_at = NULL, present = FALSE
+			WHERE id = $1 AND event_id = $2 AND status = 'used'
+			RETURNING id, code, NOW() AS undone_at
+		), logged AS (
+			INSERT INTO ticket_scans (event_id, ticket_id, code, result, user_id, note, scanned_at)
+			SELECT $2, id, code, 'undone', $3, $4, undone_at FROM undone
+		)
+		SELECT undone_at FROM undone
+	`, ticketID, eventID, userID, reason).Scan(&undoneAt)
+	if err == sql.ErrNoRows {
+		var status string
+		err := s.db.QueryRow(`SELECT status FROM tickets WHERE id = $1 AND event_id = $2`, ticketID, eventID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return nil, ErrTicketNotFound
+		} else if err != nil {
+			return nil, fmt.Errorf("error consulting ticket: %w", err)
+		}
+		return nil, ErrNotCheckedIn
+	} else if err != nil {
+		return nil, fmt.Errorf("error undoing the check-in: %w", err)
+	}
+
+	s.publishUndo(eventID, ticketID, undoneAt)
+
+	return s.GetTicketHistory(eventID, ticketID)
+}
+
+// Dashboards take the person off their counts
+func (s *Store) publishUndo(eventID int, ticketID int, at time.Time) {
+	tickets, err := s.getDisplayTickets(`WHERE t.id = $1`, ticketID)
+	if err != nil || len(tickets) == 0 {
+		log.Printf("failed to publish undone check-in of ticket %d: %v", ticketID, err)
+		return
+	}
+
+	t := tickets[0]
+	checkins.Publish(types.CheckInEvent{
+		EventID:   eventID,
+		TicketID:  ticketID,
+		Result:    types.ScanUndone,
+		Type:      t.Type,
+		Name:      t.Name,
+		Folio:     t.Folio,
+		TableID:   t.TableID,
+		TableName: t.Table,
+		ScannedAt: at,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/diegob0/rspv_backend/internal/config"
 	"github.com/diegob0/rspv_backend/internal/services/auth"
@@ -24,22 +25,27 @@ func NewHandler(store types.UserStore) *Handler {
 // Router handler
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods(http.MethodPost)
+	router.HandleFunc("/refresh", h.handleRefresh).Methods(http.MethodPost)
+	router.Handle("/logout", auth.AuthMiddleware(http.HandlerFunc(h.handleLogout))).Methods(http.MethodPost)
 	// router.HandleFunc("/register", h.handleRegister).Methods(http.MethodPost)
 
 	// Protected routes
 	protected := router.PathPrefix("/users").Subrouter()
 	protected.Use(auth.AuthMiddleware)
 
-	protected.HandleFunc("", h.handleGetUsers).Methods(http.MethodGet)
 	protected.HandleFunc("/me", h.handleGetUserByEmail).Methods(http.MethodGet)
-	protected.HandleFunc("/{id}", h.handleGetUserByID).Methods(http.MethodGet)
-	protected.HandleFunc("", h.handleRegister).Methods(http.MethodPost)
-	protected.HandleFunc("/{id}", h.handleDeleteUsers).Methods(http.MethodDelete)
-	protected.HandleFunc("/{id}", h.handleUpdateUsers).Methods(http.MethodPatch)
+
+	// Only owners can manage users
+	protected.HandleFunc("", auth.RequirePermission(auth.PermManageUsers, h.handleGetUsers)).Methods(http.MethodGet)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermManageUsers, h.handleGetUserByID)).Methods(http.MethodGet)
+	protected.HandleFunc("", auth.RequirePermission(auth.PermManageUsers, h.handleRegister)).Methods(http.MethodPost)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermManageUsers, h.handleDeleteUsers)).Methods(http.MethodDelete)
+	protected.HandleFunc("/{id}", auth.RequirePermission(auth.PermManageUsers, h.handleUpdateUsers)).Methods(http.MethodPatch)
+	protected.HandleFunc("/{id}/revoke-sessions", auth.RequirePermission(auth.PermManageUsers, h.handleRevokeSessions)).Methods(http.MethodPost)
 }
 
 // @Summary Login
-// @Description Authenticates a user and returns a JWT token
+// @Description Authenticates a user and returns a short lived JWT plus a refresh token
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -77,19 +83,164 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate the JWT
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, u.ID)
+	// Generate the JWT and the refresh token
+	accessToken, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), u.ID, u.Role)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	refreshToken, refreshHash, err := auth.CreateRefreshToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.CreateRefreshToken(u.ID, refreshHash, refreshExpiration()); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.LoginSuccessResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.Envs.JWTExpirationInSeconds,
+	})
+}
+
+// @Summary Refresh the access token
+// @Description Exchanges a refresh token for a new JWT. The refresh token is rotated, the old one stops working
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body types.RefreshTokenPayload true "Refresh Payload"
+// @Success 200 {object} types.LoginSuccessResponse
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 401 {object} types.ErrorResponse
+// @Router /refresh [post]
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	refreshToken, refreshHash, err := auth.CreateRefreshToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u, err := h.store.RotateRefreshToken(auth.HashRefreshToken(payload.RefreshToken), refreshHash, refreshExpiration())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	accessToken, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), u.ID, u.Role)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.LoginSuccessResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.Envs.JWTExpirationInSeconds,
+	})
+}
+
+// @Summary Logout
+// @Description Revokes the current JWT and, if sent, the refresh token
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Param payload body types.LogoutPayload false "Logout Payload"
+// @Success 204 "No content"
+// @Failure 401 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /logout [post]
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.ClaimsKey).(*auth.Claims)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("missing token claims"))
+		return
+	}
+
+	// The body is optional
+	var payload types.LogoutPayload
+	if r.ContentLength > 0 {
+		if err := utils.ParseJSON(r, &payload); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := auth.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := h.store.RevokeRefreshToken(auth.HashRefreshToken(payload.RefreshToken)); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// @Summary Revoke all sessions of a user
+// @Description Immediately invalidates every JWT and refresh token of the user, e.g. for a lost scanner phone
+// @Tags users
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204 "No content"
+// @Failure 400 {object} types.ErrorResponse
+// @Failure 500 {object} types.ErrorResponse
+// @Router /users/{id}/revoke-sessions [post]
+func (h *Handler) handleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	// Parse the id
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+		return
+	}
+
+	if err := h.revokeSessions(r, id); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) revokeSessions(r *http.Request, userID int) error {
+	if err := h.store.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+
+	return auth.RevokeUserTokens(r.Context(), userID)
+}
+
+func refreshExpiration() time.Time {
+	return time.Now().Add(time.Second * time.Duration(config.Envs.RefreshExpInSeconds))
 }
 
 // @Summary Register a new user
-// @Description Registers a new user and returns a 201 status on success
+// @Description Registers a new user and returns a 201 status on success. Requires the owner role
 // @Tags users
 // @Security BearerAuth
 // @Accept json
@@ -129,12 +280,18 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role := payload.Role
+	if role == "" {
+		role = auth.RoleReadOnly
+	}
+
 	// If not create the user
 	err = h.store.CreateUser(types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
 		Password:  hashedPassword,
+		Role:      role,
 	})
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
@@ -249,6 +406,12 @@ func (h *Handler) handleDeleteUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refresh tokens go with the user, access tokens must be cut off too
+	if err := auth.RevokeUserTokens(r.Context(), id); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
 
@@ -312,10 +475,23 @@ func (h *Handler) handleUpdateUsers(w http.ResponseWriter, r *http.Request) {
 		user.Password = *payload.Password
 	}
 
+	roleChanged := payload.Role != nil && *payload.Role != user.Role
+	if payload.Role != nil {
+		user.Role = *payload.Role
+	}
+
 	if err := h.store.UpdateUser(user); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	// Tokens carry the role, so old ones must not outlive a change
+	if roleChanged {
+		if err := h.revokeSessions(r, user.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	utils.WriteJSON(w, http.StatusOK, user)
 }
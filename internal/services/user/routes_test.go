@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/gorilla/mux"
@@ -96,3 +97,19 @@ func (m *mockUserStore) DeleteUser(id int) error {
 func (m *mockUserStore) GetUsers() ([]types.User, error) {
 	return nil, nil
 }
+
+func (m *mockUserStore) CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) RotateRefreshToken(oldHash string, newHash string, expiresAt time.Time) (*types.User, error) {
+	return nil, fmt.Errorf("invalid refresh token")
+}
+
+func (m *mockUserStore) RevokeRefreshToken(tokenHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeUserRefreshTokens(userID int) error {
+	return nil
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/diegob0/rspv_backend/internal/types"
 )
@@ -25,6 +26,7 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
+		&user.Role,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -35,7 +37,7 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 }
 
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE email=$1", email)
+	rows, err := s.db.Query("SELECT id, first_name, last_name, email, password, role, created_at FROM users WHERE email=$1", email)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +60,7 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 }
 
 func (s *Store) GetUserByID(id int) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE id=$1", id)
+	rows, err := s.db.Query("SELECT id, first_name, last_name, email, password, role, created_at FROM users WHERE id=$1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +83,7 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 }
 
 func (s *Store) GetUsers() ([]types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users")
+	rows, err := s.db.Query("SELECT id, first_name, last_name, email, password, role, created_at FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +108,7 @@ func (s *Store) GetUsers() ([]types.User, error) {
 }
 
 func (s *Store) CreateUser(user types.User) error {
-	_, err := s.db.Exec("INSERT INTO users (first_name, last_name, email, password) VALUES ($1, $2, $3, $4)", user.FirstName, user.LastName, user.Email, user.Password)
+	_, err := s.db.Exec("INSERT INTO users (first_name, last_name, email, password, role) VALUES ($1, $2, $3, $4, $5)", user.FirstName, user.LastName, user.Email, user.Password, user.Role)
 	if err != nil {
 		return err
 	}
@@ -132,9 +134,9 @@ func (s *Store) DeleteUser(id int) error {
 func (s *Store) UpdateUser(user *types.User) error {
 	res, err := s.db.Exec(`
 		UPDATE users 
-		SET first_name = $1, last_name = $2, email = $3, password = $4 
-		WHERE id = $5
-	`, user.FirstName, user.LastName, user.Email, user.Password, user.ID)
+		SET first_name = $1, last_name = $2, email = $3, password = $4, role = $5
+		WHERE id = $6
+	`, user.FirstName, user.LastName, user.Email, user.Password, user.Role, user.ID)
 	if err != nil {
 		return err
 	}
@@ -148,3 +150,103 @@ func (s *Store) UpdateUser(user *types.User) error {
 	}
 	return nil
 }
+
+func (s *Store) CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.Exec("INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)", userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Swaps a refresh token for a new one. Presenting a token that was already
+// rotated means it leaked, so every session of the user is revoked.
+func (s *Store) RotateRefreshToken(oldHash string, newHash string, expiresAt time.Time) (*types.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID   int
+		userID    int
+		expires   time.Time
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, oldHash).Scan(&tokenID, &userID, &expires, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reuse detected, all sessions revoked")
+	}
+
+	if time.Now().After(expires) {
+		return nil, fmt.Errorf("refresh token expired")
+	}
+
+	var newID int
+	err = tx.QueryRow("INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id", userID, newHash, expiresAt).Scan(&newID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2", newID, tokenID); err != nil {
+		return nil, err
+	}
+
+	user := new(types.User)
+	err = tx.QueryRow("SELECT id, first_name, last_name, email, password, role, created_at FROM users WHERE id = $1", userID).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.Role,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *Store) RevokeRefreshToken(tokenHash string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL", tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) RevokeUserRefreshTokens(userID int) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
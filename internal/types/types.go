@@ -1,6 +1,7 @@
 package types
 
 import (
+	"strings"
 	"time"
 )
 
@@ -12,54 +13,123 @@ type UserStore interface {
 	GetUsers() ([]User, error)
 	DeleteUser(id int) error
 	UpdateUser(*User) error
+	CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(oldHash string, newHash string, expiresAt time.Time) (*User, error)
+	RevokeRefreshToken(tokenHash string) error
+	RevokeUserRefreshTokens(userID int) error
 }
 
+type EventStore interface {
+	CreateEvent(Event) error
+	GetEventByID(id int) (*Event, error)
+	GetEvents() ([]Event, error)
+	DeleteEvent(id int) error
+	UpdateEvent(*Event) error
+}
+
+// Every store below is scoped to a single event
 type TableStore interface {
-	CreateTable(Table) error
-	GetTableByName(name string) (*Table, error)
-	GetTableByID(id int) (*Table, error)
-	GetTables(params PaginationParams) (*PaginatedResult[*Table], error)
-	DeleteTable(id int) error
-	UpdateTable(*Table) error
-	GetTableWithGuestsByID(tableID int) (*TableAndGuests, error)
-	GetTablesWithGuests(params PaginationParams) (*PaginatedResult[*TableAndGuests], error)
+	CreateTable(eventID int, table Table) error
+	GetTableByName(eventID int, name string) (*Table, error)
+	GetTableByID(eventID int, id int) (*Table, error)
+	GetTables(eventID int, params PaginationParams) (*PaginatedResult[*Table], error)
+	DeleteTable(eventID int, id int) error
+	UpdateTable(eventID int, table *Table) error
+	GetTableWithGuestsByID(eventID int, tableID int) (*TableAndGuests, error)
+	GetTablesWithGuests(eventID int, params PaginationParams) (*PaginatedResult[*TableAndGuests], error)
+	GetFloorPlan(eventID int) (*FloorPlan, error)
+	SaveLayout(eventID int, payload SaveLayoutPayload) error
+	ReconcileTables(eventID int, fix bool) ([]TableMismatch, error)
 	// BatchInsert([]Table) error
 }
 
 type GuestStore interface {
-	CreateGuest(Guest) error
-	GetGuestByID(id int) (*Guest, error)
-	GetGuests(params PaginationParams) (*PaginatedResult[*Guest], error)
-	GetUnassignedGuests(params PaginationParams) (*PaginatedResult[*Guest], error)
-	GetGuestByName(name string) (*Guest, error)
-	DeleteGuest(id int) error
-	UpdateGuest(*Guest) error
-	AssignGuest(guestID int, tableID int) error
-	UnassignGuest(guestID int) error
-	GetTicketsPerGuest(guestID int) ([]GuestWithTickets, error)
+	CreateGuest(eventID int, guest Guest) error
+	GetGuestByID(eventID int, id int) (*Guest, error)
+	GetGuests(eventID int, params PaginationParams) (*PaginatedResult[*Guest], error)
+	GetUnassignedGuests(eventID int, params PaginationParams) (*PaginatedResult[*Guest], error)
+	GetGuestByName(eventID int, name string) (*Guest, error)
+	DeleteGuest(eventID int, id int) error
+	UpdateGuest(eventID int, guest *Guest) error
+	AssignGuest(eventID int, guestID int, tableID int) ([]ConstraintViolation, error)
+	BatchSeating(eventID int, payload BatchSeatingPayload) ([]ConstraintViolation, error)
+	UnassignGuest(eventID int, guestID int) error
+	GetTicketsPerGuest(eventID int, guestID int) ([]GuestWithTickets, error)
+	RotateInviteToken(eventID int, guestID int) (string, error)
+	GetCompanions(eventID int, guestID int) ([]Companion, error)
+	CreateCompanion(eventID int, companion Companion) (*Companion, error)
+	UpdateCompanion(eventID int, companion *Companion) error
+	DeleteCompanion(eventID int, guestID int, companionID int) error
+	ImportGuests(eventID int, rows []GuestImportRow, opts ImportOptions) (*ImportReport, error)
 	// BatchInsert([]Guest) error
 }
 
+type RSVPStore interface {
+	GetInvitation(token string) (*Invitation, error)
+	RespondInvitation(token string, status string, message *string) (*Invitation, error)
+	GetInvitationTickets(token string, email string) (*ReturnGuestMetadata, error)
+}
+
+type CheckInStore interface {
+	GetCheckInTotals(eventID int) (*CheckInTotals, error)
+}
+
+type ExportStore interface {
+	GetEventName(eventID int) (string, error)
+	GetGuestExport(eventID int) ([]GuestExportRow, error)
+	GetSeatingExport(eventID int) ([]SeatingTable, error)
+}
+
 type TicketStore interface {
-	GenerateTicket(guestID int) error
-	GetTicketInfo(guestName string, confirmAttendance bool, email string) ([]ReturnGuestMetadata, error)
-	RegenerateTicket(guestID int) ([]byte, error)
-	ScanQR(code string) (QRScanResult, error)
+	GenerateTicket(eventID int, guestID int) error
+	GetTicketInfo(eventID int, guestName string, confirmAttendance bool, email string) ([]ReturnGuestMetadata, error)
+	RegenerateTicket(eventID int, guestID int) ([]byte, error)
+	ScanQR(eventID int, code string, scan ScanContext) (QRScanResult, error)
+	GetScans(eventID int, filters ScanFilters, params PaginationParams) (*PaginatedResult[ScanLogEntry], error)
+	GetTicketHistory(eventID int, ticketID int) (*TicketHistory, error)
+	GetScanManifest(eventID int) (*ScanManifest, error)
+	SyncScans(eventID int, userID *int, payload SyncScansPayload) (*SyncScansResult, error)
+	CheckInParty(eventID int, code string, scan ScanContext) (*PartyCheckIn, error)
+	GetParty(eventID int, guestID int) (*PartyStatus, error)
+	UndoCheckIn(eventID int, ticketID int, reason string, userID *int) (*TicketHistory, error)
 
-	GenerateAllTickets() error
-	GenerateGeneralTicket(count int) (err error)
-	GenerateGeneral(generalID int) ([]byte, error)
+	GenerateAllTickets(eventID int) error
+	GenerateGeneralTicket(eventID int, count int) (err error)
+	GenerateGeneral(eventID int, generalID int) ([]byte, error)
 
-	GetGeneralTicketsInfo(params PaginationParams) (*PaginatedResult[GeneralTicket], error)
-	GetUnassignedGeneralTickets(params PaginationParams) (*PaginatedResult[GeneralTicket], error)
+	GetGeneralTicketsInfo(eventID int, params PaginationParams) (*PaginatedResult[GeneralTicket], error)
+	GetUnassignedGeneralTickets(eventID int, params PaginationParams) (*PaginatedResult[GeneralTicket], error)
 	// GetNamedTicketsInfo() ([]NamedTicket, error)
-	GetTicketsCount() (AllTickets, error)
+	GetTicketsCount(eventID int) (AllTickets, error)
+	GetSeatingCards(eventID int) (*SeatingCards, error)
+
+	GetTicketTemplate(eventID int) (*TicketTemplate, error)
+	SaveTicketTemplate(eventID int, payload SaveTicketTemplatePayload) (*TicketTemplate, error)
+	DeleteTicketTemplate(eventID int) error
+	PreviewTicket(eventID int, payload PreviewTicketPayload) ([]byte, error)
+
+	RebuildTickets(eventID int, guestID int, rotateCodes bool, reissue bool) (*RebuildTicketsResult, error)
+	RevokeTicket(eventID int, ticketID int, payload RevokeTicketsPayload) (*RevokeTicketsResult, error)
+	RevokeGuestTickets(eventID int, guestID int, payload RevokeTicketsPayload) (*RevokeTicketsResult, error)
+	RevokeGeneralTicket(eventID int, generalID int, payload RevokeTicketsPayload) (*RevokeTicketsResult, error)
+}
+
+type SeatingStore interface {
+	GetSeatingState(eventID int) (*SeatingState, error)
+	ApplySeating(eventID int, payload ApplySeatingPayload) ([]ConstraintViolation, error)
+}
+
+type ConstraintStore interface {
+	GetConstraints(eventID int) ([]SeatingConstraint, error)
+	CreateConstraint(eventID int, constraint SeatingConstraint) (*SeatingConstraint, error)
+	DeleteConstraint(eventID int, id int) error
+	GetViolations(eventID int) ([]ConstraintViolation, error)
 }
 
 type GeneralStore interface {
-	DeleteLastGenerals(count int) error
-	AssignGeneral(generalID int, tableID int) error
-	UnassignGeneral(generalID int) error
+	DeleteLastGenerals(eventID int, count int) error
+	AssignGeneral(eventID int, generalID int, tableID int) ([]ConstraintViolation, error)
+	UnassignGeneral(eventID int, generalID int) error
 }
 
 type PhotoStore interface {
@@ -78,45 +148,166 @@ type User struct {
 	LastName  string    `json:"lastName"`
 	Email     string    `json:"emal"`
 	Password  string    `json:"password"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+type Event struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	EventDate       time.Time  `json:"eventDate"`
+	Venue           string     `json:"venue"`
+	Timezone        string     `json:"timezone"`
+	BackgroundImage string     `json:"backgroundImage"`
+	TextColor       string     `json:"textColor"`
+	RSVPDeadline    *time.Time `json:"rsvpDeadline"`
+	ReEntry         bool       `json:"reEntry"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// Guests can no longer answer once the deadline has passed
+func (e *Event) RSVPClosed(now time.Time) bool {
+	return e.RSVPDeadline != nil && now.After(*e.RSVPDeadline)
+}
+
+// RSVP states stored in guests.rsvp_status
+const (
+	RSVPPending  = "pending"
+	RSVPAccepted = "accepted"
+	RSVPDeclined = "declined"
+)
+
+// Capacity is the total size of the table, used and free seats are computed
+// from the guests (plus additionals) and generals seated at it
 type Table struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Capacity  int       `json:"capacity"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Capacity  int           `json:"capacity"`
+	UsedSeats int           `json:"usedSeats"`
+	FreeSeats int           `json:"freeSeats"`
+	Geometry  TableGeometry `json:"geometry"`
+	CreatedAt time.Time     `json:"createdAt"`
 }
 
 type TableAndGuests struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Capacity  int       `json:"capacity"`
-	CreatedAt time.Time `json:"createdAt"`
-	Guests    []Guest   `json:"guests"`
-	Generals  []General `json:"generals"`
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Capacity  int           `json:"capacity"`
+	UsedSeats int           `json:"usedSeats"`
+	FreeSeats int           `json:"freeSeats"`
+	Geometry  TableGeometry `json:"geometry"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Guests    []Guest       `json:"guests"`
+	Generals  []General     `json:"generals"`
+}
+
+// Table shapes of the floor plan
+const (
+	ShapeRound     = "round"
+	ShapeRectangle = "rectangle"
+	ShapeSquare    = "square"
+)
+
+// Position of a table on the floor plan, in meters. X and Y are the center
+// and stay null until the table is placed.
+type TableGeometry struct {
+	X        *float64 `json:"x"`
+	Y        *float64 `json:"y"`
+	Shape    string   `json:"shape"`
+	Width    float64  `json:"width"`
+	Height   float64  `json:"height"`
+	Rotation float64  `json:"rotation"`
+	Zone     *string  `json:"zone"`
+}
+
+// Dance floor, stage and anything else in the room that is not a table
+type FloorFixture struct {
+	ID       int     `json:"id"`
+	Kind     string  `json:"kind"`
+	Label    *string `json:"label"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	Rotation float64 `json:"rotation"`
+}
+
+type FloorPlan struct {
+	EventName string            `json:"eventName"`
+	Tables    []*TableAndGuests `json:"tables"`
+	Fixtures  []FloorFixture    `json:"fixtures"`
+}
+
+// A table whose seated people do not fit its capacity
+type TableMismatch struct {
+	EventID   int    `json:"eventId"`
+	TableID   int    `json:"tableId"`
+	Name      string `json:"name"`
+	Capacity  int    `json:"capacity"`
+	UsedSeats int    `json:"usedSeats"`
+	Fixed     bool   `json:"fixed"`
 }
 
 type GuestWithTickets struct {
-	ID                int       `json:"id"`
-	FullName          string    `json:"fullName"`
-	Additionals       int       `json:"additionals"`
-	ConfirmAttendance bool      `json:"confirmAttendance"`
-	TableId           *int      `json:"tableId"`
-	QrCodeUrls        []string  `json:"qrCodeUrls"`
-	TicketGenerated   bool      `json:"ticketGenerated"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID              int       `json:"id"`
+	FullName        string    `json:"fullName"`
+	Additionals     int       `json:"additionals"`
+	RSVPStatus      string    `json:"rsvpStatus"`
+	TableId         *int      `json:"tableId"`
+	QrCodeUrls      []string  `json:"qrCodeUrls"`
+	TicketGenerated bool      `json:"ticketGenerated"`
+	CreatedAt       time.Time `json:"createdAt"`
 }
 
 type Guest struct {
-	ID                int       `json:"id"`
-	FullName          string    `json:"fullName"`
-	Additionals       int       `json:"additionals"`
-	ConfirmAttendance bool      `json:"confirmAttendance"`
-	TableId           *int      `json:"tableId"`
-	TicketGenerated   bool      `json:"ticketGenerated"`
-	TicketSent        bool      `json:"ticketSent"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID              int           `json:"id"`
+	FullName        string        `json:"fullName"`
+	Additionals     int           `json:"additionals"`
+	RSVPStatus      string        `json:"rsvpStatus"`
+	RespondedAt     *time.Time    `json:"respondedAt"`
+	RSVPMessage     *string       `json:"rsvpMessage"`
+	Email           *string       `json:"email,omitempty"`
+	Phone           *string       `json:"phone,omitempty"`
+	Tags            []string      `json:"tags"`
+	TableId         *int          `json:"tableId"`
+	TicketGenerated bool          `json:"ticketGenerated"`
+	TicketSent      bool          `json:"ticketSent"`
+	InviteToken     string        `json:"inviteToken,omitempty"`
+	Companions      []Companion   `json:"companions,omitempty"`
+	CheckIn         *CheckInCount `json:"checkIn,omitempty"`
+	CreatedAt       time.Time     `json:"createdAt"`
+}
+
+// Named plus-one of a guest, takes one of the guest's additionals
+type Companion struct {
+	ID        int       `json:"id"`
+	GuestID   int       `json:"guestId"`
+	FullName  string    `json:"fullName"`
+	Email     *string   `json:"email,omitempty"`
+	Notes     *string   `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// What the guest sees when opening the invitation link
+type Invitation struct {
+	EventID         int         `json:"-"`
+	GuestID         int         `json:"-"`
+	GuestName       string      `json:"guestName"`
+	Additionals     int         `json:"additionals"`
+	RSVPStatus      string      `json:"rsvpStatus"`
+	RespondedAt     *time.Time  `json:"respondedAt"`
+	RSVPMessage     *string     `json:"rsvpMessage"`
+	TicketGenerated bool        `json:"ticketGenerated"`
+	TableName       *string     `json:"tableName,omitempty"`
+	EventName       string      `json:"eventName"`
+	EventDate       time.Time   `json:"eventDate"`
+	RSVPDeadline    *time.Time  `json:"rsvpDeadline"`
+	Venue           string      `json:"venue"`
+	Companions      []Companion `json:"companions"`
+}
+
+func (i *Invitation) RSVPClosed(now time.Time) bool {
+	return i.RSVPDeadline != nil && now.After(*i.RSVPDeadline)
 }
 
 type General struct {
@@ -138,25 +329,26 @@ type GeneralTicket struct {
 }
 
 type NamedTicket struct {
-	ID                int       `json:"id"`
-	FullName          string    `json:"fullName"`
-	Additionals       int       `json:"additionals"`
-	ConfirmAttendance bool      `json:"confirmAttendance"`
-	TableId           *int      `json:"tableId"`
-	TicketGenerated   bool      `json:"ticketGenerated"`
-	TicketSent        bool      `json:"ticketSent"`
-	QRCodes           []string  `json:"qrCodes"`
-	PDFiles           string    `json:"pdfiles"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID              int       `json:"id"`
+	FullName        string    `json:"fullName"`
+	Additionals     int       `json:"additionals"`
+	RSVPStatus      string    `json:"rsvpStatus"`
+	TableId         *int      `json:"tableId"`
+	TicketGenerated bool      `json:"ticketGenerated"`
+	TicketSent      bool      `json:"ticketSent"`
+	QRCodes         []string  `json:"qrCodes"`
+	PDFiles         string    `json:"pdfiles"`
+	CreatedAt       time.Time `json:"createdAt"`
 }
 
 type AllTickets struct {
-	NamedTickets      int `json:"namedTickets"`
-	GeneralTickets    int `json:"generalTickets"`
-	TotalTickets      int `json:"totalTickets"`
-	GuestTotal        int `json:"guestTotal"`
-	GuestConfirmed    int `json:"guestConfirmed"`
-	GuestNotConfirmed int `json:"guestNotConfirmed"`
+	NamedTickets   int `json:"namedTickets"`
+	GeneralTickets int `json:"generalTickets"`
+	TotalTickets   int `json:"totalTickets"`
+	GuestTotal     int `json:"guestTotal"`
+	GuestAccepted  int `json:"guestAccepted"`
+	GuestDeclined  int `json:"guestDeclined"`
+	GuestPending   int `json:"guestPending"`
 }
 
 type Ticket struct {
@@ -185,6 +377,7 @@ type RegisterUserPayload struct {
 	LastName  string `json:"lastName" validate:"required" example:"La creatura de la noche"`
 	Email     string `json:"email" validate:"required,email" example:"uri@uri.com"`
 	Password  string `json:"password" validate:"required,min=3,max=130" example:"1234"`
+	Role      string `json:"role,omitempty" validate:"omitempty,oneof=owner planner door-staff read-only" example:"planner"`
 }
 
 type LoginUserPayload struct {
@@ -205,6 +398,30 @@ type UpdateUserPayload struct {
 	LastName  *string `json:"lastName,omitempty" example:"La creatura de la noche"`
 	Email     *string `json:"email,omitempty" validate:"omitempty,email" example:"uri@uri.com"`
 	Password  *string `json:"password,omitempty" validate:"omitempty,min=3,max=130" example:"123"`
+	Role      *string `json:"role,omitempty" validate:"omitempty,oneof=owner planner door-staff read-only" example:"door-staff"`
+}
+
+// Payloads for the events
+type CreateEventPayload struct {
+	Name            string     `json:"name" validate:"required" example:"Boda Vane y Carlos"`
+	EventDate       time.Time  `json:"eventDate" validate:"required" example:"2025-11-22T18:00:00-06:00"`
+	Venue           string     `json:"venue" validate:"required" example:"Hacienda San Gabriel"`
+	Timezone        string     `json:"timezone,omitempty" validate:"omitempty,timezone" example:"America/Mexico_City"`
+	BackgroundImage string     `json:"backgroundImage,omitempty" example:"assets/Pase3.png"`
+	TextColor       string     `json:"textColor,omitempty" validate:"omitempty,hexcolor" example:"#FFFFFF"`
+	RSVPDeadline    *time.Time `json:"rsvpDeadline,omitempty" example:"2025-10-31T23:59:59-06:00"`
+	ReEntry         bool       `json:"reEntry,omitempty"`
+}
+
+type UpdateEventPayload struct {
+	Name            *string    `json:"name,omitempty" example:"Boda Vane y Carlos"`
+	EventDate       *time.Time `json:"eventDate,omitempty" example:"2025-11-22T18:00:00-06:00"`
+	Venue           *string    `json:"venue,omitempty" example:"Hacienda San Gabriel"`
+	Timezone        *string    `json:"timezone,omitempty" validate:"omitempty,timezone" example:"America/Mexico_City"`
+	BackgroundImage *string    `json:"backgroundImage,omitempty" example:"assets/Pase3.png"`
+	TextColor       *string    `json:"textColor,omitempty" validate:"omitempty,hexcolor" example:"#FFFFFF"`
+	RSVPDeadline    *time.Time `json:"rsvpDeadline,omitempty" example:"2025-10-31T23:59:59-06:00"`
+	ReEntry         *bool      `json:"reEntry,omitempty"`
 }
 
 // Payloads for the tables
@@ -218,17 +435,374 @@ type UpdateTablePayload struct {
 	Capacity *int    `json:"capacity,omitempty" example:"10"`
 }
 
+type TableLayoutPayload struct {
+	ID       int      `json:"id" validate:"required"`
+	X        *float64 `json:"x" example:"4.5"`
+	Y        *float64 `json:"y" example:"3"`
+	Shape    string   `json:"shape" validate:"omitempty,oneof=round rectangle square" example:"round"`
+	Width    float64  `json:"width" validate:"omitempty,gt=0" example:"1.8"`
+	Height   float64  `json:"height" validate:"omitempty,gt=0" example:"1.8"`
+	Rotation float64  `json:"rotation" example:"0"`
+	Zone     *string  `json:"zone" validate:"omitempty,max=100" example:"Terraza"`
+}
+
+type FixturePayload struct {
+	Kind     string  `json:"kind" validate:"required,oneof=dance_floor stage bar dj entrance buffet other" example:"dance_floor"`
+	Label    *string `json:"label" validate:"omitempty,max=100"`
+	X        float64 `json:"x" example:"10"`
+	Y        float64 `json:"y" example:"6"`
+	Width    float64 `json:"width" validate:"required,gt=0" example:"6"`
+	Height   float64 `json:"height" validate:"required,gt=0" example:"6"`
+	Rotation float64 `json:"rotation"`
+}
+
+// Tables in the payload get the given geometry, fixtures replace the saved ones
+type SaveLayoutPayload struct {
+	Tables   []TableLayoutPayload `json:"tables" validate:"dive"`
+	Fixtures []FixturePayload     `json:"fixtures" validate:"dive"`
+}
+
+// With reissue the revoked tickets are replaced by new codes right away
+type RevokeTicketsPayload struct {
+	Reason  string `json:"reason" validate:"required,max=250" example:"lost phone"`
+	Reissue bool   `json:"reissue" example:"true"`
+}
+
+// Width field of 0 runs to the right edge of the ticket
+type SaveTicketTemplatePayload struct {
+	Width      float64       `json:"width" validate:"required,gt=0,lte=600" example:"200"`
+	Height     float64       `json:"height" validate:"required,gt=0,lte=600" example:"80"`
+	Background *string       `json:"background,omitempty" example:"assets/Pase3.png"`
+	QR         TicketQR      `json:"qr" validate:"required"`
+	Fields     []TicketField `json:"fields" validate:"required,max=20,dive"`
+}
+
+// Without a template the saved one (or the default) is drawn
+type PreviewTicketPayload struct {
+	Template *SaveTicketTemplatePayload `json:"template,omitempty"`
+	Name     string                     `json:"name" example:"Juan Perez"`
+	Table    string                     `json:"table" example:"Mesa 1"`
+}
+
 // Payloads for the guests
 type CreateGuestPayload struct {
-	FullName          string `json:"fullName" validate:"required" example:"Juan Perez"`
-	Additionals       *int   `json:"additionals" validate:"required" example:"0"`
-	ConfirmAttendance *bool  `json:"confirmAttendance" validate:"required" example:"false"`
+	FullName    string   `json:"fullName" validate:"required" example:"Juan Perez"`
+	Additionals *int     `json:"additionals" validate:"required" example:"0"`
+	RSVPStatus  string   `json:"rsvpStatus,omitempty" validate:"omitempty,oneof=pending accepted declined" example:"pending"`
+	Email       *string  `json:"email,omitempty" validate:"omitempty,email" example:"juan@mail.com"`
+	Phone       *string  `json:"phone,omitempty" validate:"omitempty,max=50" example:"5512345678"`
+	Tags        []string `json:"tags,omitempty" example:"familia novia"`
 }
 
 type UpdateGuestPayload struct {
-	FullName          *string `json:"fullName,omitempty" example:"Eduardo Garcia"`
-	Additionals       *int    `json:"additionals,omitempty" example:"0"`
-	ConfirmAttendance *bool   `json:"confirmAttendance,omitempty" example:"false"`
+	FullName    *string   `json:"fullName,omitempty" example:"Eduardo Garcia"`
+	Additionals *int      `json:"additionals,omitempty" example:"0"`
+	RSVPStatus  *string   `json:"rsvpStatus,omitempty" validate:"omitempty,oneof=pending accepted declined" example:"accepted"`
+	Email       *string   `json:"email,omitempty" validate:"omitempty,email" example:"eduardo@mail.com"`
+	Phone       *string   `json:"phone,omitempty" validate:"omitempty,max=50" example:"5512345678"`
+	Tags        *[]string `json:"tags,omitempty" example:"familia novio"`
+}
+
+// Exports
+type GuestExportRow struct {
+	ID              int
+	FullName        string
+	Additionals     int
+	RSVPStatus      string
+	RespondedAt     *time.Time
+	Email           *string
+	Phone           *string
+	Tags            []string
+	TableName       *string
+	TicketGenerated bool
+	TicketSent      bool
+	Companions      []string
+}
+
+// Kinds of seat in the seating sheet
+const (
+	SeatGuest     = "guest"
+	SeatCompanion = "companion"
+	SeatGeneral   = "general"
+)
+
+// Placeholder marks the anonymous "Acompañante de" seat of an unnamed additional
+type SeatingSeat struct {
+	Name        string
+	Host        *string
+	Kind        string
+	Placeholder bool
+}
+
+type SeatingTable struct {
+	ID       int
+	Name     string
+	Capacity int
+	Seats    []SeatingSeat
+}
+
+// Sections of the printable seating cards
+const (
+	CardsEscort = "escort"
+	CardsPlace  = "place"
+	CardsTable  = "table"
+)
+
+type SeatingCards struct {
+	EventName string
+	EventDate string
+	Tables    []SeatingTable
+}
+
+// Layout of the ticket PDF, in millimeters. Text may use the placeholders
+// {name}, {event}, {date}, {venue} and {table}. An empty color or background
+// falls back to the event's textColor and backgroundImage.
+type TicketField struct {
+	Text     string  `json:"text" validate:"required,max=200" example:"Invitado: {name}"`
+	X        float64 `json:"x" validate:"gte=0" example:"35"`
+	Y        float64 `json:"y" validate:"gte=0" example:"32"`
+	Width    float64 `json:"width" validate:"gte=0" example:"0"`
+	FontSize float64 `json:"fontSize" validate:"gte=4,lte=96" example:"12"`
+	Bold     bool    `json:"bold" example:"true"`
+	Color    string  `json:"color,omitempty" validate:"omitempty,hexcolor" example:"#FFFFFF"`
+	Align    string  `json:"align,omitempty" validate:"omitempty,oneof=L C R" example:"L"`
+}
+
+type TicketQR struct {
+	X    float64 `json:"x" validate:"gte=0" example:"153"`
+	Y    float64 `json:"y" validate:"gte=0" example:"21"`
+	Size float64 `json:"size" validate:"gt=0" example:"40"`
+}
+
+// Default is true when the event has no saved template
+type TicketTemplate struct {
+	EventID    int           `json:"eventId"`
+	Width      float64       `json:"width"`
+	Height     float64       `json:"height"`
+	Background *string       `json:"background"`
+	QR         TicketQR      `json:"qr"`
+	Fields     []TicketField `json:"fields"`
+	Default    bool          `json:"default"`
+	UpdatedAt  *time.Time    `json:"updatedAt"`
+}
+
+// Kinds of seating constraint
+const (
+	ConstraintTogether = "together"
+	ConstraintApart    = "apart"
+	ConstraintReserved = "reserved"
+)
+
+// Together and apart rules apply to GuestIDs, a reserved rule keeps TableID
+// for the guests tagged with Tag. Strict rules block assignments, the others
+// only warn.
+type SeatingConstraint struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	GuestIDs  []int     `json:"guestIds"`
+	TableID   *int      `json:"tableId,omitempty"`
+	Tag       *string   `json:"tag,omitempty"`
+	Strict    bool      `json:"strict"`
+	Notes     *string   `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ConstraintViolation struct {
+	ConstraintID int    `json:"constraintId"`
+	Kind         string `json:"kind"`
+	Strict       bool   `json:"strict"`
+	TableIDs     []int  `json:"tableIds"`
+	GuestIDs     []int  `json:"guestIds,omitempty"`
+	GeneralIDs   []int  `json:"generalIds,omitempty"`
+	Message      string `json:"message"`
+}
+
+// Returned when an assignment breaks a strict constraint
+type ConstraintConflict struct {
+	Violations []ConstraintViolation
+}
+
+func (c *ConstraintConflict) Error() string {
+	messages := make([]string, 0, len(c.Violations))
+	for _, v := range c.Violations {
+		messages = append(messages, v.Message)
+	}
+
+	return "seating constraint violated: " + strings.Join(messages, "; ")
+}
+
+// Seating planner
+type PlannerTable struct {
+	ID        int
+	Name      string
+	Capacity  int
+	UsedSeats int
+}
+
+type PlannerGuest struct {
+	ID       int
+	FullName string
+	Seats    int
+	Tags     []string
+	TableID  *int
+}
+
+// Tables and who is (or still has to be) seated at them
+type SeatingState struct {
+	Tables      []PlannerTable
+	Guests      []PlannerGuest
+	Generals    []General
+	Constraints []SeatingConstraint
+}
+
+type GuestPlacement struct {
+	GuestID   int    `json:"guestId"`
+	FullName  string `json:"fullName"`
+	Seats     int    `json:"seats"`
+	TableID   int    `json:"tableId"`
+	TableName string `json:"tableName"`
+}
+
+type GeneralPlacement struct {
+	GeneralID int    `json:"generalId"`
+	Folio     int    `json:"folio"`
+	TableID   int    `json:"tableId"`
+	TableName string `json:"tableName"`
+}
+
+type UnplacedParty struct {
+	GuestIDs []int  `json:"guestIds"`
+	Seats    int    `json:"seats"`
+	Reason   string `json:"reason"`
+}
+
+type PlannedTable struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Capacity  int    `json:"capacity"`
+	UsedSeats int    `json:"usedSeats"`
+	FreeSeats int    `json:"freeSeats"`
+}
+
+// Proposed assignment, nothing is saved until it is applied
+type SeatingPlan struct {
+	Guests   []GuestPlacement   `json:"guests"`
+	Generals []GeneralPlacement `json:"generals"`
+	Unplaced []UnplacedParty    `json:"unplaced"`
+	Tables   []PlannedTable     `json:"tables"`
+}
+
+// Guest import from CSV/XLSX
+type GuestImportRow struct {
+	Row         int
+	FullName    string
+	Additionals int
+	RSVPStatus  string
+	TableName   string
+	Email       string
+	Phone       string
+	Tags        []string
+	// Problems found while parsing the row
+	Issues []ImportIssue
+}
+
+type ImportOptions struct {
+	DryRun        bool
+	CreateTables  bool
+	TableCapacity int
+}
+
+type ImportIssue struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun        bool          `json:"dryRun"`
+	Applied       bool          `json:"applied"`
+	TotalRows     int           `json:"totalRows"`
+	ValidRows     int           `json:"validRows"`
+	Created       int           `json:"created"`
+	TablesCreated []string      `json:"tablesCreated"`
+	Errors        []ImportIssue `json:"errors"`
+	Duplicates    []ImportIssue `json:"duplicates"`
+}
+
+// Payloads for the seating planner
+type PlanSeatingPayload struct {
+	// Groups of guest IDs that must share a table
+	Together [][]int `json:"together" validate:"dive,min=2"`
+	// Groups of guest IDs that must not share a table
+	Apart           [][]int `json:"apart" validate:"dive,min=2"`
+	IncludeGenerals bool    `json:"includeGenerals"`
+}
+
+type GuestAssignment struct {
+	GuestID int `json:"guestId" validate:"required"`
+	TableID int `json:"tableId" validate:"required"`
+}
+
+type GeneralAssignment struct {
+	GeneralID int `json:"generalId" validate:"required"`
+	TableID   int `json:"tableId" validate:"required"`
+}
+
+type ApplySeatingPayload struct {
+	Guests   []GuestAssignment   `json:"guests" validate:"dive"`
+	Generals []GeneralAssignment `json:"generals" validate:"dive"`
+}
+
+// Payloads for batch seating, Kind is SeatGuest or SeatGeneral
+type SeatRef struct {
+	Kind string `json:"kind" validate:"required,oneof=guest general"`
+	ID   int    `json:"id" validate:"required,gt=0"`
+}
+
+// A null TableID unassigns
+type SeatingMove struct {
+	Kind    string `json:"kind" validate:"required,oneof=guest general"`
+	ID      int    `json:"id" validate:"required,gt=0"`
+	TableID *int   `json:"tableId" validate:"omitempty,gt=0"`
+}
+
+type SeatingSwap struct {
+	A SeatRef `json:"a" validate:"required"`
+	B SeatRef `json:"b" validate:"required"`
+}
+
+type BatchSeatingPayload struct {
+	Moves []SeatingMove `json:"moves" validate:"dive"`
+	Swaps []SeatingSwap `json:"swaps" validate:"dive"`
+}
+
+// Payloads for the seating constraints
+type CreateConstraintPayload struct {
+	Kind     string  `json:"kind" validate:"required,oneof=together apart reserved"`
+	GuestIDs []int   `json:"guestIds" validate:"dive,gt=0"`
+	TableID  *int    `json:"tableId" validate:"omitempty,gt=0"`
+	Tag      *string `json:"tag" validate:"omitempty,min=1,max=100"`
+	Strict   *bool   `json:"strict"`
+	Notes    *string `json:"notes" validate:"omitempty,max=500"`
+}
+
+// Payloads for the companions
+type CreateCompanionPayload struct {
+	FullName string  `json:"fullName" validate:"required,max=250" example:"Maria Lopez"`
+	Email    *string `json:"email,omitempty" validate:"omitempty,email" example:"maria@mail.com"`
+	Notes    *string `json:"notes,omitempty" validate:"omitempty,max=500" example:"Vegetariana"`
+}
+
+type UpdateCompanionPayload struct {
+	FullName *string `json:"fullName,omitempty" validate:"omitempty,max=250" example:"Maria Lopez"`
+	Email    *string `json:"email,omitempty" validate:"omitempty,email" example:"maria@mail.com"`
+	Notes    *string `json:"notes,omitempty" validate:"omitempty,max=500" example:"Vegetariana"`
+}
+
+// Payloads for the public RSVP
+type RSVPPayload struct {
+	Status  string  `json:"status" validate:"required,oneof=accepted declined" example:"accepted"`
+	Message *string `json:"message,omitempty" validate:"omitempty,max=500" example:"Ahi estaremos"`
 }
 
 // Payloads for the tickets
@@ -242,21 +816,257 @@ type ReturnGuestMetadata struct {
 
 // Return payload after scan ticket
 type ReturnScannedData struct {
-	GuestName    string  `json:"guestName"`
-	TableName    *string `json:"tableName,omitempty"`
-	TicketStatus string  `json:"ticketStatus"`
+	GuestName    string       `json:"guestName"`
+	HostName     *string      `json:"hostName,omitempty"`
+	TableName    *string      `json:"tableName,omitempty"`
+	TicketStatus string       `json:"ticketStatus"`
+	Result       string       `json:"result" example:"admitted"`
+	Party        *PartyStatus `json:"party,omitempty"`
+}
+
+// One person of a guest's party and their ticket
+type PartyMember struct {
+	TicketID    int        `json:"ticketId"`
+	Name        string     `json:"name" example:"Maria Lopez"`
+	CompanionID *int       `json:"companionId,omitempty"`
+	Host        bool       `json:"host"`
+	Status      string     `json:"status" example:"active"`
+	UsedAt      *time.Time `json:"usedAt,omitempty"`
+	Present     bool       `json:"present"`
+}
+
+// How many of a guest's party are in. Members still active have not arrived
+type PartyStatus struct {
+	GuestID   int     `json:"guestId"`
+	GuestName string  `json:"guestName"`
+	TableID   *int    `json:"tableId,omitempty"`
+	TableName *string `json:"tableName,omitempty"`
+	CheckInCount
+	Members []PartyMember `json:"members"`
+}
+
+// Result of checking a whole party in from one of its codes. Reentered are
+// the members let back in after stepping out, on events with re-entry
+type PartyCheckIn struct {
+	Admitted  []int       `json:"admitted"`
+	Reentered []int       `json:"reentered"`
+	Party     PartyStatus `json:"party"`
 }
 
 type ReturnGeneralScannedData struct {
 	GeneralFolio *int    `json:"folio"`
 	TableName    *string `json:"tableName,omitempty"`
 	TicketStatus string  `json:"ticketStatus"`
+	Result       string  `json:"result" example:"admitted"`
 }
 
 type QRScanResult interface {
 	isQRScanResult()
 }
 
+// Who scanned a code and where, kept with every scan attempt
+type ScanContext struct {
+	UserID   *int
+	DeviceID string
+	Gate     string
+}
+
+// Outcomes of a scan attempt. Exits and re-entries only happen on events
+// with re-entry, undone is an admission taken back by an operator
+const (
+	ScanAdmitted  = "admitted"
+	ScanDuplicate = "duplicate"
+	ScanInvalid   = "invalid"
+	ScanForged    = "forged"
+	ScanRevoked   = "revoked"
+	ScanExited    = "exited"
+	ScanReentered = "reentered"
+	ScanUndone    = "undone"
+)
+
+// Empty fields do not filter
+type ScanFilters struct {
+	Result   string
+	Gate     string
+	DeviceID string
+	UserID   *int
+}
+
+type ScanLogEntry struct {
+	ID        int64     `json:"id"`
+	TicketID  *int      `json:"ticketId"`
+	Code      string    `json:"code"`
+	Result    string    `json:"result" example:"admitted"`
+	UserID    *int      `json:"userId"`
+	Operator  *string   `json:"operator,omitempty" example:"door@example.com"`
+	DeviceID  *string   `json:"deviceId,omitempty" example:"ipad-2"`
+	Gate      *string   `json:"gate,omitempty" example:"north"`
+	ScannedAt time.Time `json:"scannedAt"`
+	Offline   bool      `json:"offline"`
+	Note      *string   `json:"note,omitempty" example:"scanned by mistake"`
+}
+
+// Everything a scanner needs to check people in without a connection. Codes
+// are only sent as the hex SHA-256 of the code
+type ScanManifest struct {
+	EventID       int              `json:"eventId"`
+	GeneratedAt   time.Time        `json:"generatedAt"`
+	HashAlgorithm string           `json:"hashAlgorithm" example:"sha256"`
+	Tickets       []ManifestTicket `json:"tickets"`
+}
+
+type ManifestTicket struct {
+	Hash     string     `json:"hash"`
+	TicketID int        `json:"ticketId"`
+	Type     string     `json:"type" example:"named"`
+	Status   string     `json:"status" example:"active"`
+	UsedAt   *time.Time `json:"usedAt,omitempty"`
+	Name     *string    `json:"name,omitempty" example:"Juan Perez"`
+	HostName *string    `json:"hostName,omitempty"`
+	GuestID  *int       `json:"guestId,omitempty"`
+	Folio    *int       `json:"folio,omitempty"`
+	TableID  *int       `json:"tableId,omitempty"`
+	Table    *string    `json:"table,omitempty" example:"Mesa 1"`
+}
+
+// A check-in made while disconnected, with the device clock
+type OfflineScan struct {
+	Code      string    `json:"code" validate:"required,max=100"`
+	ScannedAt time.Time `json:"scannedAt" validate:"required"`
+}
+
+type SyncScansPayload struct {
+	DeviceID string        `json:"deviceId" validate:"required,max=100" example:"ipad-2"`
+	Gate     string        `json:"gate" validate:"max=100" example:"north"`
+	Scans    []OfflineScan `json:"scans" validate:"required,min=1,max=2000,dive"`
+}
+
+// A scan that did not end up as the ticket's admission. Displaced is set for
+// an earlier admission that lost to an older offline scan
+type ScanConflict struct {
+	Code           string     `json:"code"`
+	TicketID       *int       `json:"ticketId"`
+	Result         string     `json:"result" example:"duplicate"`
+	DeviceID       *string    `json:"deviceId,omitempty"`
+	ScannedAt      *time.Time `json:"scannedAt,omitempty"`
+	AdmittedAt     *time.Time `json:"admittedAt,omitempty"`
+	AdmittedDevice *string    `json:"admittedDevice,omitempty"`
+	Displaced      bool       `json:"displaced"`
+}
+
+// Skipped counts scans the device had already uploaded
+type SyncScansResult struct {
+	Admitted  int            `json:"admitted"`
+	Skipped   int            `json:"skipped"`
+	Conflicts []ScanConflict `json:"conflicts"`
+}
+
+// A ticket with every scan of its code, oldest first. Holder is the guest or
+// named companion, Folio is set for general tickets
+type TicketHistory struct {
+	TicketID     int            `json:"ticketId"`
+	Code         string         `json:"code"`
+	Type         string         `json:"type"`
+	Status       string         `json:"status"`
+	Holder       *string        `json:"holder,omitempty"`
+	Folio        *int           `json:"folio,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UsedAt       *time.Time     `json:"usedAt,omitempty"`
+	Present      bool           `json:"present"`
+	RevokedAt    *time.Time     `json:"revokedAt,omitempty"`
+	RevokeReason *string        `json:"revokeReason,omitempty"`
+	Scans        []ScanLogEntry `json:"scans"`
+}
+
+// Published on every admission, exit, re-entry and undone check-in, to the
+// live check-in dashboards
+type CheckInEvent struct {
+	EventID   int       `json:"eventId"`
+	TicketID  int       `json:"ticketId"`
+	Result    string    `json:"result" example:"admitted"`
+	Type      string    `json:"type" example:"named"`
+	Name      *string   `json:"name,omitempty" example:"Juan Perez"`
+	Folio     *int      `json:"folio,omitempty"`
+	TableID   *int      `json:"tableId,omitempty"`
+	TableName *string   `json:"tableName,omitempty"`
+	DeviceID  *string   `json:"deviceId,omitempty"`
+	Gate      *string   `json:"gate,omitempty"`
+	ScannedAt time.Time `json:"scannedAt"`
+	Offline   bool      `json:"offline"`
+}
+
+// Present is who is inside right now, lower than arrived once people step out
+// on events with re-entry
+type CheckInCount struct {
+	Arrived  int `json:"arrived"`
+	Expected int `json:"expected"`
+	Present  int `json:"present"`
+}
+
+// Tickets without a table are counted under a nil TableID
+type TableCheckIns struct {
+	TableID   *int    `json:"tableId"`
+	TableName *string `json:"tableName"`
+	CheckInCount
+}
+
+// Arrivals against the tickets that can still get in (active or used)
+type CheckInTotals struct {
+	CheckInCount
+	Named   CheckInCount    `json:"named"`
+	General CheckInCount    `json:"general"`
+	Tables  []TableCheckIns `json:"tables"`
+}
+
+// Ticket statuses
+const (
+	TicketActive  = "active"
+	TicketUsed    = "used"
+	TicketRevoked = "revoked"
+)
+
+// Returned by a scan of a code that already let someone in. UsedAt is nil
+// for tickets scanned before the time was recorded
+type UsedTicket struct {
+	UsedAt *time.Time
+}
+
+func (u *UsedTicket) Error() string {
+	if u.UsedAt == nil {
+		return "this ticket was already used"
+	}
+	return "this ticket was already used at " + u.UsedAt.Format(time.RFC3339)
+}
+
+// Returned by a scan of a revoked code
+type RevokedTicket struct {
+	Reason    string
+	RevokedAt time.Time
+}
+
+func (r *RevokedTicket) Error() string {
+	return "this ticket was revoked: " + r.Reason
+}
+
+type UndoCheckInPayload struct {
+	Reason string `json:"reason" validate:"required,max=250" example:"scanned by mistake"`
+}
+
+type RevokeTicketsResult struct {
+	Revoked  int `json:"revoked"`
+	Reissued int `json:"reissued"`
+}
+
+// Outcome of rebuilding a guest's tickets: Tickets is how many the guest has
+// now, Added and Revoked follow changes in additionals
+type RebuildTicketsResult struct {
+	GuestID int `json:"guestId"`
+	Tickets int `json:"tickets"`
+	Added   int `json:"added"`
+	Revoked int `json:"revoked"`
+	Rotated int `json:"rotated"`
+}
+
 // Implement both tickts to the result
 func (r ReturnScannedData) isQRScanResult()        {}
 func (r ReturnGeneralScannedData) isQRScanResult() {}
@@ -270,8 +1080,53 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+type ConflictResponse struct {
+	Error      string                `json:"error"`
+	Violations []ConstraintViolation `json:"violations"`
+}
+
+// What an offline scanner needs to verify codes, LegacyCodes tells whether
+// unsigned codes from before signing are still accepted
+type ScanKeyResponse struct {
+	EventID     int    `json:"eventId"`
+	Version     string `json:"version" example:"v1"`
+	Key         string `json:"key"`
+	LegacyCodes bool   `json:"legacyCodes"`
+}
+
+type UsedResponse struct {
+	Error  string     `json:"error"`
+	UsedAt *time.Time `json:"usedAt,omitempty"`
+}
+
+type RevokedResponse struct {
+	Error     string    `json:"error"`
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+type AssignResponse struct {
+	Warnings []ConstraintViolation `json:"warnings"`
+}
+
 type LoginSuccessResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn" example:"900"`
+}
+
+// Token for EventSource, sent as ?token= to the check-in stream
+type StreamTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expiresIn" example:"60"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
 }
 
 // Paginaton Payloads
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"embed"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/diegob0/rspv_backend/internal/config"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Font family every PDF is written with, regular and bold
+const PDFFont = "body"
+
+// DejaVu Sans Condensed covers Latin, Greek, Cyrillic and most punctuation.
+// PDF_FONT_REGULAR and PDF_FONT_BOLD point to other TTF files when an event
+// needs a different look or script.
+//
+//go:embed fonts/*.ttf
+var embeddedFonts embed.FS
+
+var (
+	fontsOnce    sync.Once
+	regularBytes []byte
+	boldBytes    []byte
+)
+
+func loadFont(path string, embedded string) []byte {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return data
+		}
+		log.Printf("failed to read the PDF font %s, using the default one: %v", path, err)
+	}
+
+	data, err := embeddedFonts.ReadFile(embedded)
+	if err != nil {
+		// The embedded files are part of the build, this cannot happen at runtime
+		panic(err)
+	}
+
+	return data
+}
+
+// The TTF files PDFs are written with, for drawing the same text elsewhere
+func FontBytes() (regular []byte, bold []byte) {
+	fontsOnce.Do(func() {
+		regularBytes = loadFont(config.Envs.PDFFontRegular, "fonts/DejaVuSansCondensed.ttf")
+		boldBytes = loadFont(config.Envs.PDFFontBold, "fonts/DejaVuSansCondensed-Bold.ttf")
+	})
+
+	return regularBytes, boldBytes
+}
+
+// Registers PDFFont on the document. Text is written as UTF-8 with no
+// translation; call it before the first SetFont
+func AddPDFFonts(pdf *gofpdf.Fpdf) {
+	regular, bold := FontBytes()
+
+	pdf.AddUTF8FontFromBytes(PDFFont, "", regular)
+	pdf.AddUTF8FontFromBytes(PDFFont, "B", bold)
+}
+
+// Cuts text that would overflow width, adding an ellipsis. Works on runes so
+// multi-byte characters are never split
+func FitPDFText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width-2 {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width-2 {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "…"
+}
@@ -1,14 +1,19 @@
 package utils
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/diegob0/rspv_backend/internal/types"
 	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
 )
 
 var Validate = validator.New()
@@ -33,6 +38,18 @@ func WriteError(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
 }
 
+// Same as WriteError, but a broken seating constraint answers 409 with the
+// rules that were broken
+func WriteSeatingError(w http.ResponseWriter, status int, err error) {
+	var conflict *types.ConstraintConflict
+	if errors.As(err, &conflict) {
+		WriteJSON(w, http.StatusConflict, types.ConflictResponse{Error: err.Error(), Violations: conflict.Violations})
+		return
+	}
+
+	WriteError(w, status, err)
+}
+
 // Pagination helper functions
 func NormalizePagination(p *types.PaginationParams) {
 	if p.Page <= 0 {
@@ -116,3 +133,66 @@ func ParsePaginationParams(r *http.Request) types.PaginationParams {
 		Search:   searchPtr,
 	}
 }
+
+// Every event scoped route is nested under /events/{eventId}
+func ParseEventID(r *http.Request) (int, error) {
+	eventID, err := strconv.Atoi(mux.Vars(r)["eventId"])
+	if err != nil || eventID <= 0 {
+		return 0, fmt.Errorf("invalid event ID")
+	}
+
+	return eventID, nil
+}
+
+// Random URL safe token, used for JWT ids, refresh tokens and invitation links
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Locks a table for the rest of the transaction and returns its total capacity
+// and the seats its guests and generals take
+func TableSeats(tx *sql.Tx, eventID int, tableID int) (capacity int, used int, err error) {
+	err = tx.QueryRow(`
+		SELECT capacity FROM tables WHERE id = $1 AND event_id = $2 FOR UPDATE
+	`, tableID, eventID).Scan(&capacity)
+	if err != nil {
+		return 0, 0, fmt.Errorf("table not found: %w", err)
+	}
+
+	err = tx.QueryRow("SELECT used_seats FROM table_occupancy WHERE table_id = $1", tableID).Scan(&used)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return capacity, used, nil
+}
+
+// Paper sizes gofpdf knows about
+var paperSizes = map[string]string{
+	"letter":  "Letter",
+	"legal":   "Legal",
+	"tabloid": "Tabloid",
+	"a3":      "A3",
+	"a4":      "A4",
+	"a5":      "A5",
+}
+
+// Reads the paper query param of the printable PDFs, Letter by default
+func ParsePaperSize(r *http.Request) (string, error) {
+	paper := strings.ToLower(r.URL.Query().Get("paper"))
+	if paper == "" {
+		return "Letter", nil
+	}
+
+	size, ok := paperSizes[paper]
+	if !ok {
+		return "", fmt.Errorf("unsupported paper size %q, use Letter, Legal, Tabloid, A3, A4 or A5", paper)
+	}
+
+	return size, nil
+}